@@ -0,0 +1,78 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"cursor2api-go/config"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `用法:
+  cursor2api-go                       启动服务
+  cursor2api-go config check [-file]  校验配置文件并打印生效配置（密钥已掩码）
+`
+
+// runCommand 执行子命令并返回进程退出码
+func runCommand(args []string) int {
+	switch args[0] {
+	case "config":
+		if len(args) > 1 && args[1] == "check" {
+			return runConfigCheck(args[2:])
+		}
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "未知命令: %v\n\n%s", args, usage)
+	return 2
+}
+
+// runConfigCheck 按服务启动时相同的规则加载配置（配置文件 + .env + 环境变量），校验并打印结果
+func runConfigCheck(args []string) int {
+	fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+	file := fs.String("file", "", "配置文件路径（默认读取 CONFIG_FILE 环境变量）")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// 命令行指定的文件优先于 .env 中的 CONFIG_FILE，与服务启动时进程环境变量的优先级一致
+	if *file != "" {
+		os.Setenv("CONFIG_FILE", *file)
+	}
+
+	cfg, err := config.LoadConfig()
+	path := os.Getenv("CONFIG_FILE")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ 配置无效: %v\n", err)
+		return 1
+	}
+
+	if path != "" {
+		fmt.Printf("✅ 配置有效: %s\n\n", path)
+	} else {
+		fmt.Print("✅ 配置有效（未指定配置文件，仅使用环境变量和默认值）\n\n")
+	}
+	fmt.Println(cfg.ToJSON())
+	return 0
+}
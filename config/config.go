@@ -24,29 +24,140 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
-	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 )
 
+// 录制/回放模式
+const (
+	CassetteModeRecord = "record"
+	CassetteModeReplay = "replay"
+)
+
+// MapReducePromptOverhead map-reduce 提取请求中除块内容外的最大字节数（提示模板和任务摘录）
+const MapReducePromptOverhead = 2500
+
 // Config 应用程序配置结构
+// 标记 reload:"restart" 的字段热重载时不会生效，需要重启；标记 secret:"true" 的字段在日志中掩码
 type Config struct {
 	// 服务器配置
-	Port  int  `json:"port"`
-	Debug bool `json:"debug"`
+	Port  int  `json:"port" reload:"restart"`
+	Debug bool `json:"debug" reload:"restart"`
 
 	// API配置
-	APIKey             string `json:"api_key"`
-	Models             string `json:"models"`
+	APIKey           string  `json:"api_key" secret:"true"`
+	APIKeys          string  `json:"api_keys" secret:"true"`
+	AdminAPIKey      string  `json:"admin_api_key" secret:"true"`
+	Models           string  `json:"models"`
+	ModelFallbacks   string  `json:"model_fallbacks"`
+	ModelSplits      string  `json:"model_splits"`
+	ModelShadows     string  `json:"model_shadows"`
+	ShadowSampleRate float64 `json:"shadow_sample_rate"`
+
+	// 多模型集成配置
+	EnsembleModels     string `json:"ensemble_models"`
+	EnsembleJudgeModel string `json:"ensemble_judge_model"`
+	EnsembleMaxModels  int    `json:"ensemble_max_models"`
 	SystemPromptInject string `json:"system_prompt_inject"`
-	Timeout            int    `json:"timeout"`
+	Timeout            int    `json:"timeout" reload:"restart"`
 	MaxInputLength     int    `json:"max_input_length"`
+	UpstreamMaxRetries int    `json:"upstream_max_retries"`
+	MaxChoices         int    `json:"max_choices"`
+
+	// 结构化输出（response_format）校验失败后的最多生成次数
+	StructuredOutputMaxAttempts int `json:"structured_output_max_attempts"`
+
+	// 输出被截断时自动续写的最多次数，0 表示不续写
+	AutoContinueMax int `json:"auto_continue_max"`
+
+	// 图片输入限制（image_url），大小和数量为 0 表示不限制，允许的类型为空表示不限制类型
+	ImageMaxSizeMB    int    `json:"image_max_size_mb"`
+	ImageMaxCount     int    `json:"image_max_count"`
+	ImageMaxTotalMB   int    `json:"image_max_total_mb"`
+	ImageAllowedTypes string `json:"image_allowed_types"`
+	ImageFetchTimeout int    `json:"image_fetch_timeout"`
+
+	// 附件（file/input_file 及 attachments 字段）最多占用模型上下文窗口的比例，0 表示不限制
+	AttachmentContextRatio float64 `json:"attachment_context_ratio"`
+
+	// 超长单条输入的 map-reduce：按块并行提取要点，再基于要点回答
+	MapReduceEnabled     bool `json:"map_reduce_enabled"`
+	MapReduceChunkTokens int  `json:"map_reduce_chunk_tokens"`
+	MapReduceMaxChunks   int  `json:"map_reduce_max_chunks"`
+	MapReduceConcurrency int  `json:"map_reduce_concurrency"`
+
+	// JS 执行限制（x-is-human token 计算）
+	JSTimeout        int `json:"js_timeout"`
+	JSMaxOldSpaceMB  int `json:"js_max_old_space_mb"`
+	JSMaxOutputBytes int `json:"js_max_output_bytes"`
+	JSMaxConcurrency int `json:"js_max_concurrency" reload:"restart"`
 
 	// Cursor相关配置
 	ScriptURL string `json:"script_url"`
 	FP        FP     `json:"fp"`
+
+	// 审计日志配置
+	AuditEnabled        bool    `json:"audit_enabled" reload:"restart"`
+	AuditDir            string  `json:"audit_dir" reload:"restart"`
+	AuditMaxSizeMB      int     `json:"audit_max_size_mb" reload:"restart"`
+	AuditMaxFiles       int     `json:"audit_max_files" reload:"restart"`
+	AuditSampleRate     float64 `json:"audit_sample_rate"`
+	AuditRedactRules    string  `json:"audit_redact_rules" reload:"restart"`
+	AuditRedactPatterns string  `json:"audit_redact_patterns" reload:"restart"`
+	AuditOptOutKeys     string  `json:"audit_opt_out_keys" secret:"true"`
+
+	// 响应缓存配置
+	CacheEnabled          bool   `json:"cache_enabled" reload:"restart"`
+	CacheTTL              int    `json:"cache_ttl"`
+	CacheMaxEntries       int    `json:"cache_max_entries" reload:"restart"`
+	CacheDir              string `json:"cache_dir" reload:"restart"`
+	CacheDiskMaxMB        int    `json:"cache_disk_max_mb" reload:"restart"`
+	CacheKeys             string `json:"cache_keys" secret:"true"`
+	CacheStreamChunkSize  int    `json:"cache_stream_chunk_size"`
+	CacheStreamIntervalMs int    `json:"cache_stream_interval_ms"`
+
+	// 合并并发的相同请求
+	CoalesceEnabled bool `json:"coalesce_enabled"`
+
+	// Idempotency-Key 保留窗口（秒），0 表示关闭
+	IdempotencyWindow int `json:"idempotency_window"`
+
+	// 服务端会话：保存目录，以及每次请求带上的历史消息条数上限（0 表示不限制，开头的系统消息始终保留）
+	ConversationsEnabled    bool   `json:"conversations_enabled" reload:"restart"`
+	ConversationDir         string `json:"conversation_dir" reload:"restart"`
+	ConversationMaxMessages int    `json:"conversation_max_messages"`
+
+	// Assistants 风格的助手、线程和运行，保存在嵌入式数据库文件中
+	AssistantsEnabled bool   `json:"assistants_enabled" reload:"restart"`
+	AssistantsDBPath  string `json:"assistants_db_path" reload:"restart"`
+
+	// 批处理（/v1/files、/v1/batches）：文件和结果保存目录、并发数、上传文件大小（MB）和单个批处理的请求数上限
+	BatchEnabled       bool   `json:"batch_enabled" reload:"restart"`
+	BatchDir           string `json:"batch_dir" reload:"restart"`
+	BatchConcurrency   int    `json:"batch_concurrency" reload:"restart"`
+	BatchMaxFileSizeMB int    `json:"batch_max_file_size_mb"`
+	BatchMaxRequests   int    `json:"batch_max_requests"`
+
+	// 上游并发限制与排队配置
+	UpstreamMaxConcurrency int    `json:"upstream_max_concurrency"`
+	QueueMaxWait           int    `json:"queue_max_wait"`
+	LimiterKeyWeights      string `json:"limiter_key_weights" secret:"true"`
+	LimiterKeyPriorities   string `json:"limiter_key_priorities" secret:"true"`
+
+	// 自适应并发（AIMD）配置
+	AdaptiveConcurrency        bool    `json:"adaptive_concurrency" reload:"restart"`
+	AdaptiveMinConcurrency     int     `json:"adaptive_min_concurrency"`
+	AdaptiveMaxConcurrency     int     `json:"adaptive_max_concurrency"`
+	AdaptiveDecreaseFactor     float64 `json:"adaptive_decrease_factor"`
+	AdaptiveLatencyThresholdMs int     `json:"adaptive_latency_threshold_ms"`
+
+	// 上游 SSE 录制/回放配置
+	CassetteMode string `json:"cassette_mode" reload:"restart"`
+	CassetteDir  string `json:"cassette_dir" reload:"restart"`
 }
 
 // FP 指纹配置结构
@@ -57,29 +168,29 @@ type FP struct {
 }
 
 // LoadConfig 加载配置
+// 优先级：环境变量 > 配置文件（CONFIG_FILE）> 默认值
 func LoadConfig() (*Config, error) {
-	// 尝试加载.env文件
-	if err := godotenv.Load(); err != nil {
+	// 尝试加载.env文件（不覆盖进程已有的环境变量）
+	snapshotProcessEnv()
+	if err := reloadDotEnv(); err != nil {
 		logrus.Debug("No .env file found, using environment variables")
 	}
 
-	config := &Config{
-		// 设置默认值
-		Port:               getEnvAsInt("PORT", 8002),
-		Debug:              getEnvAsBool("DEBUG", false),
-		APIKey:             getEnv("API_KEY", "0000"),
-		Models:             getEnv("MODELS", "gpt-4o,claude-3.5-sonnet"),
-		SystemPromptInject: getEnv("SYSTEM_PROMPT_INJECT", ""),
-		Timeout:            getEnvAsInt("TIMEOUT", 60),
-		MaxInputLength:     getEnvAsInt("MAX_INPUT_LENGTH", 200000),
-		ScriptURL:          getEnv("SCRIPT_URL", "https://cursor.com/_next/static/chunks/pages/_app.js"),
-		FP: FP{
-			UserAgent:               getEnv("USER_AGENT", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36"),
-			UNMASKED_VENDOR_WEBGL:   getEnv("UNMASKED_VENDOR_WEBGL", "Google Inc. (Intel)"),
-			UNMASKED_RENDERER_WEBGL: getEnv("UNMASKED_RENDERER_WEBGL", "ANGLE (Intel, Intel(R) UHD Graphics 620 Direct3D11 vs_5_0 ps_5_0, D3D11)"),
-		},
+	return LoadConfigFrom(getEnv("CONFIG_FILE", ""))
+}
+
+// LoadConfigFrom 从指定配置文件加载配置并叠加环境变量，path 为空时只使用环境变量
+func LoadConfigFrom(path string) (*Config, error) {
+	config := defaultConfig()
+
+	if path != "" {
+		if err := loadConfigFile(path, config); err != nil {
+			return nil, err
+		}
 	}
 
+	config.applyEnv()
+
 	// 验证必要的配置
 	if err := config.validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
@@ -88,6 +199,148 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
+// defaultConfig 返回默认配置
+func defaultConfig() *Config {
+	return &Config{
+		Port:               8002,
+		Debug:              false,
+		APIKey:             "0000",
+		Models:             "gpt-4o,claude-3.5-sonnet",
+		SystemPromptInject: "",
+		Timeout:            60,
+		MaxInputLength:     200000,
+		UpstreamMaxRetries: 1,
+		JSTimeout:          10,
+		JSMaxOldSpaceMB:    256,
+		JSMaxOutputBytes:   64 * 1024,
+		JSMaxConcurrency:   4,
+		ScriptURL:          "https://cursor.com/_next/static/chunks/pages/_app.js",
+		FP: FP{
+			UserAgent:               "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/140.0.0.0 Safari/537.36",
+			UNMASKED_VENDOR_WEBGL:   "Google Inc. (Intel)",
+			UNMASKED_RENDERER_WEBGL: "ANGLE (Intel, Intel(R) UHD Graphics 620 Direct3D11 vs_5_0 ps_5_0, D3D11)",
+		},
+		AuditDir:                    "logs/audit",
+		AuditMaxSizeMB:              100,
+		AuditMaxFiles:               10,
+		AuditSampleRate:             1.0,
+		AuditRedactRules:            "email,api_key,phone",
+		CacheTTL:                    3600,
+		CacheMaxEntries:             1000,
+		CacheDiskMaxMB:              512,
+		CacheStreamChunkSize:        20,
+		CacheStreamIntervalMs:       20,
+		IdempotencyWindow:           86400,
+		ConversationDir:             "data/conversations",
+		ConversationMaxMessages:     100,
+		AssistantsDBPath:            "data/assistants.db",
+		BatchDir:                    "data/batches",
+		BatchConcurrency:            4,
+		BatchMaxFileSizeMB:          100,
+		BatchMaxRequests:            50000,
+		ShadowSampleRate:            1.0,
+		EnsembleMaxModels:           5,
+		MaxChoices:                  4,
+		StructuredOutputMaxAttempts: 3,
+		ImageMaxSizeMB:              5,
+		ImageMaxCount:               10,
+		ImageMaxTotalMB:             20,
+		ImageAllowedTypes:           "image/png,image/jpeg,image/gif,image/webp",
+		ImageFetchTimeout:           10,
+		AttachmentContextRatio:      0.5,
+		MapReduceChunkTokens:        4000,
+		MapReduceMaxChunks:          32,
+		MapReduceConcurrency:        4,
+		QueueMaxWait:                30,
+		AdaptiveMinConcurrency:      1,
+		AdaptiveMaxConcurrency:      16,
+		AdaptiveDecreaseFactor:      0.5,
+		AdaptiveLatencyThresholdMs:  15000,
+		CassetteDir:                 "cassettes",
+	}
+}
+
+// applyEnv 用环境变量覆盖配置，未设置的变量保留当前值
+func (c *Config) applyEnv() {
+	c.Port = getEnvAsInt("PORT", c.Port)
+	c.Debug = getEnvAsBool("DEBUG", c.Debug)
+	c.APIKey = getEnv("API_KEY", c.APIKey)
+	c.APIKeys = getEnv("API_KEYS", c.APIKeys)
+	c.AdminAPIKey = getEnv("ADMIN_API_KEY", c.AdminAPIKey)
+	c.Models = getEnv("MODELS", c.Models)
+	c.ModelFallbacks = getEnv("MODEL_FALLBACKS", c.ModelFallbacks)
+	c.ModelSplits = getEnv("MODEL_SPLITS", c.ModelSplits)
+	c.ModelShadows = getEnv("MODEL_SHADOWS", c.ModelShadows)
+	c.ShadowSampleRate = getEnvAsFloat("SHADOW_SAMPLE_RATE", c.ShadowSampleRate)
+	c.EnsembleModels = getEnv("ENSEMBLE_MODELS", c.EnsembleModels)
+	c.EnsembleJudgeModel = getEnv("ENSEMBLE_JUDGE_MODEL", c.EnsembleJudgeModel)
+	c.EnsembleMaxModels = getEnvAsInt("ENSEMBLE_MAX_MODELS", c.EnsembleMaxModels)
+	c.SystemPromptInject = getEnv("SYSTEM_PROMPT_INJECT", c.SystemPromptInject)
+	c.Timeout = getEnvAsInt("TIMEOUT", c.Timeout)
+	c.MaxInputLength = getEnvAsInt("MAX_INPUT_LENGTH", c.MaxInputLength)
+	c.MaxChoices = getEnvAsInt("MAX_CHOICES", c.MaxChoices)
+	c.StructuredOutputMaxAttempts = getEnvAsInt("STRUCTURED_OUTPUT_MAX_ATTEMPTS", c.StructuredOutputMaxAttempts)
+	c.AutoContinueMax = getEnvAsInt("AUTO_CONTINUE_MAX", c.AutoContinueMax)
+	c.ImageMaxSizeMB = getEnvAsInt("IMAGE_MAX_SIZE_MB", c.ImageMaxSizeMB)
+	c.ImageMaxCount = getEnvAsInt("IMAGE_MAX_COUNT", c.ImageMaxCount)
+	c.ImageMaxTotalMB = getEnvAsInt("IMAGE_MAX_TOTAL_MB", c.ImageMaxTotalMB)
+	c.ImageAllowedTypes = getEnv("IMAGE_ALLOWED_TYPES", c.ImageAllowedTypes)
+	c.ImageFetchTimeout = getEnvAsInt("IMAGE_FETCH_TIMEOUT", c.ImageFetchTimeout)
+	c.AttachmentContextRatio = getEnvAsFloat("ATTACHMENT_CONTEXT_RATIO", c.AttachmentContextRatio)
+	c.MapReduceEnabled = getEnvAsBool("MAP_REDUCE_ENABLED", c.MapReduceEnabled)
+	c.MapReduceChunkTokens = getEnvAsInt("MAP_REDUCE_CHUNK_TOKENS", c.MapReduceChunkTokens)
+	c.MapReduceMaxChunks = getEnvAsInt("MAP_REDUCE_MAX_CHUNKS", c.MapReduceMaxChunks)
+	c.MapReduceConcurrency = getEnvAsInt("MAP_REDUCE_CONCURRENCY", c.MapReduceConcurrency)
+	c.UpstreamMaxRetries = getEnvAsInt("UPSTREAM_MAX_RETRIES", c.UpstreamMaxRetries)
+	c.JSTimeout = getEnvAsInt("JS_TIMEOUT", c.JSTimeout)
+	c.JSMaxOldSpaceMB = getEnvAsInt("JS_MAX_OLD_SPACE_MB", c.JSMaxOldSpaceMB)
+	c.JSMaxOutputBytes = getEnvAsInt("JS_MAX_OUTPUT_BYTES", c.JSMaxOutputBytes)
+	c.JSMaxConcurrency = getEnvAsInt("JS_MAX_CONCURRENCY", c.JSMaxConcurrency)
+	c.ScriptURL = getEnv("SCRIPT_URL", c.ScriptURL)
+	c.FP.UserAgent = getEnv("USER_AGENT", c.FP.UserAgent)
+	c.FP.UNMASKED_VENDOR_WEBGL = getEnv("UNMASKED_VENDOR_WEBGL", c.FP.UNMASKED_VENDOR_WEBGL)
+	c.FP.UNMASKED_RENDERER_WEBGL = getEnv("UNMASKED_RENDERER_WEBGL", c.FP.UNMASKED_RENDERER_WEBGL)
+	c.AuditEnabled = getEnvAsBool("AUDIT_ENABLED", c.AuditEnabled)
+	c.AuditDir = getEnv("AUDIT_DIR", c.AuditDir)
+	c.AuditMaxSizeMB = getEnvAsInt("AUDIT_MAX_SIZE_MB", c.AuditMaxSizeMB)
+	c.AuditMaxFiles = getEnvAsInt("AUDIT_MAX_FILES", c.AuditMaxFiles)
+	c.AuditSampleRate = getEnvAsFloat("AUDIT_SAMPLE_RATE", c.AuditSampleRate)
+	c.AuditRedactRules = getEnv("AUDIT_REDACT_RULES", c.AuditRedactRules)
+	c.AuditRedactPatterns = getEnv("AUDIT_REDACT_PATTERNS", c.AuditRedactPatterns)
+	c.AuditOptOutKeys = getEnv("AUDIT_OPT_OUT_KEYS", c.AuditOptOutKeys)
+	c.CacheEnabled = getEnvAsBool("CACHE_ENABLED", c.CacheEnabled)
+	c.CacheTTL = getEnvAsInt("CACHE_TTL", c.CacheTTL)
+	c.CacheMaxEntries = getEnvAsInt("CACHE_MAX_ENTRIES", c.CacheMaxEntries)
+	c.CacheDir = getEnv("CACHE_DIR", c.CacheDir)
+	c.CacheDiskMaxMB = getEnvAsInt("CACHE_DISK_MAX_MB", c.CacheDiskMaxMB)
+	c.CacheKeys = getEnv("CACHE_KEYS", c.CacheKeys)
+	c.CacheStreamChunkSize = getEnvAsInt("CACHE_STREAM_CHUNK_SIZE", c.CacheStreamChunkSize)
+	c.CacheStreamIntervalMs = getEnvAsInt("CACHE_STREAM_INTERVAL_MS", c.CacheStreamIntervalMs)
+	c.CoalesceEnabled = getEnvAsBool("COALESCE_ENABLED", c.CoalesceEnabled)
+	c.IdempotencyWindow = getEnvAsInt("IDEMPOTENCY_WINDOW", c.IdempotencyWindow)
+	c.ConversationsEnabled = getEnvAsBool("CONVERSATIONS_ENABLED", c.ConversationsEnabled)
+	c.ConversationDir = getEnv("CONVERSATION_DIR", c.ConversationDir)
+	c.ConversationMaxMessages = getEnvAsInt("CONVERSATION_MAX_MESSAGES", c.ConversationMaxMessages)
+	c.AssistantsEnabled = getEnvAsBool("ASSISTANTS_ENABLED", c.AssistantsEnabled)
+	c.AssistantsDBPath = getEnv("ASSISTANTS_DB_PATH", c.AssistantsDBPath)
+	c.BatchEnabled = getEnvAsBool("BATCH_ENABLED", c.BatchEnabled)
+	c.BatchDir = getEnv("BATCH_DIR", c.BatchDir)
+	c.BatchConcurrency = getEnvAsInt("BATCH_CONCURRENCY", c.BatchConcurrency)
+	c.BatchMaxFileSizeMB = getEnvAsInt("BATCH_MAX_FILE_SIZE_MB", c.BatchMaxFileSizeMB)
+	c.BatchMaxRequests = getEnvAsInt("BATCH_MAX_REQUESTS", c.BatchMaxRequests)
+	c.UpstreamMaxConcurrency = getEnvAsInt("UPSTREAM_MAX_CONCURRENCY", c.UpstreamMaxConcurrency)
+	c.QueueMaxWait = getEnvAsInt("QUEUE_MAX_WAIT", c.QueueMaxWait)
+	c.LimiterKeyWeights = getEnv("LIMITER_KEY_WEIGHTS", c.LimiterKeyWeights)
+	c.LimiterKeyPriorities = getEnv("LIMITER_KEY_PRIORITIES", c.LimiterKeyPriorities)
+	c.AdaptiveConcurrency = getEnvAsBool("ADAPTIVE_CONCURRENCY", c.AdaptiveConcurrency)
+	c.AdaptiveMinConcurrency = getEnvAsInt("ADAPTIVE_MIN_CONCURRENCY", c.AdaptiveMinConcurrency)
+	c.AdaptiveMaxConcurrency = getEnvAsInt("ADAPTIVE_MAX_CONCURRENCY", c.AdaptiveMaxConcurrency)
+	c.AdaptiveDecreaseFactor = getEnvAsFloat("ADAPTIVE_DECREASE_FACTOR", c.AdaptiveDecreaseFactor)
+	c.AdaptiveLatencyThresholdMs = getEnvAsInt("ADAPTIVE_LATENCY_THRESHOLD_MS", c.AdaptiveLatencyThresholdMs)
+	c.CassetteMode = getEnv("CASSETTE_MODE", c.CassetteMode)
+	c.CassetteDir = getEnv("CASSETTE_DIR", c.CassetteDir)
+}
+
 // validate 验证配置
 func (c *Config) validate() error {
 	if c.Port <= 0 || c.Port > 65535 {
@@ -106,10 +359,142 @@ func (c *Config) validate() error {
 		return fmt.Errorf("max input length must be positive")
 	}
 
+	if c.UpstreamMaxRetries < 0 {
+		return fmt.Errorf("upstream max retries must not be negative")
+	}
+
+	if c.JSTimeout < 0 || c.JSMaxOldSpaceMB < 0 || c.JSMaxOutputBytes < 0 || c.JSMaxConcurrency < 0 {
+		return fmt.Errorf("js limits must not be negative")
+	}
+
+	if c.AuditSampleRate < 0 || c.AuditSampleRate > 1 {
+		return fmt.Errorf("audit sample rate must be between 0 and 1")
+	}
+
+	if c.CacheTTL < 0 || c.CacheMaxEntries < 0 || c.CacheDiskMaxMB < 0 || c.CacheStreamChunkSize < 0 || c.CacheStreamIntervalMs < 0 {
+		return fmt.Errorf("cache settings must not be negative")
+	}
+
+	if c.IdempotencyWindow < 0 {
+		return fmt.Errorf("idempotency window must not be negative")
+	}
+	if c.ConversationMaxMessages < 0 {
+		return fmt.Errorf("conversation max messages must not be negative")
+	}
+	if c.AssistantsEnabled && c.AssistantsDBPath == "" {
+		return fmt.Errorf("assistants db path must not be empty")
+	}
+	if c.BatchEnabled && (c.BatchDir == "" || c.BatchConcurrency <= 0 || c.BatchMaxFileSizeMB <= 0) {
+		return fmt.Errorf("batch dir, concurrency and max file size must be set when batches are enabled")
+	}
+	if c.BatchMaxRequests < 0 {
+		return fmt.Errorf("batch max requests must not be negative")
+	}
+
+	if c.UpstreamMaxConcurrency < 0 || c.QueueMaxWait < 0 {
+		return fmt.Errorf("upstream concurrency settings must not be negative")
+	}
+	// 回退模型、分流目标和影子模型直接发往上游，必须是 MODELS 中的真实模型
+	configured := splitList(c.Models, ",")
+	for _, chain := range splitList(c.ModelFallbacks, ",") {
+		models := splitList(chain, "->")
+		if len(models) < 2 {
+			return fmt.Errorf("invalid model fallback chain: %s", chain)
+		}
+		for _, fallback := range models[1:] {
+			if !containsString(configured, fallback) {
+				return fmt.Errorf("model fallback %s in chain %s is not listed in MODELS", fallback, chain)
+			}
+		}
+	}
+
+	for name, value := range splitKeyValuesBy(c.ModelSplits, "=") {
+		if !strings.Contains(value, ":") {
+			return fmt.Errorf("invalid model split for %s: %s", name, value)
+		}
+		for _, item := range splitList(value, "|") {
+			idx := strings.LastIndex(item, ":")
+			if weight, err := strconv.Atoi(strings.TrimSpace(item[idx+1:])); idx <= 0 || err != nil || weight <= 0 {
+				return fmt.Errorf("invalid model split for %s: %s", name, item)
+			}
+			if target := strings.TrimSpace(item[:idx]); !containsString(configured, target) {
+				return fmt.Errorf("model split target %s for %s is not listed in MODELS", target, name)
+			}
+		}
+	}
+	for model, shadow := range splitKeyValuesBy(c.ModelShadows, "=") {
+		if shadow == "" {
+			return fmt.Errorf("invalid model shadow for %s", model)
+		}
+		if !containsString(configured, shadow) {
+			return fmt.Errorf("model shadow %s for %s is not listed in MODELS", shadow, model)
+		}
+	}
+	if c.ShadowSampleRate < 0 || c.ShadowSampleRate > 1 {
+		return fmt.Errorf("shadow sample rate must be between 0 and 1")
+	}
+
+	if c.MaxChoices < 0 || c.StructuredOutputMaxAttempts < 0 || c.AutoContinueMax < 0 {
+		return fmt.Errorf("max choices, structured output attempts and auto continue max must not be negative")
+	}
+
+	if c.ImageMaxSizeMB < 0 || c.ImageMaxCount < 0 || c.ImageMaxTotalMB < 0 || c.ImageFetchTimeout < 0 {
+		return fmt.Errorf("image limits must not be negative")
+	}
+	if c.AttachmentContextRatio < 0 || c.AttachmentContextRatio > 1 {
+		return fmt.Errorf("attachment context ratio must be between 0 and 1")
+	}
+	if c.MapReduceEnabled && (c.MapReduceChunkTokens <= 0 || c.MapReduceMaxChunks <= 0 || c.MapReduceConcurrency <= 0) {
+		return fmt.Errorf("map-reduce chunk tokens, max chunks and concurrency must be positive")
+	}
+	// 每块的提取请求必须放得下，否则会被 MAX_INPUT_LENGTH 截断
+	if c.MapReduceEnabled && c.MapReduceChunkTokens*4+MapReducePromptOverhead > c.MaxInputLength {
+		return fmt.Errorf("map-reduce chunk tokens (%d, about %d bytes) plus %d bytes of prompt must fit in max input length %d",
+			c.MapReduceChunkTokens, c.MapReduceChunkTokens*4, MapReducePromptOverhead, c.MaxInputLength)
+	}
+
+	if c.EnsembleMaxModels < 0 {
+		return fmt.Errorf("ensemble max models must not be negative")
+	}
+
+	if c.AdaptiveConcurrency {
+		if c.AdaptiveMinConcurrency < 1 || c.AdaptiveMaxConcurrency < c.AdaptiveMinConcurrency {
+			return fmt.Errorf("adaptive concurrency requires 1 <= min <= max")
+		}
+		if c.AdaptiveDecreaseFactor <= 0 || c.AdaptiveDecreaseFactor >= 1 {
+			return fmt.Errorf("adaptive decrease factor must be between 0 and 1")
+		}
+		if c.AdaptiveLatencyThresholdMs < 0 {
+			return fmt.Errorf("adaptive latency threshold must not be negative")
+		}
+	}
+	for key, value := range splitKeyValues(c.LimiterKeyWeights) {
+		if weight, err := strconv.Atoi(value); err != nil || weight <= 0 {
+			return fmt.Errorf("invalid limiter weight for key %s: %s", maskSecret(key), value)
+		}
+	}
+	for key, value := range splitKeyValues(c.LimiterKeyPriorities) {
+		if !IsValidPriority(value) {
+			return fmt.Errorf("invalid limiter priority for key %s: %s", maskSecret(key), value)
+		}
+	}
+
+	switch c.CassetteMode {
+	case "", CassetteModeRecord, CassetteModeReplay:
+	default:
+		return fmt.Errorf("invalid cassette mode: %s", c.CassetteMode)
+	}
+
+	for _, pattern := range c.GetAuditRedactPatterns() {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid audit redact pattern %q: %w", pattern, err)
+		}
+	}
+
 	return nil
 }
 
-// GetModels 获取模型列表
+// GetModels 获取模型列表（包含 MODEL_SPLITS 定义的虚拟模型）
 func (c *Config) GetModels() []string {
 	models := strings.Split(c.Models, ",")
 	result := make([]string, 0, len(models))
@@ -118,9 +503,71 @@ func (c *Config) GetModels() []string {
 			result = append(result, trimmed)
 		}
 	}
+	for _, item := range splitList(c.ModelSplits, ",") {
+		name := strings.TrimSpace(strings.SplitN(item, "=", 2)[0])
+		if name != "" && !containsString(result, name) {
+			result = append(result, name)
+		}
+	}
 	return result
 }
 
+// GetEnsembleModels 获取集成请求未指定模型时使用的默认模型列表
+func (c *Config) GetEnsembleModels() []string {
+	return splitList(c.EnsembleModels, ",")
+}
+
+// GetImageAllowedTypes 获取允许的图片媒体类型
+func (c *Config) GetImageAllowedTypes() []string {
+	return splitList(strings.ToLower(c.ImageAllowedTypes), ",")
+}
+
+// ModelWeight 虚拟模型中一个真实模型及其流量权重
+type ModelWeight struct {
+	Model  string
+	Weight int
+}
+
+// GetModelSplit 获取虚拟模型的流量分配，不是虚拟模型时返回 nil
+// 格式：MODEL_SPLITS=virtual-name=model-a:90|model-b:10
+func (c *Config) GetModelSplit(name string) []ModelWeight {
+	value, ok := splitKeyValuesBy(c.ModelSplits, "=")[name]
+	if !ok {
+		return nil
+	}
+	var split []ModelWeight
+	for _, item := range splitList(value, "|") {
+		idx := strings.LastIndex(item, ":")
+		if idx <= 0 {
+			continue
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(item[idx+1:]))
+		if err != nil || weight <= 0 {
+			continue
+		}
+		split = append(split, ModelWeight{Model: strings.TrimSpace(item[:idx]), Weight: weight})
+	}
+	return split
+}
+
+// GetShadowModel 获取模型的影子模型（请求副本在后台发往该模型用于对比），未配置时返回空
+// 格式：MODEL_SHADOWS=model-a=model-b
+func (c *Config) GetShadowModel(model string) string {
+	return splitKeyValuesBy(c.ModelShadows, "=")[model]
+}
+
+// GetModelFallbacks 获取配置中为模型定义的回退链（不含模型本身），未配置时返回 nil
+// 格式：MODEL_FALLBACKS=model-a->model-b->model-c,model-d->model-e
+func (c *Config) GetModelFallbacks(model string) []string {
+	for _, chain := range splitList(c.ModelFallbacks, ",") {
+		models := splitList(chain, "->")
+		if len(models) > 1 && models[0] == model {
+			return models[1:]
+		}
+	}
+	return nil
+}
+
 // IsValidModel 检查模型是否有效
 func (c *Config) IsValidModel(model string) bool {
 	validModels := c.GetModels()
@@ -132,11 +579,105 @@ func (c *Config) IsValidModel(model string) bool {
 	return false
 }
 
-// ToJSON 将配置序列化为JSON（用于调试）
+// GetAPIKeys 获取所有有效的 API 密钥（API_KEY 和 API_KEYS）
+func (c *Config) GetAPIKeys() []string {
+	keys := splitList(c.APIKeys, ",")
+	if c.APIKey != "" && !containsString(keys, c.APIKey) {
+		keys = append([]string{c.APIKey}, keys...)
+	}
+	return keys
+}
+
+// IsValidAPIKey 检查 API 密钥是否有效（API_KEY 或 API_KEYS 中的任意一个）
+func (c *Config) IsValidAPIKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	if key == c.APIKey {
+		return true
+	}
+	for _, k := range splitList(c.APIKeys, ",") {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAuditRedactRules 获取启用的内置脱敏规则名称
+func (c *Config) GetAuditRedactRules() []string {
+	return splitList(c.AuditRedactRules, ",")
+}
+
+// GetAuditRedactPatterns 获取自定义脱敏正则，多个正则之间用 ";;" 分隔（正则本身可能包含逗号）
+func (c *Config) GetAuditRedactPatterns() []string {
+	return splitList(c.AuditRedactPatterns, ";;")
+}
+
+// IsAuditOptOut 检查指定 API 密钥是否选择不记录审计日志
+func (c *Config) IsAuditOptOut(apiKey string) bool {
+	for _, key := range splitList(c.AuditOptOutKeys, ",") {
+		if key == apiKey {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCacheEnabledForKey 检查指定 API 密钥是否使用响应缓存（CACHE_KEYS 为空时对所有密钥启用）
+func (c *Config) IsCacheEnabledForKey(apiKey string) bool {
+	if !c.CacheEnabled {
+		return false
+	}
+	keys := splitList(c.CacheKeys, ",")
+	if len(keys) == 0 {
+		return true
+	}
+	for _, key := range keys {
+		if key == apiKey {
+			return true
+		}
+	}
+	return false
+}
+
+// 排队优先级
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// IsValidPriority 检查优先级名称是否有效
+func IsValidPriority(priority string) bool {
+	switch priority {
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// GetLimiterKeyWeight 获取 API 密钥在公平排队中的权重（未配置时为 1）
+func (c *Config) GetLimiterKeyWeight(apiKey string) int {
+	if weight, err := strconv.Atoi(splitKeyValues(c.LimiterKeyWeights)[apiKey]); err == nil && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// GetLimiterKeyPriority 获取 API 密钥的优先级（未配置时为 normal）
+func (c *Config) GetLimiterKeyPriority(apiKey string) string {
+	if priority := splitKeyValues(c.LimiterKeyPriorities)[apiKey]; IsValidPriority(priority) {
+		return priority
+	}
+	return PriorityNormal
+}
+
+// ToJSON 将配置序列化为JSON（用于调试），标记 secret:"true" 的字段掩码
 func (c *Config) ToJSON() string {
 	// 创建一个副本，隐藏敏感信息
 	safeCfg := *c
-	safeCfg.APIKey = "***"
+	maskSecretFields(reflect.ValueOf(&safeCfg).Elem())
 
 	data, err := json.MarshalIndent(safeCfg, "", "  ")
 	if err != nil {
@@ -145,11 +686,99 @@ func (c *Config) ToJSON() string {
 	return string(data)
 }
 
+// maskSecretFields 把标记 secret:"true" 的非空字符串字段替换为 ***
+func maskSecretFields(v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			maskSecretFields(v.Field(i))
+		case field.Tag.Get("secret") == "true" && field.Type.Kind() == reflect.String && v.Field(i).String() != "":
+			v.Field(i).SetString("***")
+		}
+	}
+}
+
 // 辅助函数
 
+// splitList 按分隔符拆分列表并去除空白项
+func splitList(value, sep string) []string {
+	parts := strings.Split(value, sep)
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// splitKeyValues 解析 "key:value,key:value" 形式的列表（值中不含冒号，按最后一个冒号切分）
+func splitKeyValues(value string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range splitList(value, ",") {
+		idx := strings.LastIndex(item, ":")
+		if idx <= 0 {
+			result[item] = ""
+			continue
+		}
+		result[strings.TrimSpace(item[:idx])] = strings.TrimSpace(item[idx+1:])
+	}
+	return result
+}
+
+// splitKeyValuesBy 解析 "key=value,key=value" 形式的列表，按第一个分隔符切分
+func splitKeyValuesBy(value, sep string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range splitList(value, ",") {
+		parts := strings.SplitN(item, sep, 2)
+		key := strings.TrimSpace(parts[0])
+		if len(parts) < 2 {
+			result[key] = ""
+			continue
+		}
+		result[key] = strings.TrimSpace(parts[1])
+	}
+	return result
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// maskSecret 遮蔽密钥，仅保留前 4 位
+func maskSecret(secret string) string {
+	if len(secret) <= 4 {
+		return "****"
+	}
+	return secret[:4] + "****"
+}
+
+// lookupEnv 获取环境变量；未设置时尝试读取 KEY_FILE 指向的文件（用于 Docker/K8s secrets）
+func lookupEnv(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	if path := os.Getenv(key + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logrus.Warnf("Failed to read %s_FILE %s: %v", key, path, err)
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	return ""
+}
+
 // getEnv 获取环境变量，如果不存在则返回默认值
 func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
@@ -157,7 +786,7 @@ func getEnv(key, defaultValue string) string {
 
 // getEnvAsInt 获取环境变量并转换为int
 func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := os.Getenv(key)
+	valueStr := lookupEnv(key)
 	if valueStr == "" {
 		return defaultValue
 	}
@@ -171,9 +800,25 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+// getEnvAsFloat 获取环境变量并转换为float64
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := lookupEnv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		logrus.Warnf("Invalid float value for %s: %s, using default: %g", key, valueStr, defaultValue)
+		return defaultValue
+	}
+
+	return value
+}
+
 // getEnvAsBool 获取环境变量并转换为bool
 func getEnvAsBool(key string, defaultValue bool) bool {
-	valueStr := os.Getenv(key)
+	valueStr := lookupEnv(key)
 	if valueStr == "" {
 		return defaultValue
 	}
@@ -22,6 +22,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -130,60 +131,120 @@ func TestValidate(t *testing.T) {
 		{
 			name: "valid config",
 			config: &Config{
-				Port:            8000,
-				APIKey:          "test-key",
-				Timeout:         30,
-				MaxInputLength:  1000,
+				Port:           8000,
+				APIKey:         "test-key",
+				Timeout:        30,
+				MaxInputLength: 1000,
 			},
 			wantErr: false,
 		},
 		{
 			name: "invalid port - too low",
 			config: &Config{
-				Port:            0,
-				APIKey:          "test-key",
-				Timeout:         30,
-				MaxInputLength:  1000,
+				Port:           0,
+				APIKey:         "test-key",
+				Timeout:        30,
+				MaxInputLength: 1000,
 			},
 			wantErr: true,
 		},
 		{
 			name: "invalid port - too high",
 			config: &Config{
-				Port:            70000,
-				APIKey:          "test-key",
-				Timeout:         30,
-				MaxInputLength:  1000,
+				Port:           70000,
+				APIKey:         "test-key",
+				Timeout:        30,
+				MaxInputLength: 1000,
 			},
 			wantErr: true,
 		},
 		{
 			name: "missing API key",
 			config: &Config{
-				Port:            8000,
-				APIKey:          "",
-				Timeout:         30,
-				MaxInputLength:  1000,
+				Port:           8000,
+				APIKey:         "",
+				Timeout:        30,
+				MaxInputLength: 1000,
 			},
 			wantErr: true,
 		},
 		{
 			name: "invalid timeout",
 			config: &Config{
-				Port:            8000,
-				APIKey:          "test-key",
-				Timeout:         0,
-				MaxInputLength:  1000,
+				Port:           8000,
+				APIKey:         "test-key",
+				Timeout:        0,
+				MaxInputLength: 1000,
 			},
 			wantErr: true,
 		},
 		{
 			name: "invalid max input length",
 			config: &Config{
-				Port:            8000,
-				APIKey:          "test-key",
-				Timeout:         30,
-				MaxInputLength:  0,
+				Port:           8000,
+				APIKey:         "test-key",
+				Timeout:        30,
+				MaxInputLength: 0,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid limiter weight",
+			config: &Config{
+				Port:              8000,
+				APIKey:            "test-key",
+				Timeout:           30,
+				MaxInputLength:    1000,
+				LimiterKeyWeights: "key-a:0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid limiter priority",
+			config: &Config{
+				Port:                 8000,
+				APIKey:               "test-key",
+				Timeout:              30,
+				MaxInputLength:       1000,
+				LimiterKeyPriorities: "key-a:urgent",
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid model fallback",
+			config: &Config{
+				Port:           8000,
+				APIKey:         "test-key",
+				Timeout:        30,
+				MaxInputLength: 1000,
+				Models:         "model-a,model-b",
+				ModelFallbacks: "model-a->model-b",
+			},
+			wantErr: false,
+		},
+		{
+			name: "map-reduce chunk does not fit max input length",
+			config: &Config{
+				Port:                 8000,
+				APIKey:               "test-key",
+				Timeout:              30,
+				MaxInputLength:       10000,
+				MapReduceEnabled:     true,
+				MapReduceChunkTokens: 2000,
+				MapReduceMaxChunks:   4,
+				MapReduceConcurrency: 1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown model fallback",
+			config: &Config{
+				Port:           8000,
+				APIKey:         "test-key",
+				Timeout:        30,
+				MaxInputLength: 1000,
+				Models:         "model-a",
+				ModelFallbacks: "model-a->model-typo",
 			},
 			wantErr: true,
 		},
@@ -197,4 +258,70 @@ func TestValidate(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestLimiterKeySettings(t *testing.T) {
+	cfg := &Config{
+		LimiterKeyWeights:    "sk-a:3, sk-b:1",
+		LimiterKeyPriorities: "sk-a:high",
+	}
+
+	if got := cfg.GetLimiterKeyWeight("sk-a"); got != 3 {
+		t.Errorf("GetLimiterKeyWeight(sk-a) = %d, want 3", got)
+	}
+	if got := cfg.GetLimiterKeyWeight("unknown"); got != 1 {
+		t.Errorf("GetLimiterKeyWeight(unknown) = %d, want 1", got)
+	}
+	if got := cfg.GetLimiterKeyPriority("sk-a"); got != PriorityHigh {
+		t.Errorf("GetLimiterKeyPriority(sk-a) = %s, want %s", got, PriorityHigh)
+	}
+	if got := cfg.GetLimiterKeyPriority("sk-b"); got != PriorityNormal {
+		t.Errorf("GetLimiterKeyPriority(sk-b) = %s, want %s", got, PriorityNormal)
+	}
+}
+
+func TestModelRouting(t *testing.T) {
+	cfg := &Config{
+		Models:       "model-a",
+		ModelSplits:  "canary=model-a:90|model-b:10",
+		ModelShadows: "model-a=model-c",
+	}
+
+	if err := (&Config{Port: 8000, APIKey: "k", Timeout: 30, MaxInputLength: 1000, ModelSplits: "canary=model-a:0"}).validate(); err == nil {
+		t.Error("validate() should reject non-positive split weights")
+	}
+	if err := (&Config{Port: 8000, APIKey: "k", Timeout: 30, MaxInputLength: 1000, Models: "model-a", ModelSplits: "canary=model-a:90|model-b:10"}).validate(); err == nil {
+		t.Error("validate() should reject split targets missing from MODELS")
+	}
+	if err := (&Config{Port: 8000, APIKey: "k", Timeout: 30, MaxInputLength: 1000, Models: "model-a", ModelShadows: "model-a=model-c"}).validate(); err == nil {
+		t.Error("validate() should reject shadow models missing from MODELS")
+	}
+	if err := (&Config{Port: 8000, APIKey: "k", Timeout: 30, MaxInputLength: 1000, Models: "model-a,model-b,model-c", ModelSplits: "canary=model-a:90|model-b:10", ModelShadows: "model-a=model-c"}).validate(); err != nil {
+		t.Errorf("validate() error = %v", err)
+	}
+	if !cfg.IsValidModel("canary") {
+		t.Error("virtual model should be valid")
+	}
+	split := cfg.GetModelSplit("canary")
+	if len(split) != 2 || split[0] != (ModelWeight{Model: "model-a", Weight: 90}) || split[1] != (ModelWeight{Model: "model-b", Weight: 10}) {
+		t.Errorf("GetModelSplit(canary) = %v", split)
+	}
+	if cfg.GetModelSplit("model-a") != nil {
+		t.Error("real model should not have a split")
+	}
+	if got := cfg.GetShadowModel("model-a"); got != "model-c" {
+		t.Errorf("GetShadowModel(model-a) = %s, want model-c", got)
+	}
+}
+
+func TestToJSONMasksSecrets(t *testing.T) {
+	cfg := &Config{APIKey: "key-a", AdminAPIKey: "admin-key", CacheKeys: "key-b", Models: "model-a"}
+	output := cfg.ToJSON()
+	for _, secret := range []string{"key-a", "admin-key", "key-b"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("ToJSON() leaks %s: %s", secret, output)
+		}
+	}
+	if !strings.Contains(output, "model-a") {
+		t.Errorf("ToJSON() should keep non-secret fields: %s", output)
+	}
+}
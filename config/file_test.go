@@ -0,0 +1,138 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigFromFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "yaml",
+			file: "config.yaml",
+			content: `port: 9100
+api_key: file-key
+api_keys: [extra-1, extra-2]
+models:
+  - claude-sonnet-4.6
+  - gpt-4o
+timeout: 30
+fp:
+  userAgent: File Agent
+`,
+		},
+		{
+			name: "toml",
+			file: "config.toml",
+			content: `port = 9100
+api_key = "file-key"
+api_keys = ["extra-1", "extra-2"]
+models = ["claude-sonnet-4.6", "gpt-4o"]
+timeout = 30
+
+[fp]
+userAgent = "File Agent"
+`,
+		},
+	}
+
+	// 其他测试可能通过 .env 设置了这些变量
+	for _, key := range []string{"PORT", "API_KEY", "API_KEYS", "MODELS", "TIMEOUT", "USER_AGENT", "MAX_INPUT_LENGTH"} {
+		t.Setenv(key, "")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("write config file: %v", err)
+			}
+
+			config, err := LoadConfigFrom(path)
+			if err != nil {
+				t.Fatalf("LoadConfigFrom() error = %v", err)
+			}
+			if config.Port != 9100 {
+				t.Errorf("Port = %v, want 9100", config.Port)
+			}
+			if config.Models != "claude-sonnet-4.6,gpt-4o" {
+				t.Errorf("Models = %v, want claude-sonnet-4.6,gpt-4o", config.Models)
+			}
+			if !config.IsValidAPIKey("extra-2") || !config.IsValidAPIKey("file-key") {
+				t.Errorf("IsValidAPIKey() rejected a configured key")
+			}
+			if config.FP.UserAgent != "File Agent" {
+				t.Errorf("UserAgent = %v, want File Agent", config.FP.UserAgent)
+			}
+			// 文件中未出现的字段保留默认值
+			if config.MaxInputLength != 200000 {
+				t.Errorf("MaxInputLength = %v, want default 200000", config.MaxInputLength)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFromFileEnvOverlay(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("port: 9100\napi_key: file-key\n"), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	secretPath := filepath.Join(dir, "api_key")
+	if err := os.WriteFile(secretPath, []byte("secret-from-file\n"), 0600); err != nil {
+		t.Fatalf("write secret file: %v", err)
+	}
+
+	t.Setenv("PORT", "9200")
+	t.Setenv("API_KEY", "")
+	t.Setenv("API_KEY_FILE", secretPath)
+
+	config, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() error = %v", err)
+	}
+	if config.Port != 9200 {
+		t.Errorf("Port = %v, want env override 9200", config.Port)
+	}
+	if config.APIKey != "secret-from-file" {
+		t.Errorf("APIKey = %v, want secret-from-file", config.APIKey)
+	}
+}
+
+func TestLoadConfigFromFileUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("port: 9100\nunknown_field: 1\n"), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+
+	if _, err := LoadConfigFrom(path); err == nil {
+		t.Error("LoadConfigFrom() expected error for unknown field")
+	}
+}
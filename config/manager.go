@@ -0,0 +1,264 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+)
+
+// ReloadHook 配置切换时的回调，返回错误会导致本次重载回滚
+type ReloadHook func(old, new *Config) error
+
+// Change 一项配置变更
+type Change struct {
+	Field           string `json:"field"`
+	Old             string `json:"old"`
+	New             string `json:"new"`
+	RestartRequired bool   `json:"restart_required"`
+}
+
+// String 返回便于日志输出的变更描述
+func (c Change) String() string {
+	if c.RestartRequired {
+		return fmt.Sprintf("%s: %s -> %s (requires restart)", c.Field, c.Old, c.New)
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Manager 持有当前生效的配置，支持原子替换和热重载
+type Manager struct {
+	current atomic.Pointer[Config]
+	path    string
+
+	mu      sync.Mutex
+	hooks   []ReloadHook
+	modTime time.Time
+}
+
+// NewManager 创建配置管理器，path 为配置文件路径（可为空）
+func NewManager(cfg *Config, path string) *Manager {
+	m := &Manager{path: path}
+	m.current.Store(cfg)
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			m.modTime = info.ModTime()
+		}
+	}
+	return m
+}
+
+// Get 返回当前生效的配置，调用方不应修改返回值
+func (m *Manager) Get() *Config {
+	return m.current.Load()
+}
+
+// OnReload 注册配置切换回调
+func (m *Manager) OnReload(hook ReloadHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// Reload 重新读取 .env、配置文件和环境变量并原子替换当前配置
+// 校验失败或回调出错时保留旧配置；需要重启才能生效的字段保持旧值，只在返回的变更中标记
+func (m *Manager) Reload() ([]Change, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_ = reloadDotEnv()
+	next, err := LoadConfigFrom(m.path)
+	if err != nil {
+		return nil, err
+	}
+
+	old := m.Get()
+	changes := Diff(old, next)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	keepRestartFields(reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem())
+
+	m.current.Store(next)
+	for i, hook := range m.hooks {
+		if err := hook(old, next); err != nil {
+			// 回滚：恢复旧配置并让已执行的回调切回旧配置
+			m.current.Store(old)
+			for j := i - 1; j >= 0; j-- {
+				if undoErr := m.hooks[j](next, old); undoErr != nil {
+					logrus.WithError(undoErr).Error("Failed to roll back config reload hook")
+				}
+			}
+			return nil, fmt.Errorf("failed to apply config: %w", err)
+		}
+	}
+
+	return changes, nil
+}
+
+// ReloadAndLog 执行重载并记录结果
+func (m *Manager) ReloadAndLog(reason string) {
+	changes, err := m.Reload()
+	if err != nil {
+		logrus.WithError(err).Errorf("Config reload (%s) failed, keeping previous config", reason)
+		return
+	}
+	if len(changes) == 0 {
+		logrus.Infof("Config reload (%s): no changes", reason)
+		return
+	}
+	for _, change := range changes {
+		if change.RestartRequired {
+			logrus.Warnf("Config reload (%s): %s", reason, change)
+		} else {
+			logrus.Infof("Config reload (%s): %s", reason, change)
+		}
+	}
+}
+
+// Watch 轮询配置文件修改时间，文件变化时自动重载，直到 ctx 结束
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	if m.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(m.path)
+			if err != nil {
+				continue
+			}
+			m.mu.Lock()
+			changed := !info.ModTime().Equal(m.modTime)
+			m.modTime = info.ModTime()
+			m.mu.Unlock()
+			if changed {
+				m.ReloadAndLog("file changed")
+			}
+		}
+	}
+}
+
+// Diff 比较两份配置，返回发生变化的字段（敏感字段的值会被掩码）
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffStruct("", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), &changes)
+	return changes
+}
+
+func diffStruct(prefix string, oldVal, newVal reflect.Value, changes *[]Change) {
+	t := oldVal.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if field.Type.Kind() == reflect.Struct {
+			diffStruct(name+".", oldVal.Field(i), newVal.Field(i), changes)
+			continue
+		}
+
+		oldField := fmt.Sprint(oldVal.Field(i).Interface())
+		newField := fmt.Sprint(newVal.Field(i).Interface())
+		if oldField == newField {
+			continue
+		}
+		if field.Tag.Get("secret") == "true" {
+			oldField, newField = "***", "***"
+		}
+		*changes = append(*changes, Change{
+			Field:           name,
+			Old:             oldField,
+			New:             newField,
+			RestartRequired: field.Tag.Get("reload") == "restart",
+		})
+	}
+}
+
+// keepRestartFields 把需要重启才能生效的字段从旧配置复制到新配置
+func keepRestartFields(oldVal, newVal reflect.Value) {
+	t := oldVal.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			keepRestartFields(oldVal.Field(i), newVal.Field(i))
+			continue
+		}
+		if field.Tag.Get("reload") == "restart" {
+			newVal.Field(i).Set(oldVal.Field(i))
+		}
+	}
+}
+
+var (
+	// processEnvKeys 启动时进程自带的环境变量，.env 不会覆盖它们
+	processEnvKeys map[string]bool
+	// dotEnvKeys 上一次从 .env 加载的变量
+	dotEnvKeys map[string]bool
+)
+
+// snapshotProcessEnv 记录进程自带的环境变量，应在加载 .env 之前调用
+func snapshotProcessEnv() {
+	if processEnvKeys != nil {
+		return
+	}
+	processEnvKeys = make(map[string]bool)
+	for _, kv := range os.Environ() {
+		processEnvKeys[strings.SplitN(kv, "=", 2)[0]] = true
+	}
+}
+
+// reloadDotEnv 读取 .env 并设置其中未被进程环境覆盖的变量，热重载时也能感知 .env 的修改
+func reloadDotEnv() error {
+	values, err := godotenv.Read()
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]bool, len(values))
+	for key, value := range values {
+		if processEnvKeys[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		loaded[key] = true
+	}
+	for key := range dotEnvKeys {
+		if !loaded[key] {
+			os.Unsetenv(key)
+		}
+	}
+	dotEnvKeys = loaded
+	return nil
+}
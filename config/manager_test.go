@@ -0,0 +1,126 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	for _, key := range []string{"PORT", "API_KEY", "MODELS", "SYSTEM_PROMPT_INJECT", "MAX_INPUT_LENGTH"} {
+		t.Setenv(key, "")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, path, "port: 9100\nsystem_prompt_inject: old\nmax_input_length: 1000\n")
+
+	cfg, err := LoadConfigFrom(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFrom() error = %v", err)
+	}
+	manager := NewManager(cfg, path)
+
+	t.Run("applies live fields and keeps restart fields", func(t *testing.T) {
+		writeTestConfig(t, path, "port: 9200\nsystem_prompt_inject: new\nmax_input_length: 1000\n")
+
+		changes, err := manager.Reload()
+		if err != nil {
+			t.Fatalf("Reload() error = %v", err)
+		}
+		if len(changes) != 2 {
+			t.Fatalf("Reload() changes = %v, want 2", changes)
+		}
+		for _, change := range changes {
+			if change.Field == "port" && !change.RestartRequired {
+				t.Errorf("port change should require restart")
+			}
+		}
+		if got := manager.Get().SystemPromptInject; got != "new" {
+			t.Errorf("SystemPromptInject = %q, want new", got)
+		}
+		if got := manager.Get().Port; got != 9100 {
+			t.Errorf("Port = %d, want 9100 until restart", got)
+		}
+	})
+
+	t.Run("invalid config is rejected", func(t *testing.T) {
+		before := manager.Get()
+		writeTestConfig(t, path, "port: 9200\nsystem_prompt_inject: broken\nmax_input_length: -1\n")
+
+		if _, err := manager.Reload(); err == nil {
+			t.Fatal("Reload() expected validation error")
+		}
+		if manager.Get() != before {
+			t.Error("config should not change after failed reload")
+		}
+	})
+
+	t.Run("hook error rolls back", func(t *testing.T) {
+		before := manager.Get()
+		var applied []string
+		manager.OnReload(func(old, new *Config) error {
+			applied = append(applied, new.SystemPromptInject)
+			return nil
+		})
+		manager.OnReload(func(old, new *Config) error {
+			if new.SystemPromptInject == "rejected" {
+				return errors.New("cannot apply")
+			}
+			return nil
+		})
+		writeTestConfig(t, path, "port: 9200\nsystem_prompt_inject: rejected\nmax_input_length: 1000\n")
+
+		if _, err := manager.Reload(); err == nil {
+			t.Fatal("Reload() expected hook error")
+		}
+		if manager.Get() != before {
+			t.Error("config should be rolled back after hook error")
+		}
+		if len(applied) != 2 || applied[1] != before.SystemPromptInject {
+			t.Errorf("hooks applied = %v, want first hook undone", applied)
+		}
+	})
+}
+
+func TestDiffMasksSecrets(t *testing.T) {
+	old := &Config{APIKey: "old-key", Models: "a"}
+	new := &Config{APIKey: "new-key", Models: "a,b"}
+
+	changes := Diff(old, new)
+	if len(changes) != 2 {
+		t.Fatalf("Diff() = %v, want 2 changes", changes)
+	}
+	for _, change := range changes {
+		if change.Field == "api_key" && (change.Old != "***" || change.New != "***") {
+			t.Errorf("api_key change not masked: %v", change)
+		}
+	}
+}
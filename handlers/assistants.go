@@ -0,0 +1,380 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package handlers
+
+import (
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"cursor2api-go/services"
+	"cursor2api-go/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxAssistantListLimit 列表接口单次返回的最大数量
+const maxAssistantListLimit = 100
+
+// CreateAssistant 创建助手
+func (h *Handler) CreateAssistant(c *gin.Context) {
+	var request models.AssistantRequest
+	if !h.assistantsEnabled(c) || !bindJSON(c, &request) {
+		return
+	}
+	assistant, err := h.assistants.CreateAssistant(middleware.APIKeyFromContext(c.Request.Context()), &request)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, assistant)
+}
+
+// ListAssistants 列出调用方的助手
+func (h *Handler) ListAssistants(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	opts, ok := listOptions(c)
+	if !ok {
+		return
+	}
+	assistants, more, err := h.assistants.ListAssistants(middleware.APIKeyFromContext(c.Request.Context()), opts)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	writeList(c, assistants, more, func(a *models.Assistant) string { return a.ID })
+}
+
+// GetAssistant 获取助手
+func (h *Handler) GetAssistant(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	assistant, err := h.assistants.GetAssistant(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, assistant)
+}
+
+// UpdateAssistant 修改助手
+func (h *Handler) UpdateAssistant(c *gin.Context) {
+	var request models.AssistantRequest
+	if !h.assistantsEnabled(c) || !bindJSON(c, &request) {
+		return
+	}
+	assistant, err := h.assistants.UpdateAssistant(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), &request)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, assistant)
+}
+
+// DeleteAssistant 删除助手
+func (h *Handler) DeleteAssistant(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	id := c.Param("id")
+	if err := h.assistants.DeleteAssistant(middleware.APIKeyFromContext(c.Request.Context()), id); err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "assistant.deleted",
+		"deleted": true,
+	})
+}
+
+// CreateThread 创建线程
+func (h *Handler) CreateThread(c *gin.Context) {
+	var request models.ThreadRequest
+	if !h.assistantsEnabled(c) || !bindJSON(c, &request) {
+		return
+	}
+	thread, err := h.assistants.CreateThread(middleware.APIKeyFromContext(c.Request.Context()), &request)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
+// GetThread 获取线程
+func (h *Handler) GetThread(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	thread, err := h.assistants.GetThread(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
+// UpdateThread 修改线程元数据
+func (h *Handler) UpdateThread(c *gin.Context) {
+	var request models.ThreadRequest
+	if !h.assistantsEnabled(c) || !bindJSON(c, &request) {
+		return
+	}
+	thread, err := h.assistants.UpdateThread(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), &request)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, thread)
+}
+
+// DeleteThread 删除线程及其消息和运行
+func (h *Handler) DeleteThread(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	id := c.Param("id")
+	if err := h.assistants.DeleteThread(middleware.APIKeyFromContext(c.Request.Context()), id); err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "thread.deleted",
+		"deleted": true,
+	})
+}
+
+// CreateThreadMessage 向线程添加消息
+func (h *Handler) CreateThreadMessage(c *gin.Context) {
+	var request models.ThreadMessageRequest
+	if !h.assistantsEnabled(c) || !bindJSON(c, &request) {
+		return
+	}
+	message, err := h.assistants.CreateMessage(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), &request)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+// ListThreadMessages 列出线程中的消息
+func (h *Handler) ListThreadMessages(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	opts, ok := listOptions(c)
+	if !ok {
+		return
+	}
+	messages, more, err := h.assistants.ListMessages(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), opts)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	writeList(c, messages, more, func(m *models.ThreadMessage) string { return m.ID })
+}
+
+// GetThreadMessage 获取线程中的消息
+func (h *Handler) GetThreadMessage(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	message, err := h.assistants.GetMessage(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), c.Param("message_id"))
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, message)
+}
+
+// CreateRun 在线程上创建运行；stream 为 true 时以 SSE 推送运行事件，否则立即返回 queued 状态的运行
+func (h *Handler) CreateRun(c *gin.Context) {
+	var request models.RunRequest
+	if !h.assistantsEnabled(c) || !bindJSON(c, &request) {
+		return
+	}
+	run, events, err := h.assistants.CreateRun(c.Request.Context(), middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), &request)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	if events == nil {
+		c.JSON(http.StatusOK, run)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	for event := range events {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to marshal run event")
+			continue
+		}
+		if err := utils.WriteSSEEvent(c.Writer, event.Event, string(data)); err != nil {
+			return
+		}
+	}
+	if c.Request.Context().Err() == nil {
+		_ = utils.WriteSSEEvent(c.Writer, "done", "[DONE]")
+	}
+}
+
+// ListRuns 列出线程上的运行
+func (h *Handler) ListRuns(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	opts, ok := listOptions(c)
+	if !ok {
+		return
+	}
+	runs, more, err := h.assistants.ListRuns(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), opts)
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	writeList(c, runs, more, func(r *models.Run) string { return r.ID })
+}
+
+// GetRun 获取运行，用于轮询状态
+func (h *Handler) GetRun(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	run, err := h.assistants.GetRun(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), c.Param("run_id"))
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// CancelRun 取消运行
+func (h *Handler) CancelRun(c *gin.Context) {
+	if !h.assistantsEnabled(c) {
+		return
+	}
+	run, err := h.assistants.CancelRun(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), c.Param("run_id"))
+	if err != nil {
+		h.assistantError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// listOptions 解析列表接口的 limit、order 和 after 参数，不合法时直接返回错误
+func listOptions(c *gin.Context) (services.ListOptions, bool) {
+	opts := services.ListOptions{Limit: 20, Desc: true, After: c.Query("after")}
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxAssistantListLimit {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				fmt.Sprintf("limit must be between 1 and %d", maxAssistantListLimit),
+				"invalid_request_error",
+				"invalid_limit",
+			))
+			return opts, false
+		}
+		opts.Limit = parsed
+	}
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "desc":
+	case "asc":
+		opts.Desc = false
+	default:
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			"order must be asc or desc",
+			"invalid_request_error",
+			"invalid_order",
+		))
+		return opts, false
+	}
+	return opts, true
+}
+
+// writeList 以 OpenAI 分页列表格式返回对象
+func writeList[T any](c *gin.Context, items []T, more bool, id func(T) string) {
+	if items == nil {
+		items = []T{}
+	}
+	response := gin.H{
+		"object":   "list",
+		"data":     items,
+		"first_id": nil,
+		"last_id":  nil,
+		"has_more": more,
+	}
+	if len(items) > 0 {
+		response["first_id"] = id(items[0])
+		response["last_id"] = id(items[len(items)-1])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// assistantsEnabled 检查是否启用了 Assistants API，未启用时直接返回错误
+func (h *Handler) assistantsEnabled(c *gin.Context) bool {
+	if h.assistants != nil {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+		"Assistants API is not enabled",
+		"invalid_request_error",
+		"assistants_disabled",
+	))
+	return false
+}
+
+// assistantError 返回 Assistants 操作的错误
+func (h *Handler) assistantError(c *gin.Context, err error) {
+	for _, notFound := range []error{services.ErrAssistantNotFound, services.ErrThreadNotFound, services.ErrMessageNotFound, services.ErrRunNotFound} {
+		if errors.Is(err, notFound) {
+			c.JSON(http.StatusNotFound, models.NewErrorResponse(
+				notFound.Error(),
+				"invalid_request_error",
+				"not_found",
+			))
+			return
+		}
+	}
+	switch {
+	case errors.Is(err, services.ErrRunActive):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(err.Error(), "invalid_request_error", "run_active"))
+	case errors.Is(err, services.ErrRunNotCancellable):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(err.Error(), "invalid_request_error", "run_not_cancellable"))
+	default:
+		logrus.WithError(err).Error("Assistants operation failed")
+		middleware.HandleError(c, err)
+	}
+}
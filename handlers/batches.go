@@ -0,0 +1,216 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package handlers
+
+import (
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"cursor2api-go/services"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// UploadFile 上传批处理输入文件（multipart 表单字段 file 和 purpose）
+func (h *Handler) UploadFile(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	if purpose := c.PostForm("purpose"); purpose != "batch" {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			"purpose must be batch",
+			"invalid_request_error",
+			"invalid_purpose",
+		))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			"file is required",
+			"invalid_request_error",
+			"missing_file",
+		))
+		return
+	}
+	content, err := header.Open()
+	if err != nil {
+		middleware.HandleError(c, err)
+		return
+	}
+	defer content.Close()
+
+	file, err := h.files.Create(middleware.APIKeyFromContext(c.Request.Context()), header.Filename, "batch", content)
+	if err != nil {
+		h.batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// ListFiles 列出调用方的文件，可按 purpose 过滤
+func (h *Handler) ListFiles(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	files := h.files.List(middleware.APIKeyFromContext(c.Request.Context()), c.Query("purpose"))
+	writeList(c, files, false, func(f *models.File) string { return f.ID })
+}
+
+// GetFile 获取文件元数据
+func (h *Handler) GetFile(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	file, err := h.files.Get(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, file)
+}
+
+// GetFileContent 下载文件内容
+func (h *Handler) GetFileContent(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	content, err := h.files.Open(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.batchError(c, err)
+		return
+	}
+	defer content.Close()
+	info, err := content.Stat()
+	if err != nil {
+		middleware.HandleError(c, err)
+		return
+	}
+	c.DataFromReader(http.StatusOK, info.Size(), "application/jsonl", content, nil)
+}
+
+// DeleteFile 删除文件
+func (h *Handler) DeleteFile(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	id := c.Param("id")
+	if err := h.files.Delete(middleware.APIKeyFromContext(c.Request.Context()), id); err != nil {
+		h.batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "file",
+		"deleted": true,
+	})
+}
+
+// CreateBatch 以上传的输入文件创建批处理
+func (h *Handler) CreateBatch(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	var request models.BatchRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+	batch, err := h.batches.Create(c.Request.Context(), middleware.APIKeyFromContext(c.Request.Context()), &request)
+	if err != nil {
+		h.batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// ListBatches 列出调用方的批处理
+func (h *Handler) ListBatches(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	opts, ok := listOptions(c)
+	if !ok {
+		return
+	}
+	batches, more := h.batches.List(middleware.APIKeyFromContext(c.Request.Context()), opts)
+	writeList(c, batches, more, func(b *models.Batch) string { return b.ID })
+}
+
+// GetBatch 获取批处理状态和进度
+func (h *Handler) GetBatch(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	batch, err := h.batches.Get(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// CancelBatch 取消批处理
+func (h *Handler) CancelBatch(c *gin.Context) {
+	if !h.batchesEnabled(c) {
+		return
+	}
+	batch, err := h.batches.Cancel(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.batchError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// batchesEnabled 检查是否启用了批处理，未启用时直接返回错误
+func (h *Handler) batchesEnabled(c *gin.Context) bool {
+	if h.batches != nil {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+		"Batch API is not enabled",
+		"invalid_request_error",
+		"batches_disabled",
+	))
+	return false
+}
+
+// batchError 返回文件和批处理操作的错误
+func (h *Handler) batchError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrFileNotFound), errors.Is(err, services.ErrBatchNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(err.Error(), "invalid_request_error", "not_found"))
+	case errors.Is(err, services.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, models.NewErrorResponse(
+			fmt.Sprintf("file exceeds the %d MB limit", h.configs.Get().BatchMaxFileSizeMB),
+			"invalid_request_error",
+			"file_too_large",
+		))
+	case errors.Is(err, services.ErrBatchNotCancellable):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(err.Error(), "invalid_request_error", "batch_not_cancellable"))
+	default:
+		logrus.WithError(err).Error("Batch operation failed")
+		middleware.HandleError(c, err)
+	}
+}
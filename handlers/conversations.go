@@ -0,0 +1,194 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package handlers
+
+import (
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"cursor2api-go/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxConversationListLimit 列出会话时单次返回的最大数量
+const maxConversationListLimit = 100
+
+// CreateConversation 创建服务端会话
+func (h *Handler) CreateConversation(c *gin.Context) {
+	if !h.conversationsEnabled(c) {
+		return
+	}
+	var request models.ConversationRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	conv, err := h.conversations.Create(middleware.APIKeyFromContext(c.Request.Context()), &request)
+	if err != nil {
+		h.conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// ListConversations 列出调用方的会话（不含消息）
+func (h *Handler) ListConversations(c *gin.Context) {
+	if !h.conversationsEnabled(c) {
+		return
+	}
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxConversationListLimit {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				fmt.Sprintf("limit must be between 1 and %d", maxConversationListLimit),
+				"invalid_request_error",
+				"invalid_limit",
+			))
+			return
+		}
+		limit = parsed
+	}
+
+	conversations := h.conversations.List(middleware.APIKeyFromContext(c.Request.Context()), limit)
+	if conversations == nil {
+		conversations = []*models.Conversation{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": "list",
+		"data":   conversations,
+	})
+}
+
+// GetConversation 获取会话及全部消息
+func (h *Handler) GetConversation(c *gin.Context) {
+	if !h.conversationsEnabled(c) {
+		return
+	}
+	conv, err := h.conversations.Get(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// UpdateConversation 修改会话标题、模型、元数据或替换历史消息
+func (h *Handler) UpdateConversation(c *gin.Context) {
+	if !h.conversationsEnabled(c) {
+		return
+	}
+	var request models.ConversationRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	conv, err := h.conversations.Update(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"), &request)
+	if err != nil {
+		h.conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conv)
+}
+
+// DeleteConversation 删除会话
+func (h *Handler) DeleteConversation(c *gin.Context) {
+	if !h.conversationsEnabled(c) {
+		return
+	}
+	id := c.Param("id")
+	if err := h.conversations.Delete(middleware.APIKeyFromContext(c.Request.Context()), id); err != nil {
+		h.conversationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"object":  "conversation.deleted",
+		"deleted": true,
+	})
+}
+
+// ExportConversation 导出会话，format 为 json（默认）或 markdown
+func (h *Handler) ExportConversation(c *gin.Context) {
+	if !h.conversationsEnabled(c) {
+		return
+	}
+	conv, err := h.conversations.Get(middleware.APIKeyFromContext(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		h.conversationError(c, err)
+		return
+	}
+
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, conv.ID))
+		c.JSON(http.StatusOK, conv)
+	case "markdown", "md":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, conv.ID))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(conv.Markdown()))
+	default:
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			fmt.Sprintf("unsupported export format %q, use json or markdown", format),
+			"invalid_request_error",
+			"invalid_format",
+		))
+	}
+}
+
+// conversationsEnabled 检查是否启用了服务端会话，未启用时直接返回错误
+func (h *Handler) conversationsEnabled(c *gin.Context) bool {
+	if h.conversations != nil {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+		"Server-side conversations are not enabled",
+		"invalid_request_error",
+		"conversations_disabled",
+	))
+	return false
+}
+
+// conversationError 返回会话操作的错误
+func (h *Handler) conversationError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(
+			"Conversation not found",
+			"invalid_request_error",
+			"conversation_not_found",
+		))
+		return
+	}
+	if errors.Is(err, services.ErrConversationBusy) {
+		c.JSON(http.StatusConflict, models.NewErrorResponse(
+			"The previous turn of this conversation is still being generated",
+			"invalid_request_error",
+			"conversation_busy",
+		))
+		return
+	}
+	logrus.WithError(err).Error("Conversation operation failed")
+	middleware.HandleError(c, err)
+}
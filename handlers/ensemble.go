@@ -0,0 +1,123 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package handlers
+
+import (
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Ensemble 多模型集成：同一请求并行发给多个模型，答案并列返回，可选裁判模型挑选或综合最终答案
+func (h *Handler) Ensemble(c *gin.Context) {
+	var request models.EnsembleRequest
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	cfg := h.configs.Get()
+	if len(request.Messages) == 0 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			"Messages cannot be empty",
+			"invalid_request_error",
+			"missing_messages",
+		))
+		return
+	}
+
+	modelIDs := request.Models
+	if len(modelIDs) == 0 {
+		modelIDs = cfg.GetEnsembleModels()
+	}
+	if len(modelIDs) == 0 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			"No models specified and ENSEMBLE_MODELS is not configured",
+			"invalid_request_error",
+			"missing_models",
+		))
+		return
+	}
+	if cfg.EnsembleMaxModels > 0 && len(modelIDs) > cfg.EnsembleMaxModels {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			fmt.Sprintf("At most %d models are allowed", cfg.EnsembleMaxModels),
+			"invalid_request_error",
+			"too_many_models",
+		))
+		return
+	}
+
+	// 请求中的 judge 覆盖配置；仅配置了 ENSEMBLE_JUDGE_MODEL 时默认使用 pick 模式
+	judge := request.Judge
+	if judge == nil && cfg.EnsembleJudgeModel != "" {
+		judge = &models.EnsembleJudge{}
+	}
+	if judge != nil {
+		if judge.Model == "" {
+			judge.Model = cfg.EnsembleJudgeModel
+		}
+		if judge.Model == "" {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				"Judge model is required",
+				"invalid_request_error",
+				"missing_judge_model",
+			))
+			return
+		}
+		if judge.Mode == "" {
+			judge.Mode = models.JudgeModePick
+		}
+		if judge.Mode != models.JudgeModePick && judge.Mode != models.JudgeModeMerge {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				"Judge mode must be pick or merge",
+				"invalid_request_error",
+				"invalid_judge_mode",
+			))
+			return
+		}
+	}
+
+	checkModels := modelIDs
+	if judge != nil {
+		checkModels = append(append([]string{}, modelIDs...), judge.Model)
+	}
+	for _, model := range checkModels {
+		if !cfg.IsValidModel(model) {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				fmt.Sprintf("Invalid model specified: %s", model),
+				"invalid_request_error",
+				"model_not_found",
+			))
+			return
+		}
+	}
+
+	response, err := h.cursorService.Ensemble(c.Request.Context(), &request, modelIDs, judge)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create ensemble completion")
+		middleware.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
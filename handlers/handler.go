@@ -21,13 +21,20 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
 	"cursor2api-go/config"
 	"cursor2api-go/middleware"
 	"cursor2api-go/models"
 	"cursor2api-go/services"
 	"cursor2api-go/utils"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -36,14 +43,21 @@ import (
 
 // Handler 处理器结构
 type Handler struct {
-	config        *config.Config
+	configs       *config.Manager
 	cursorService *services.CursorService
+	idempotency   *services.IdempotencyStore
+	conversations *services.ConversationStore
+	assistants    *services.AssistantStore
+	files         *services.FileStore
+	batches       *services.BatchStore
 	docsContent   []byte
+	buildInfo     BuildInfo
+	startTime     time.Time
 }
 
 // NewHandler 创建新的处理器
-func NewHandler(cfg *config.Config) *Handler {
-	cursorService := services.NewCursorService(cfg)
+func NewHandler(configs *config.Manager) *Handler {
+	cursorService := services.NewCursorService(configs)
 
 	// 预加载文档内容
 	docsPath := "static/docs.html"
@@ -161,17 +175,41 @@ func NewHandler(cfg *config.Config) *Handler {
 		docsContent = []byte(simpleHTML)
 	}
 
+	conversations, err := services.NewConversationStore(configs)
+	if err != nil {
+		logrus.Fatalf("failed to initialize conversation store: %v", err)
+	}
+	assistants, err := services.NewAssistantStore(configs, cursorService)
+	if err != nil {
+		logrus.Fatalf("failed to initialize assistant store: %v", err)
+	}
+	files, err := services.NewFileStore(configs)
+	if err != nil {
+		logrus.Fatalf("failed to initialize file store: %v", err)
+	}
+	batches, err := services.NewBatchStore(configs, cursorService, files)
+	if err != nil {
+		logrus.Fatalf("failed to initialize batch store: %v", err)
+	}
+
 	return &Handler{
-		config:        cfg,
+		configs:       configs,
 		cursorService: cursorService,
+		idempotency:   services.NewIdempotencyStore(configs),
+		conversations: conversations,
+		assistants:    assistants,
+		files:         files,
+		batches:       batches,
 		docsContent:   docsContent,
+		buildInfo:     BuildInfo{Version: "dev"},
+		startTime:     time.Now(),
 	}
 
 }
 
 // ListModels 列出可用模型
 func (h *Handler) ListModels(c *gin.Context) {
-	modelNames := h.config.GetModels()
+	modelNames := h.configs.Get().GetModels()
 	modelList := make([]models.Model, 0, len(modelNames))
 
 	for _, modelID := range modelNames {
@@ -216,7 +254,7 @@ func (h *Handler) ChatCompletions(c *gin.Context) {
 	}
 
 	// 验证模型
-	if !h.config.IsValidModel(request.Model) {
+	if !h.configs.Get().IsValidModel(request.Model) {
 		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
 			"Invalid model specified",
 			"invalid_request_error",
@@ -235,23 +273,152 @@ func (h *Handler) ChatCompletions(c *gin.Context) {
 		return
 	}
 
+	// 验证输出格式
+	if err := request.ResponseFormat.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			err.Error(),
+			"invalid_request_error",
+			"invalid_response_format",
+		))
+		return
+	}
+
+	// 验证候选数量
+	if maxChoices := max(h.configs.Get().MaxChoices, 1); request.N < 0 || request.N > maxChoices {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			fmt.Sprintf("n must be between 1 and %d", maxChoices),
+			"invalid_request_error",
+			"invalid_n",
+		))
+		return
+	}
+
+	// 幂等键比较的是客户端发送的原始参数
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			"Idempotency-Key is too long",
+			"invalid_request_error",
+			"invalid_idempotency_key",
+		))
+		return
+	}
+	bodyHash := requestHash(&request)
+
+	// 服务端会话：补齐历史消息，本轮消息和回复在生成完毕后追加到会话；同一会话同时只允许一轮
+	apiKey := middleware.APIKeyFromContext(c.Request.Context())
+	turn := request.Messages
+	var conversationTurn *services.ConversationTurn
+	if request.ConversationID != "" {
+		if !h.conversationsEnabled(c) {
+			return
+		}
+		// 同一 Idempotency-Key 的重试会回放原来的响应，不算并发的另一轮
+		turnKey := ""
+		if h.idempotency.Enabled() {
+			turnKey = idempotencyKey
+		}
+		conv, ct, err := h.conversations.Begin(apiKey, request.ConversationID, turnKey)
+		if err != nil {
+			h.conversationError(c, err)
+			return
+		}
+		conversationTurn = ct
+		defer conversationTurn.End()
+		request.Messages = append(h.conversations.History(conv), turn...)
+	}
+
 	// 验证并调整max_tokens参数
 	request.MaxTokens = models.ValidateMaxTokens(request.Model, request.MaxTokens)
 
-	// 调用Cursor服务
-	chatGenerator, err := h.cursorService.ChatCompletion(c.Request.Context(), &request)
+	// 文件附件移入 Cursor context，并按上下文窗口裁剪；被截断的附件通过 X-Attachment-Truncated 头给出，
+	// 完全放不下的附件通过 X-Attachment-Omitted 头给出
+	reports, err := h.cursorService.PrepareAttachments(&request)
+	if err != nil {
+		middleware.HandleError(c, err)
+		return
+	}
+	for _, report := range reports {
+		if report.Omitted {
+			c.Writer.Header().Add("X-Attachment-Omitted", fmt.Sprintf("%s; tokens=%d",
+				url.PathEscape(report.Name), report.Tokens))
+		} else if report.Truncated {
+			c.Writer.Header().Add("X-Attachment-Truncated", fmt.Sprintf("%s; tokens=%d; included=%d",
+				url.PathEscape(report.Name), report.Tokens, report.IncludedTokens))
+		}
+	}
+
+	// 调用Cursor服务（Cache-Control: no-cache / no-store 可绕过响应缓存，X-Priority 指定排队优先级）
+	ctx := services.WithCacheControl(c.Request.Context(), services.ParseCacheControl(c.GetHeader("Cache-Control")))
+	ctx = services.WithPriority(ctx, c.GetHeader("X-Priority"))
+	var completion *services.Completion
+	if idempotencyKey != "" && h.idempotency.Enabled() {
+		var resp *services.IdempotentResponse
+		resp, err = h.idempotency.Do(ctx, apiKey, idempotencyKey, bodyHash, func(ctx context.Context) (*services.Completion, error) {
+			return h.complete(ctx, &request, apiKey, conversationTurn, turn)
+		})
+		if err == nil {
+			completion = &services.Completion{Model: resp.Model, Fallback: resp.Fallback, ChoiceModels: resp.ChoiceModels, Stream: resp.Stream}
+			utils.SetResponseIdentity(c, resp.ID, resp.Created)
+			if resp.Replayed {
+				c.Header("Idempotent-Replayed", "true")
+			}
+		}
+	} else {
+		completion, err = h.complete(ctx, &request, apiKey, conversationTurn, turn)
+	}
 	if err != nil {
 		logrus.WithError(err).Error("Failed to create chat completion")
 		middleware.HandleError(c, err)
 		return
 	}
 
+	// 响应的 model 字段为实际应答的模型；由回退模型应答时还通过 X-Fallback-Model 头给出，
+	// n > 1 且各候选的模型不同时按候选下标逗号分隔
+	if len(completion.ChoiceModels) > 0 {
+		c.Header("X-Fallback-Model", strings.Join(completion.ChoiceModels, ","))
+	} else if completion.Fallback {
+		c.Header("X-Fallback-Model", completion.Model)
+	}
+
 	// 根据是否流式返回不同响应
 	if request.Stream {
-		utils.SafeStreamWrapper(utils.StreamChatCompletion, c, chatGenerator, request.Model)
+		utils.SafeStreamWrapper(utils.StreamChatCompletion, c, completion.Stream, completion.Model)
 	} else {
-		utils.NonStreamChatCompletion(c, chatGenerator, request.Model)
+		utils.NonStreamChatCompletion(c, completion.Stream, completion.Model)
+	}
+}
+
+// complete 调用 Cursor 服务生成回复；请求属于服务端会话时记录本轮消息和回复
+func (h *Handler) complete(ctx context.Context, request *models.ChatCompletionRequest, apiKey string, ct *services.ConversationTurn, turn []models.Message) (*services.Completion, error) {
+	completion, err := h.cursorService.Complete(ctx, request)
+	if err != nil || ct == nil {
+		return completion, err
+	}
+	return h.conversations.Record(ctx, apiKey, ct, turn, completion), nil
+}
+
+// maxIdempotencyKeyLength Idempotency-Key 的最大长度
+const maxIdempotencyKeyLength = 255
+
+// requestHash 计算请求参数的摘要，用于判断同一 Idempotency-Key 是否对应相同的请求
+func requestHash(request *models.ChatCompletionRequest) string {
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Close 关闭处理器持有的服务
+func (h *Handler) Close() error {
+	if h.batches != nil {
+		h.batches.Close()
+	}
+	if h.assistants != nil {
+		if err := h.assistants.Close(); err != nil {
+			logrus.WithError(err).Warn("Failed to close assistant store")
+		}
 	}
+	return h.cursorService.Close()
 }
 
 // ServeDocs 服务API文档页面
@@ -264,6 +431,6 @@ func (h *Handler) Health(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "ok",
 		"timestamp": time.Now().Unix(),
-		"version":   "go-1.0.0",
+		"version":   h.buildInfo.Version,
 	})
 }
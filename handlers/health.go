@@ -0,0 +1,87 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package handlers
+
+import (
+	"cursor2api-go/middleware"
+	"cursor2api-go/services"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BuildInfo 构建版本信息（由 main 包通过 ldflags 注入）
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+}
+
+// SetBuildInfo 设置健康检查中返回的构建信息
+func (h *Handler) SetBuildInfo(version, commit, date string) {
+	h.buildInfo = BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// Live 存活检查，只要进程能处理请求就返回 200
+func (h *Handler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "ok",
+		"timestamp":      time.Now().Unix(),
+		"uptime_seconds": int64(time.Since(h.startTime).Seconds()),
+		"build":          h.buildInfo,
+	})
+}
+
+// Ready 就绪检查，逐项检查依赖，任一项失败返回 503
+// 传入 ?probe=true 时额外请求一次上游，确认 cursor.com 可达；该参数需要 ADMIN_API_KEY，避免匿名请求放大上游流量
+func (h *Handler) Ready(c *gin.Context) {
+	probe, _ := strconv.ParseBool(c.Query("probe"))
+	if probe && !middleware.RequireAdmin(c, h.configs) {
+		return
+	}
+	checks := h.cursorService.ReadinessChecks(c.Request.Context(), probe)
+
+	status := "ready"
+	statusCode := http.StatusOK
+	for _, check := range checks {
+		if check.Status == services.HealthStatusFail {
+			status = "not_ready"
+			statusCode = http.StatusServiceUnavailable
+			break
+		}
+	}
+
+	c.JSON(statusCode, gin.H{
+		"status":    status,
+		"timestamp": time.Now().Unix(),
+		"checks":    checks,
+		"build":     h.buildInfo,
+	})
+}
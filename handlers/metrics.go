@@ -0,0 +1,80 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package handlers
+
+import (
+	"cursor2api-go/config"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// metricsWriter 以 Prometheus 文本格式输出指标
+type metricsWriter struct {
+	b strings.Builder
+}
+
+func (w *metricsWriter) metric(name, kind, help string, samples ...string) {
+	fmt.Fprintf(&w.b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, sample := range samples {
+		fmt.Fprintf(&w.b, "%s%s\n", name, sample)
+	}
+}
+
+func sample(value interface{}) string {
+	return fmt.Sprintf(" %v", value)
+}
+
+func labeledSample(label, labelValue string, value interface{}) string {
+	return fmt.Sprintf("{%s=%q} %v", label, labelValue, value)
+}
+
+// Metrics 以 Prometheus 文本格式输出运行指标
+func (h *Handler) Metrics(c *gin.Context) {
+	stats := h.cursorService.LimiterStats()
+
+	var w metricsWriter
+	w.metric("cursor2api_upstream_concurrency_limit", "gauge", "Current upstream concurrency limit (0 means unlimited).", sample(stats.Limit))
+	w.metric("cursor2api_upstream_in_flight", "gauge", "Upstream requests currently holding a slot.", sample(stats.InFlight))
+	w.metric("cursor2api_queue_depth", "gauge", "Requests waiting for an upstream slot.",
+		labeledSample("priority", config.PriorityHigh, stats.QueueByPriority[config.PriorityHigh]),
+		labeledSample("priority", config.PriorityNormal, stats.QueueByPriority[config.PriorityNormal]),
+		labeledSample("priority", config.PriorityLow, stats.QueueByPriority[config.PriorityLow]),
+	)
+	w.metric("cursor2api_queue_admitted_total", "counter", "Requests admitted to the upstream.", sample(stats.Admitted))
+	w.metric("cursor2api_queue_timeouts_total", "counter", "Requests rejected after waiting too long in the queue.", sample(stats.Timeouts))
+	w.metric("cursor2api_queue_wait_seconds_total", "counter", "Total time admitted requests spent queued.", sample(stats.WaitSecondsTotal))
+	w.metric("cursor2api_queue_wait_seconds_max", "gauge", "Longest time a request spent queued.", sample(stats.WaitSecondsMax))
+	if adaptive := stats.Adaptive; adaptive != nil {
+		w.metric("cursor2api_adaptive_latency_ewma_seconds", "gauge", "Smoothed upstream response latency seen by the adaptive controller.", sample(adaptive.LatencyEWMASeconds))
+		w.metric("cursor2api_adaptive_increases_total", "counter", "Additive increases of the upstream concurrency limit.", sample(adaptive.Increases))
+		w.metric("cursor2api_adaptive_decreases_total", "counter", "Multiplicative decreases of the upstream concurrency limit.", sample(adaptive.Decreases))
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(w.b.String()))
+}
+
+// AdminLimiter 返回上游并发限制器的详细状态（含按密钥的排队情况，密钥已脱敏）
+func (h *Handler) AdminLimiter(c *gin.Context) {
+	c.JSON(http.StatusOK, h.cursorService.LimiterStats())
+}
@@ -18,7 +18,19 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// 构建信息，发布时由 goreleaser 通过 ldflags 注入
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
 func main() {
+	// 子命令（如 config check）
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// 加载配置
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -49,11 +61,15 @@ func main() {
 		router.Use(gin.Logger())
 	}
 
+	// 配置管理器：SIGHUP 或配置文件变化时热重载
+	configManager := config.NewManager(cfg, os.Getenv("CONFIG_FILE"))
+
 	// 创建处理器
-	handler := handlers.NewHandler(cfg)
+	handler := handlers.NewHandler(configManager)
+	handler.SetBuildInfo(version, commit, date)
 
 	// 注册路由
-	setupRoutes(router, handler)
+	setupRoutes(router, handler, configManager)
 
 	// 创建HTTP服务器
 	server := &http.Server{
@@ -71,10 +87,21 @@ func main() {
 		}
 	}()
 
-	// 等待中断信号以优雅关闭服务器
+	// 监听配置文件变化
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go configManager.Watch(watchCtx, 2*time.Second)
+
+	// 等待信号：SIGHUP 重载配置，SIGINT/SIGTERM 优雅关闭服务器
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig == syscall.SIGHUP {
+			configManager.ReloadAndLog("SIGHUP")
+			continue
+		}
+		break
+	}
 	logrus.Info("Shutting down server...")
 
 	// 给服务器5秒时间完成处理正在进行的请求
@@ -83,11 +110,14 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		logrus.Fatalf("Server forced to shutdown: %v", err)
 	}
+	if err := handler.Close(); err != nil {
+		logrus.WithError(err).Warn("Failed to close handler")
+	}
 
 	logrus.Info("Server exited")
 }
 
-func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
+func setupRoutes(router *gin.Engine, handler *handlers.Handler, configManager *config.Manager) {
 	// 健康检查
 	router.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
@@ -95,6 +125,12 @@ func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
 			"time":   time.Now().Unix(),
 		})
 	})
+	// 存活/就绪检查（供 Kubernetes 探针和状态页使用）
+	router.GET("/health/live", handler.Live)
+	router.GET("/health/ready", handler.Ready)
+
+	// Prometheus 指标（含按密钥的限流数据，需要管理密钥）
+	router.GET("/metrics", middleware.AdminRequired(configManager), handler.Metrics)
 
 	// API文档页面
 	router.GET("/", handler.ServeDocs)
@@ -103,10 +139,53 @@ func setupRoutes(router *gin.Engine, handler *handlers.Handler) {
 	v1 := router.Group("/v1")
 	{
 		// 模型列表
-		v1.GET("/models", middleware.AuthRequired(), handler.ListModels)
+		v1.GET("/models", middleware.AuthRequired(configManager), handler.ListModels)
 
 		// 聊天完成
-		v1.POST("/chat/completions", middleware.AuthRequired(), handler.ChatCompletions)
+		v1.POST("/chat/completions", middleware.AuthRequired(configManager), handler.ChatCompletions)
+
+		// 多模型集成（扩展接口）
+		v1.POST("/ensemble/completions", middleware.AuthRequired(configManager), handler.Ensemble)
+
+		// 服务端会话（扩展接口）
+		v1.POST("/conversations", middleware.AuthRequired(configManager), handler.CreateConversation)
+		v1.GET("/conversations", middleware.AuthRequired(configManager), handler.ListConversations)
+		v1.GET("/conversations/:id", middleware.AuthRequired(configManager), handler.GetConversation)
+		v1.PATCH("/conversations/:id", middleware.AuthRequired(configManager), handler.UpdateConversation)
+		v1.DELETE("/conversations/:id", middleware.AuthRequired(configManager), handler.DeleteConversation)
+		v1.GET("/conversations/:id/export", middleware.AuthRequired(configManager), handler.ExportConversation)
+
+		// Assistants 风格的助手、线程和运行
+		v1.POST("/assistants", middleware.AuthRequired(configManager), handler.CreateAssistant)
+		v1.GET("/assistants", middleware.AuthRequired(configManager), handler.ListAssistants)
+		v1.GET("/assistants/:id", middleware.AuthRequired(configManager), handler.GetAssistant)
+		v1.POST("/assistants/:id", middleware.AuthRequired(configManager), handler.UpdateAssistant)
+		v1.DELETE("/assistants/:id", middleware.AuthRequired(configManager), handler.DeleteAssistant)
+		v1.POST("/threads", middleware.AuthRequired(configManager), handler.CreateThread)
+		v1.GET("/threads/:id", middleware.AuthRequired(configManager), handler.GetThread)
+		v1.POST("/threads/:id", middleware.AuthRequired(configManager), handler.UpdateThread)
+		v1.DELETE("/threads/:id", middleware.AuthRequired(configManager), handler.DeleteThread)
+		v1.POST("/threads/:id/messages", middleware.AuthRequired(configManager), handler.CreateThreadMessage)
+		v1.GET("/threads/:id/messages", middleware.AuthRequired(configManager), handler.ListThreadMessages)
+		v1.GET("/threads/:id/messages/:message_id", middleware.AuthRequired(configManager), handler.GetThreadMessage)
+		v1.POST("/threads/:id/runs", middleware.AuthRequired(configManager), handler.CreateRun)
+		v1.GET("/threads/:id/runs", middleware.AuthRequired(configManager), handler.ListRuns)
+		v1.GET("/threads/:id/runs/:run_id", middleware.AuthRequired(configManager), handler.GetRun)
+		v1.POST("/threads/:id/runs/:run_id/cancel", middleware.AuthRequired(configManager), handler.CancelRun)
+
+		// 批处理
+		v1.POST("/files", middleware.AuthRequired(configManager), handler.UploadFile)
+		v1.GET("/files", middleware.AuthRequired(configManager), handler.ListFiles)
+		v1.GET("/files/:id", middleware.AuthRequired(configManager), handler.GetFile)
+		v1.GET("/files/:id/content", middleware.AuthRequired(configManager), handler.GetFileContent)
+		v1.DELETE("/files/:id", middleware.AuthRequired(configManager), handler.DeleteFile)
+		v1.POST("/batches", middleware.AuthRequired(configManager), handler.CreateBatch)
+		v1.GET("/batches", middleware.AuthRequired(configManager), handler.ListBatches)
+		v1.GET("/batches/:id", middleware.AuthRequired(configManager), handler.GetBatch)
+		v1.POST("/batches/:id/cancel", middleware.AuthRequired(configManager), handler.CancelBatch)
+
+		// 管理接口
+		v1.GET("/admin/limiter", middleware.AdminRequired(configManager), handler.AdminLimiter)
 	}
 
 	// 静态文件服务（如果需要）
@@ -124,7 +203,7 @@ func printStartupBanner(cfg *config.Config) {
 
 	fmt.Printf("🚀 服务地址:  http://localhost:%d\n", cfg.Port)
 	fmt.Printf("📚 API 文档:  http://localhost:%d/\n", cfg.Port)
-	fmt.Printf("💊 健康检查:  http://localhost:%d/health\n", cfg.Port)
+	fmt.Printf("💊 健康检查:  http://localhost:%d/health/ready\n", cfg.Port)
 	fmt.Printf("🔑 API 密钥:  %s\n", maskAPIKey(cfg.APIKey))
 
 	modelList := cfg.GetModels()
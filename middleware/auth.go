@@ -21,19 +21,38 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
+	"cursor2api-go/config"
 	"cursor2api-go/models"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+type contextKey string
+
+const apiKeyContextKey contextKey = "api_key"
+
+// WithAPIKey 在上下文中记录调用方 API 密钥，供缓存、限流和审计按调用方区分
+func WithAPIKey(ctx context.Context, apiKey string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey, apiKey)
+}
+
+// APIKeyFromContext 获取通过认证的调用方 API 密钥
+func APIKeyFromContext(ctx context.Context) string {
+	if key, ok := ctx.Value(apiKeyContextKey).(string); ok {
+		return key
+	}
+	return ""
+}
+
 // AuthRequired 认证中间件
-func AuthRequired() gin.HandlerFunc {
+func AuthRequired(configs *config.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
-		
+
 		if authHeader == "" {
 			errorResponse := models.NewErrorResponse(
 				"Missing authorization header",
@@ -57,12 +76,7 @@ func AuthRequired() gin.HandlerFunc {
 		}
 
 		token := strings.TrimPrefix(authHeader, "Bearer ")
-		expectedToken := os.Getenv("API_KEY")
-		if expectedToken == "" {
-			expectedToken = "0000" // 默认值
-		}
-
-		if token != expectedToken {
+		if !configs.Get().IsValidAPIKey(token) {
 			errorResponse := models.NewErrorResponse(
 				"Invalid API key",
 				"authentication_error",
@@ -73,7 +87,43 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		// 认证通过，继续处理请求
+		// 认证通过，记录调用方密钥供下游（审计等）使用
+		c.Request = c.Request.WithContext(WithAPIKey(c.Request.Context(), token))
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// AdminRequired 管理接口认证中间件：只接受 ADMIN_API_KEY，未配置时管理接口不可用
+func AdminRequired(configs *config.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if RequireAdmin(c, configs) {
+			c.Next()
+		}
+	}
+}
+
+// RequireAdmin 校验请求是否携带 ADMIN_API_KEY，不通过时写入错误响应并中止请求
+func RequireAdmin(c *gin.Context, configs *config.Manager) bool {
+	adminKey := configs.Get().AdminAPIKey
+	if adminKey == "" {
+		c.JSON(http.StatusForbidden, models.NewErrorResponse(
+			"Admin endpoints are disabled. Set ADMIN_API_KEY to enable them",
+			"permission_error",
+			"admin_disabled",
+		))
+		c.Abort()
+		return false
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminKey)) != 1 {
+		c.JSON(http.StatusUnauthorized, models.NewErrorResponse(
+			"Invalid admin API key",
+			"authentication_error",
+			"invalid_admin_key",
+		))
+		c.Abort()
+		return false
+	}
+	return true
+}
@@ -23,6 +23,7 @@ package middleware
 import (
 	"cursor2api-go/models"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -84,13 +85,37 @@ func handleError(c *gin.Context, err error) {
 		)
 		c.JSON(e.StatusCode, errorResponse)
 
+	case *InvalidRequestError:
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			e.Message,
+			"invalid_request_error",
+			e.Code,
+		))
+
+	case *ConflictError:
+		c.JSON(http.StatusConflict, models.NewErrorResponse(
+			e.Message,
+			"invalid_request_error",
+			e.Code,
+		))
+
+	case *ServiceUnavailableError:
+		if e.RetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(e.RetryAfter))
+		}
+		c.JSON(http.StatusServiceUnavailable, models.NewErrorResponse(
+			e.Message,
+			"server_overloaded",
+			e.Code,
+		))
+
 	case *gin.Error:
 		// 处理Gin绑定错误
 		statusCode := http.StatusBadRequest
 		if e.Type == gin.ErrorTypePublic {
 			statusCode = http.StatusInternalServerError
 		}
-		
+
 		errorResponse := models.NewErrorResponse(
 			e.Error(),
 			"validation_error",
@@ -113,11 +138,11 @@ func handleError(c *gin.Context, err error) {
 func RecoveryHandler() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
 		logrus.WithField("panic", recovered).Error("Panic occurred")
-		
+
 		if c.Writer.Written() {
 			return
 		}
-		
+
 		errorResponse := models.NewErrorResponse(
 			"Internal server error",
 			"panic_error",
@@ -170,8 +195,8 @@ func NewAuthenticationError(message string) *AuthenticationError {
 
 // RateLimitError 限流错误
 type RateLimitError struct {
-	Message     string `json:"message"`
-	RetryAfter  int    `json:"retry_after"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"`
 }
 
 // Error 实现error接口
@@ -185,4 +210,63 @@ func NewRateLimitError(message string, retryAfter int) *RateLimitError {
 		Message:    message,
 		RetryAfter: retryAfter,
 	}
-}
\ No newline at end of file
+}
+
+// ConflictError 请求与已有状态冲突（如 Idempotency-Key 被复用于不同请求体）
+type ConflictError struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+// Error 实现error接口
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// NewConflictError 创建冲突错误
+func NewConflictError(message, code string) *ConflictError {
+	return &ConflictError{
+		Message: message,
+		Code:    code,
+	}
+}
+
+// ServiceUnavailableError 服务暂时不可用（如排队超时）
+type ServiceUnavailableError struct {
+	Message    string `json:"message"`
+	Code       string `json:"code"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// Error 实现error接口
+func (e *ServiceUnavailableError) Error() string {
+	return e.Message
+}
+
+// NewServiceUnavailableError 创建服务不可用错误
+func NewServiceUnavailableError(message, code string, retryAfter int) *ServiceUnavailableError {
+	return &ServiceUnavailableError{
+		Message:    message,
+		Code:       code,
+		RetryAfter: retryAfter,
+	}
+}
+
+// InvalidRequestError 请求内容不合法（如图片超出限制、模型不支持图片输入）
+type InvalidRequestError struct {
+	Message string `json:"message"`
+	Code    string `json:"code"`
+}
+
+// Error 实现error接口
+func (e *InvalidRequestError) Error() string {
+	return e.Message
+}
+
+// NewInvalidRequestError 创建请求不合法错误
+func NewInvalidRequestError(message, code string) *InvalidRequestError {
+	return &InvalidRequestError{
+		Message: message,
+		Code:    code,
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package models
+
+// Run 状态
+const (
+	RunStatusQueued     = "queued"
+	RunStatusInProgress = "in_progress"
+	RunStatusCompleted  = "completed"
+	RunStatusFailed     = "failed"
+	RunStatusCancelling = "cancelling"
+	RunStatusCancelled  = "cancelled"
+)
+
+// Assistant 助手定义：模型和指令
+type Assistant struct {
+	ID           string            `json:"id"`
+	Object       string            `json:"object"`
+	CreatedAt    int64             `json:"created_at"`
+	Name         string            `json:"name,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	Model        string            `json:"model"`
+	Instructions string            `json:"instructions,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// AssistantRequest 创建或修改助手的请求；修改时只更新提供的字段
+type AssistantRequest struct {
+	Model        *string           `json:"model,omitempty"`
+	Name         *string           `json:"name,omitempty"`
+	Description  *string           `json:"description,omitempty"`
+	Instructions *string           `json:"instructions,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// Thread 会话线程
+type Thread struct {
+	ID        string            `json:"id"`
+	Object    string            `json:"object"`
+	CreatedAt int64             `json:"created_at"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// ThreadRequest 创建或修改线程的请求
+type ThreadRequest struct {
+	Messages []ThreadMessageRequest `json:"messages,omitempty"`
+	Metadata map[string]string      `json:"metadata,omitempty"`
+}
+
+// ThreadMessage 线程中的消息
+type ThreadMessage struct {
+	ID          string                 `json:"id"`
+	Object      string                 `json:"object"`
+	CreatedAt   int64                  `json:"created_at"`
+	ThreadID    string                 `json:"thread_id"`
+	Status      string                 `json:"status,omitempty"`
+	Role        string                 `json:"role"`
+	Content     []ThreadMessageContent `json:"content"`
+	AssistantID string                 `json:"assistant_id,omitempty"`
+	RunID       string                 `json:"run_id,omitempty"`
+	Metadata    map[string]string      `json:"metadata,omitempty"`
+}
+
+// ThreadMessageContent 线程消息的内容部分（仅支持文本）
+type ThreadMessageContent struct {
+	Type string      `json:"type"`
+	Text MessageText `json:"text"`
+}
+
+// MessageText 文本内容
+type MessageText struct {
+	Value       string        `json:"value"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+// ThreadMessageRequest 添加线程消息的请求，content 为字符串或文本部分数组
+type ThreadMessageRequest struct {
+	Role     string            `json:"role"`
+	Content  interface{}       `json:"content"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Run 在线程上执行助手的一次运行
+type Run struct {
+	ID           string            `json:"id"`
+	Object       string            `json:"object"`
+	CreatedAt    int64             `json:"created_at"`
+	ThreadID     string            `json:"thread_id"`
+	AssistantID  string            `json:"assistant_id"`
+	Status       string            `json:"status"`
+	Model        string            `json:"model"`
+	Instructions string            `json:"instructions,omitempty"`
+	StartedAt    *int64            `json:"started_at"`
+	CompletedAt  *int64            `json:"completed_at"`
+	FailedAt     *int64            `json:"failed_at"`
+	CancelledAt  *int64            `json:"cancelled_at"`
+	LastError    *RunError         `json:"last_error"`
+	Usage        *Usage            `json:"usage"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+}
+
+// RunError 运行失败的原因
+type RunError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// RunRequest 创建运行的请求
+type RunRequest struct {
+	AssistantID            string                 `json:"assistant_id"`
+	Model                  string                 `json:"model,omitempty"`
+	Instructions           *string                `json:"instructions,omitempty"`
+	AdditionalInstructions string                 `json:"additional_instructions,omitempty"`
+	AdditionalMessages     []ThreadMessageRequest `json:"additional_messages,omitempty"`
+	Stream                 bool                   `json:"stream,omitempty"`
+	Metadata               map[string]string      `json:"metadata,omitempty"`
+}
+
+// RunEvent 运行过程中的流式事件
+type RunEvent struct {
+	Event string
+	Data  interface{}
+}
+
+// MessageDelta thread.message.delta 事件的数据
+type MessageDelta struct {
+	ID     string `json:"id"`
+	Object string `json:"object"`
+	Delta  struct {
+		Content []MessageDeltaContent `json:"content"`
+	} `json:"delta"`
+}
+
+// MessageDeltaContent 增量文本
+type MessageDeltaContent struct {
+	Index int         `json:"index"`
+	Type  string      `json:"type"`
+	Text  MessageText `json:"text"`
+}
+
+// TextContent 创建单个文本部分的消息内容
+func TextContent(value string) []ThreadMessageContent {
+	return []ThreadMessageContent{{Type: "text", Text: MessageText{Value: value, Annotations: []interface{}{}}}}
+}
+
+// ContentText 拼接消息内容中的文本
+func (m *ThreadMessage) ContentText() string {
+	var text string
+	for _, part := range m.Content {
+		text += part.Text.Value
+	}
+	return text
+}
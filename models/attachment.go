@@ -0,0 +1,88 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package models
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// Attachment 作为独立上下文发给上游的文本附件
+type Attachment struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// AttachmentReport 附件按上下文预算裁剪的结果
+type AttachmentReport struct {
+	Name           string `json:"name"`
+	Tokens         int    `json:"tokens"`          // 附件原始大小（估算 token 数）
+	IncludedTokens int    `json:"included_tokens"` // 实际发送的部分
+	Truncated      bool   `json:"truncated"`
+	Omitted        bool   `json:"omitted,omitempty"` // 预算不足，附件完全没有发送
+}
+
+// FileContent file / input_file 内容部分中的文件
+type FileContent struct {
+	Filename string `json:"filename,omitempty"`
+	FileData string `json:"file_data,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+}
+
+// CursorContextFile Cursor 请求 context 中的文件
+type CursorContextFile struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// Files 返回消息中 file / input_file 部分的文件
+func (m *Message) Files() []FileContent {
+	var files []FileContent
+	for _, part := range m.ContentParts() {
+		if (part.Type == "file" || part.Type == "input_file") && part.File != nil {
+			files = append(files, *part.File)
+		}
+	}
+	return files
+}
+
+// Text 解码文件内容：file_data 为 data URL 时按其编码解码，否则视为文本本身
+func (f FileContent) Text() (string, error) {
+	rest, ok := strings.CutPrefix(f.FileData, "data:")
+	if !ok {
+		return f.FileData, nil
+	}
+	header, payload, _ := strings.Cut(rest, ",")
+	if !strings.HasSuffix(header, ";base64") {
+		return payload, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// EstimateTokens 粗略估算文本的 token 数（约 4 字节一个 token）
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
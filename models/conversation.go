@@ -0,0 +1,86 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Conversation 服务端保存的会话
+type Conversation struct {
+	ID           string            `json:"id"`
+	Object       string            `json:"object"`
+	Title        string            `json:"title,omitempty"`
+	Model        string            `json:"model,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Messages     []Message         `json:"messages,omitempty"`
+	MessageCount int               `json:"message_count"`
+	CreatedAt    int64             `json:"created_at"`
+	UpdatedAt    int64             `json:"updated_at"`
+}
+
+// ConversationRequest 创建或修改会话的请求；修改时只更新提供的字段
+type ConversationRequest struct {
+	Title    *string           `json:"title,omitempty"`
+	Model    *string           `json:"model,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Messages []Message         `json:"messages,omitempty"`
+}
+
+// Markdown 将会话导出为 Markdown
+func (c *Conversation) Markdown() string {
+	var b strings.Builder
+	title := c.Title
+	if title == "" {
+		title = c.ID
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	if c.Model != "" {
+		fmt.Fprintf(&b, "- Model: %s\n", c.Model)
+	}
+	fmt.Fprintf(&b, "- Created: %s\n", time.Unix(c.CreatedAt, 0).UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Updated: %s\n", time.Unix(c.UpdatedAt, 0).UTC().Format(time.RFC3339))
+
+	for i := range c.Messages {
+		msg := &c.Messages[i]
+		heading := msg.Role
+		if msg.Name != "" {
+			heading += " (" + msg.Name + ")"
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", heading)
+		if text := strings.TrimSpace(msg.GetStringContent()); text != "" {
+			b.WriteString(text + "\n")
+		}
+		for _, image := range msg.Images() {
+			if strings.HasPrefix(image, "data:") {
+				b.WriteString("\n_[image]_\n")
+			} else {
+				fmt.Fprintf(&b, "\n![image](%s)\n", image)
+			}
+		}
+		for _, file := range msg.Files() {
+			fmt.Fprintf(&b, "\n_[file: %s]_\n", file.Filename)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package models
+
+// 裁判模式
+const (
+	JudgeModePick  = "pick"  // 从候选答案中选出最佳答案
+	JudgeModeMerge = "merge" // 综合候选答案生成最终答案
+)
+
+// EnsembleRequest 多模型集成请求：同一组消息并行发给多个模型
+type EnsembleRequest struct {
+	Models      []string       `json:"models,omitempty"`
+	Messages    []Message      `json:"messages" binding:"required"`
+	Temperature *float64       `json:"temperature,omitempty"`
+	MaxTokens   *int           `json:"max_tokens,omitempty"`
+	TopP        *float64       `json:"top_p,omitempty"`
+	Stop        []string       `json:"stop,omitempty"`
+	User        string         `json:"user,omitempty"`
+	Judge       *EnsembleJudge `json:"judge,omitempty"`
+}
+
+// EnsembleJudge 裁判模型配置
+type EnsembleJudge struct {
+	Model string `json:"model,omitempty"`
+	Mode  string `json:"mode,omitempty"`
+}
+
+// EnsembleAnswer 单个模型的答案及用量
+type EnsembleAnswer struct {
+	Model     string `json:"model"`
+	Content   string `json:"content"`
+	Usage     Usage  `json:"usage"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// EnsembleResponse 多模型集成响应：各模型答案并列返回，可选裁判给出的最终答案
+type EnsembleResponse struct {
+	ID       string           `json:"id"`
+	Object   string           `json:"object"`
+	Created  int64            `json:"created"`
+	Answers  []EnsembleAnswer `json:"answers"`
+	Final    *EnsembleAnswer  `json:"final,omitempty"`
+	Selected *int             `json:"selected,omitempty"` // pick 模式下被选中的答案下标
+	Usage    Usage            `json:"usage"`              // 所有模型（含裁判）的用量合计
+}
+
+// ChatRequest 转换为发往指定模型的聊天完成请求
+func (r *EnsembleRequest) ChatRequest(model string) *ChatCompletionRequest {
+	return &ChatCompletionRequest{
+		Model:       model,
+		Messages:    r.Messages,
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxTokens,
+		TopP:        r.TopP,
+		Stop:        r.Stop,
+		User:        r.User,
+	}
+}
+
+// Add 累加用量
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
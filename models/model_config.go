@@ -22,11 +22,13 @@ package models
 
 // ModelConfig 模型配置结构
 type ModelConfig struct {
-	ID            string `json:"id"`
-	Provider      string `json:"provider"`
-	MaxTokens     int    `json:"max_tokens"`
-	ContextWindow int    `json:"context_window"`
-	CursorModel   string `json:"cursor_model"` // Cursor API 使用的实际模型名
+	ID            string   `json:"id"`
+	Provider      string   `json:"provider"`
+	MaxTokens     int      `json:"max_tokens"`
+	ContextWindow int      `json:"context_window"`
+	CursorModel   string   `json:"cursor_model"`        // Cursor API 使用的实际模型名
+	Fallbacks     []string `json:"fallbacks,omitempty"` // 上游失败时依次尝试的模型
+	Vision        bool     `json:"vision"`              // 是否支持图片输入
 }
 
 // GetModelConfigs 获取所有模型配置
@@ -38,6 +40,7 @@ func GetModelConfigs() map[string]ModelConfig {
 			MaxTokens:     200000,
 			ContextWindow: 200000,
 			CursorModel:   "anthropic/claude-sonnet-4.6",
+			Vision:        true,
 		},
 	}
 }
@@ -60,6 +63,20 @@ func GetCursorModel(modelID string) string {
 	return modelID
 }
 
+// GetFallbackModels 获取模型注册表中定义的回退模型
+func GetFallbackModels(modelID string) []string {
+	if config, exists := GetModelConfig(modelID); exists {
+		return config.Fallbacks
+	}
+	return nil
+}
+
+// SupportsVision 判断模型是否支持图片输入；未在注册表中的模型视为不支持
+func SupportsVision(modelID string) bool {
+	config, exists := GetModelConfig(modelID)
+	return exists && config.Vision
+}
+
 // GetMaxTokensForModel 获取指定模型的最大token数
 func GetMaxTokensForModel(modelID string) int {
 	if config, exists := GetModelConfig(modelID); exists {
@@ -22,6 +22,9 @@ package models
 
 import (
 	"encoding/json"
+	"mime"
+	"path"
+	"strings"
 	"time"
 )
 
@@ -35,19 +38,55 @@ type ChatCompletionRequest struct {
 	TopP        *float64  `json:"top_p,omitempty"`
 	Stop        []string  `json:"stop,omitempty"`
 	User        string    `json:"user,omitempty"`
+	N           int       `json:"n,omitempty"`
+
+	// IncludePrefill 最后一条为 assistant 消息（预填充）时，返回内容是否包含预填充的前缀
+	IncludePrefill bool `json:"include_prefill,omitempty"`
+
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+
+	// Attachments 扩展字段：以独立上下文发送的具名文本附件，消息中的 file 部分也会移到这里
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// ConversationID 扩展字段：服务端会话 ID，历史消息由服务端补齐，本轮消息和回复会追加到会话中
+	ConversationID string `json:"conversation_id,omitempty"`
 }
 
 // Message 消息结构
 type Message struct {
-	Role    string      `json:"role" binding:"required"`
-	Content interface{} `json:"content" binding:"required"`
+	Role       string      `json:"role" binding:"required"`
+	Content    interface{} `json:"content" binding:"required"`
+	Name       string      `json:"name,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+}
+
+// ToolCall assistant 消息中的工具调用
+type ToolCall struct {
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall 工具调用的函数名和参数（JSON 字符串）
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments,omitempty"`
 }
 
 // ContentPart 消息内容部分（用于多模态内容）
 type ContentPart struct {
-	Type string `json:"type"`
-	Text string `json:"text,omitempty"`
-	URL  string `json:"url,omitempty"`
+	Type     string       `json:"type"`
+	Text     string       `json:"text,omitempty"`
+	URL      string       `json:"url,omitempty"`
+	ImageURL *ImageURL    `json:"image_url,omitempty"`
+	File     *FileContent `json:"file,omitempty"`
+}
+
+// ImageURL image_url 内容部分：http(s) 地址或 data URL
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
 }
 
 // ChatCompletionResponse OpenAI聊天完成响应
@@ -96,6 +135,36 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
+// ChoiceChunk 多个候选（n > 1）时带下标的增量文本
+type ChoiceChunk struct {
+	Index   int
+	Content string
+}
+
+// ChoiceFinish 多个候选（n > 1）时某个候选生成结束
+type ChoiceFinish struct {
+	Index int
+}
+
+// StreamFinish 上游 finish 事件带回的结束原因（如 length 表示输出被截断）
+type StreamFinish struct {
+	Reason string
+}
+
+// IsTruncated 判断输出是否因长度限制被截断
+func (f StreamFinish) IsTruncated() bool {
+	switch f.Reason {
+	case "length", "max_tokens", "max-tokens":
+		return true
+	}
+	return false
+}
+
+// Progress 生成过程中的进度提示，流式响应以 SSE 注释输出，非流式响应忽略
+type Progress struct {
+	Message string
+}
+
 // Model 模型信息
 type Model struct {
 	ID            string `json:"id"`
@@ -130,10 +199,12 @@ type CursorMessage struct {
 	Parts []CursorPart `json:"parts"`
 }
 
-// CursorPart Cursor消息部分
+// CursorPart Cursor消息部分：text 部分带 Text，file 部分（如图片）带 MediaType 和 URL
 type CursorPart struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+	URL       string `json:"url,omitempty"`
 }
 
 // CursorRequest Cursor请求格式
@@ -150,6 +221,7 @@ type CursorEventData struct {
 	Type            string                 `json:"type"`
 	Delta           string                 `json:"delta,omitempty"`
 	ErrorText       string                 `json:"errorText,omitempty"`
+	FinishReason    string                 `json:"finishReason,omitempty"`
 	MessageMetadata *CursorMessageMetadata `json:"messageMetadata,omitempty"`
 }
 
@@ -211,7 +283,118 @@ func (m *Message) GetStringContent() string {
 	}
 }
 
-// ToCursorMessages 将OpenAI消息转换为Cursor格式
+// PrefillInstruction 预填充时追加的续写指令
+const PrefillInstruction = "Continue your reply above exactly from where it ends. Output only the continuation: do not repeat what is already written and do not add any preamble."
+
+// Prefill 返回预填充的前缀：最后一条消息为非空的 assistant 消息时，模型应从它的结尾继续生成
+func Prefill(messages []Message) (string, bool) {
+	if len(messages) == 0 || messages[len(messages)-1].Role != "assistant" {
+		return "", false
+	}
+	prefix := messages[len(messages)-1].GetStringContent()
+	return prefix, prefix != ""
+}
+
+// ContentParts 返回消息的内容部分：字符串内容视为一个 text 部分，
+// JSON 解码得到的 []interface{} 转为 []ContentPart（image_url 也接受字符串形式，input_file 的文件字段位于部分本身）
+func (m *Message) ContentParts() []ContentPart {
+	switch content := m.Content.(type) {
+	case nil:
+		return nil
+	case string:
+		return []ContentPart{{Type: "text", Text: content}}
+	case []ContentPart:
+		return content
+	case []interface{}:
+		parts := make([]ContentPart, 0, len(content))
+		for _, item := range content {
+			raw, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			part := ContentPart{}
+			part.Type, _ = raw["type"].(string)
+			part.Text, _ = raw["text"].(string)
+			part.URL, _ = raw["url"].(string)
+			switch file := raw["file"].(type) {
+			case map[string]interface{}:
+				part.File = fileContent(file)
+			default:
+				// input_file 的字段直接位于内容部分上
+				if part.Type == "input_file" {
+					part.File = fileContent(raw)
+				}
+			}
+			switch image := raw["image_url"].(type) {
+			case string:
+				part.ImageURL = &ImageURL{URL: image}
+			case map[string]interface{}:
+				part.ImageURL = &ImageURL{}
+				part.ImageURL.URL, _ = image["url"].(string)
+				part.ImageURL.Detail, _ = image["detail"].(string)
+			}
+			parts = append(parts, part)
+		}
+		return parts
+	default:
+		return []ContentPart{{Type: "text", Text: m.GetStringContent()}}
+	}
+}
+
+// fileContent 从 JSON 对象中读取文件字段
+func fileContent(raw map[string]interface{}) *FileContent {
+	file := &FileContent{}
+	file.Filename, _ = raw["filename"].(string)
+	file.FileData, _ = raw["file_data"].(string)
+	file.FileID, _ = raw["file_id"].(string)
+	return file
+}
+
+// Images 返回消息中 image_url 部分的地址
+func (m *Message) Images() []string {
+	var images []string
+	for _, part := range m.ContentParts() {
+		if part.Type != "image_url" {
+			continue
+		}
+		if part.ImageURL != nil && part.ImageURL.URL != "" {
+			images = append(images, part.ImageURL.URL)
+		} else if part.URL != "" {
+			images = append(images, part.URL)
+		}
+	}
+	return images
+}
+
+// HasImages 判断消息中是否含有图片
+func HasImages(messages []Message) bool {
+	for i := range messages {
+		if len(messages[i].Images()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageMediaType 返回图片地址的媒体类型：data URL 取其声明的类型，其他地址按扩展名推断
+func ImageMediaType(url string) string {
+	if rest, ok := strings.CutPrefix(url, "data:"); ok {
+		mediaType, _, _ := strings.Cut(rest, ",")
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		return strings.ToLower(mediaType)
+	}
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	if mediaType := mime.TypeByExtension(strings.ToLower(path.Ext(url))); mediaType != "" {
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+// ToCursorMessages 将已按 NormalizeMessages 规整的OpenAI消息转换为Cursor格式
+// 最后一条为预填充的 assistant 消息时，追加一条要求从其结尾继续的 user 消息
 func ToCursorMessages(messages []Message, systemPromptInject string) []CursorMessage {
 	var result []CursorMessage
 
@@ -250,22 +433,25 @@ func ToCursorMessages(messages []Message, systemPromptInject string) []CursorMes
 
 	// 转换其余消息
 	for _, msg := range messages {
-		if msg.Role == "" {
-			continue // 跳过空消息
+		cursorMsg := CursorMessage{Role: msg.Role}
+		text, images := msg.GetStringContent(), msg.Images()
+		if text != "" || len(images) == 0 {
+			cursorMsg.Parts = append(cursorMsg.Parts, CursorPart{Type: "text", Text: text})
 		}
-
-		cursorMsg := CursorMessage{
-			Role: msg.Role,
-			Parts: []CursorPart{
-				{
-					Type: "text",
-					Text: msg.GetStringContent(),
-				},
-			},
+		// 图片作为 file 部分附在文本之后
+		for _, image := range images {
+			cursorMsg.Parts = append(cursorMsg.Parts, CursorPart{Type: "file", MediaType: ImageMediaType(image), URL: image})
 		}
 		result = append(result, cursorMsg)
 	}
 
+	if _, ok := Prefill(messages); ok {
+		result = append(result, CursorMessage{
+			Role:  "user",
+			Parts: []CursorPart{{Type: "text", Text: PrefillInstruction}},
+		})
+	}
+
 	return result
 }
 
@@ -290,6 +476,23 @@ func NewChatCompletionResponse(id, model, content string, usage Usage) *ChatComp
 	}
 }
 
+// NewChatCompletionChoicesResponse 创建包含多个候选的聊天完成响应，contents 按候选下标排列
+func NewChatCompletionChoicesResponse(id, model string, contents []string, usage Usage) *ChatCompletionResponse {
+	response := NewChatCompletionResponse(id, model, "", usage)
+	response.Choices = make([]Choice, len(contents))
+	for i, content := range contents {
+		response.Choices[i] = Choice{
+			Index: i,
+			Message: Message{
+				Role:    "assistant",
+				Content: content,
+			},
+			FinishReason: "stop",
+		}
+	}
+	return response
+}
+
 // NewChatCompletionStreamResponse 创建流式响应
 func NewChatCompletionStreamResponse(id, model, content string, finishReason *string) *ChatCompletionStreamResponse {
 	return &ChatCompletionStreamResponse{
@@ -21,6 +21,7 @@
 package models
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -102,6 +103,16 @@ func TestToCursorMessages(t *testing.T) {
 			expectedLength:   2,
 			expectedFirstMsg: "Be helpful\nYou are an AI",
 		},
+		{
+			name: "trailing assistant prefill",
+			messages: []Message{
+				{Role: "user", Content: "Hello"},
+				{Role: "assistant", Content: "{\"greeting\":"},
+			},
+			systemPrompt:     "",
+			expectedLength:   3,
+			expectedFirstMsg: "Hello",
+		},
 	}
 
 	for _, tt := range tests {
@@ -117,6 +128,45 @@ func TestToCursorMessages(t *testing.T) {
 	}
 }
 
+func TestPrefill(t *testing.T) {
+	prefix, ok := Prefill([]Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Sure:"}})
+	if !ok || prefix != "Sure:" {
+		t.Errorf("Prefill() = %q, %v, want %q, true", prefix, ok, "Sure:")
+	}
+	if _, ok := Prefill([]Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: ""}}); ok {
+		t.Error("Prefill() should ignore an empty assistant message")
+	}
+
+	result := ToCursorMessages([]Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Sure:"}}, "")
+	last := result[len(result)-1]
+	if last.Role != "user" || last.Parts[0].Text != PrefillInstruction {
+		t.Errorf("last message = %+v, want the prefill instruction", last)
+	}
+}
+
+func TestImageMediaType(t *testing.T) {
+	tests := map[string]string{
+		"data:image/png;base64,AAAA":          "image/png",
+		"data:IMAGE/JPEG;base64,AAAA":         "image/jpeg",
+		"https://example.com/cat.webp?size=2": "image/webp",
+		"https://example.com/cat":             "application/octet-stream",
+	}
+	for url, want := range tests {
+		if got := ImageMediaType(url); got != want {
+			t.Errorf("ImageMediaType(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestSupportsVision(t *testing.T) {
+	if !SupportsVision("claude-sonnet-4.6") {
+		t.Error("registered vision model should support images")
+	}
+	if SupportsVision("unregistered-model") {
+		t.Error("unregistered models should not be assumed to support images")
+	}
+}
+
 func TestNewChatCompletionResponse(t *testing.T) {
 	response := NewChatCompletionResponse("test-id", "gpt-4o", "Hello world", Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
 
@@ -134,6 +184,22 @@ func TestNewChatCompletionResponse(t *testing.T) {
 	}
 }
 
+func TestNewChatCompletionChoicesResponse(t *testing.T) {
+	response := NewChatCompletionChoicesResponse("test-id", "gpt-4o", []string{"first", "second"}, Usage{TotalTokens: 30})
+
+	if len(response.Choices) != 2 {
+		t.Fatalf("len(Choices) = %d, want 2", len(response.Choices))
+	}
+	for i, want := range []string{"first", "second"} {
+		if response.Choices[i].Index != i || response.Choices[i].Message.Content != want {
+			t.Errorf("Choices[%d] = %+v, want index %d content %s", i, response.Choices[i], i, want)
+		}
+	}
+	if response.Usage.TotalTokens != 30 {
+		t.Errorf("TotalTokens = %v, want 30", response.Usage.TotalTokens)
+	}
+}
+
 func TestNewChatCompletionStreamResponse(t *testing.T) {
 	response := NewChatCompletionStreamResponse("test-id", "gpt-4o", "Hello", stringPtr("stop"))
 
@@ -166,3 +232,70 @@ func TestNewErrorResponse(t *testing.T) {
 func stringPtr(s string) *string {
 	return &s
 }
+
+func TestResponseFormat(t *testing.T) {
+	var none *ResponseFormat
+	if none.RequiresJSON() || none.Instructions() != "" || none.Validate() != nil {
+		t.Error("nil response_format should be a no-op")
+	}
+
+	object := &ResponseFormat{Type: ResponseFormatJSONObject}
+	if !object.RequiresJSON() || object.Instructions() == "" {
+		t.Error("json_object should require JSON and add instructions")
+	}
+
+	schema := &ResponseFormat{Type: ResponseFormatJSONSchema, JSONSchema: &JSONSchemaFormat{Name: "person", Schema: map[string]interface{}{"type": "object"}}}
+	if err := schema.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if !strings.Contains(schema.Instructions(), `"type": "object"`) {
+		t.Errorf("Instructions() = %q, want the schema included", schema.Instructions())
+	}
+
+	if err := (&ResponseFormat{Type: ResponseFormatJSONSchema}).Validate(); err == nil {
+		t.Error("json_schema without schema should be rejected")
+	}
+	if err := (&ResponseFormat{Type: "xml"}).Validate(); err == nil {
+		t.Error("unknown type should be rejected")
+	}
+
+	withRef := &ResponseFormat{Type: ResponseFormatJSONSchema, JSONSchema: &JSONSchemaFormat{Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"child": map[string]interface{}{"$ref": "#/$defs/child"}},
+		"$defs":      map[string]interface{}{"child": map[string]interface{}{"type": "string"}},
+	}}}
+	err := withRef.Validate()
+	if err == nil || !strings.Contains(err.Error(), "$.$defs") || !strings.Contains(err.Error(), "$.properties.child.$ref") {
+		t.Errorf("Validate() = %v, want $defs and nested $ref rejected", err)
+	}
+	annotated := &ResponseFormat{Type: ResponseFormatJSONSchema, JSONSchema: &JSONSchemaFormat{Schema: map[string]interface{}{
+		"type":        "string",
+		"description": "an ISO date",
+		"format":      "date",
+	}}}
+	if err := annotated.Validate(); err != nil {
+		t.Errorf("Validate() = %v, annotations should be accepted", err)
+	}
+}
+
+func TestConversationMarkdown(t *testing.T) {
+	conv := &Conversation{
+		ID:    "conv_1",
+		Title: "Trip",
+		Model: "claude-sonnet-4.6",
+		Messages: []Message{
+			{Role: "user", Name: "alice", Content: []interface{}{
+				map[string]interface{}{"type": "text", "text": "Where?"},
+				map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/map.png"}},
+			}},
+			{Role: "assistant", Content: "Paris"},
+		},
+	}
+
+	markdown := conv.Markdown()
+	for _, want := range []string{"# Trip\n", "- Model: claude-sonnet-4.6\n", "## user (alice)\n\nWhere?\n", "![image](https://example.com/map.png)", "## assistant\n\nParis\n"} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("Markdown() missing %q in:\n%s", want, markdown)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NormalizeMessages 把 OpenAI 消息规整为上游能理解的 system/user/assistant 序列：
+//   - system 和 developer 消息（无论位置）按顺序合并为开头的一条 system 消息（其中的图片丢弃）
+//   - 带 name 的 user/assistant 消息在内容前加上 "name: "
+//   - assistant 的 tool_calls 以 "[Tool call id: name(arguments)]" 追加到内容末尾
+//   - tool 消息转为 user 消息，内容前加上 "[Tool result for id]" 标注（有 name 时为 "[Tool result from name (id)]"）
+//   - function 消息转为 user 消息，内容前加上 "[Function result from name]" 标注
+//   - 其他角色按 user 处理；没有角色或内容为空的消息丢弃
+//   - 相邻的同角色消息用空行合并
+//
+// 返回的消息内容为字符串（含图片时为文本部分加 image_url 部分），且不再带 name 等字段，重复规整结果不变
+func NormalizeMessages(messages []Message) []Message {
+	var system []string
+	var result []Message
+
+	for _, msg := range messages {
+		role := strings.ToLower(strings.TrimSpace(msg.Role))
+		if role == "" {
+			continue
+		}
+		content, images := msg.GetStringContent(), msg.Images()
+
+		switch role {
+		case "system", "developer":
+			if strings.TrimSpace(content) != "" {
+				system = append(system, strings.TrimSpace(content))
+			}
+			continue
+		case "tool":
+			role = "user"
+			content = toolResultLabel(msg) + "\n" + content
+		case "function":
+			role = "user"
+			content = fmt.Sprintf("[Function result from %s]\n%s", msg.Name, content)
+		case "assistant":
+			content = withSpeakerName(msg.Name, content)
+			for _, call := range msg.ToolCalls {
+				if strings.TrimSpace(content) != "" {
+					content += "\n"
+				}
+				content += formatToolCall(call)
+			}
+		default:
+			role = "user"
+			content = withSpeakerName(msg.Name, content)
+		}
+
+		if strings.TrimSpace(content) == "" && len(images) == 0 {
+			continue
+		}
+		if last := len(result) - 1; last >= 0 && result[last].Role == role {
+			merged := result[last].GetStringContent()
+			if strings.TrimSpace(merged) != "" && strings.TrimSpace(content) != "" {
+				merged += "\n\n"
+			}
+			result[last].Content = normalizedContent(merged+content, append(result[last].Images(), images...))
+			continue
+		}
+		result = append(result, Message{Role: role, Content: normalizedContent(content, images)})
+	}
+
+	if len(system) > 0 {
+		result = append([]Message{{Role: "system", Content: strings.Join(system, "\n\n")}}, result...)
+	}
+	return result
+}
+
+// normalizedContent 规整后的内容：没有图片时为字符串，否则为文本部分加 image_url 部分
+func normalizedContent(text string, images []string) interface{} {
+	if len(images) == 0 {
+		return text
+	}
+	var parts []ContentPart
+	if strings.TrimSpace(text) != "" {
+		parts = append(parts, ContentPart{Type: "text", Text: text})
+	}
+	for _, image := range images {
+		parts = append(parts, ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: image}})
+	}
+	return parts
+}
+
+// withSpeakerName 在内容前加上发言者名称
+func withSpeakerName(name, content string) string {
+	if name == "" || strings.TrimSpace(content) == "" {
+		return content
+	}
+	return name + ": " + content
+}
+
+// toolResultLabel 工具结果的标注
+func toolResultLabel(msg Message) string {
+	switch {
+	case msg.Name != "" && msg.ToolCallID != "":
+		return fmt.Sprintf("[Tool result from %s (%s)]", msg.Name, msg.ToolCallID)
+	case msg.Name != "":
+		return fmt.Sprintf("[Tool result from %s]", msg.Name)
+	case msg.ToolCallID != "":
+		return fmt.Sprintf("[Tool result for %s]", msg.ToolCallID)
+	default:
+		return "[Tool result]"
+	}
+}
+
+// formatToolCall 把工具调用格式化为文本
+func formatToolCall(call ToolCall) string {
+	if call.ID != "" {
+		return fmt.Sprintf("[Tool call %s: %s(%s)]", call.ID, call.Function.Name, call.Function.Arguments)
+	}
+	return fmt.Sprintf("[Tool call: %s(%s)]", call.Function.Name, call.Function.Arguments)
+}
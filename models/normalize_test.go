@@ -0,0 +1,143 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []Message
+		want     []Message
+	}{
+		{
+			name:     "plain conversation is unchanged",
+			messages: []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello"}},
+			want:     []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello"}},
+		},
+		{
+			name: "system and developer messages are merged at the start",
+			messages: []Message{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: "Hi"},
+				{Role: "developer", Content: "Answer in French."},
+				{Role: "system", Content: "No emoji."},
+			},
+			want: []Message{
+				{Role: "system", Content: "Be brief.\n\nAnswer in French.\n\nNo emoji."},
+				{Role: "user", Content: "Hi"},
+			},
+		},
+		{
+			name:     "speaker names are kept",
+			messages: []Message{{Role: "user", Name: "alice", Content: "Hi"}, {Role: "assistant", Name: "bot", Content: "Hello"}},
+			want:     []Message{{Role: "user", Content: "alice: Hi"}, {Role: "assistant", Content: "bot: Hello"}},
+		},
+		{
+			name: "adjacent turns of the same role are merged",
+			messages: []Message{
+				{Role: "user", Name: "alice", Content: "Hi"},
+				{Role: "user", Name: "bob", Content: "Hey"},
+				{Role: "assistant", Content: "Hello both"},
+			},
+			want: []Message{
+				{Role: "user", Content: "alice: Hi\n\nbob: Hey"},
+				{Role: "assistant", Content: "Hello both"},
+			},
+		},
+		{
+			name: "tool calls and tool results",
+			messages: []Message{
+				{Role: "user", Content: "Weather?"},
+				{Role: "assistant", Content: nil, ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}}},
+				{Role: "tool", ToolCallID: "call_1", Content: "Sunny"},
+			},
+			want: []Message{
+				{Role: "user", Content: "Weather?"},
+				{Role: "assistant", Content: `[Tool call call_1: weather({"city":"Paris"})]`},
+				{Role: "user", Content: "[Tool result for call_1]\nSunny"},
+			},
+		},
+		{
+			name: "named tool result and function result",
+			messages: []Message{
+				{Role: "tool", Name: "search", ToolCallID: "call_2", Content: "3 hits"},
+				{Role: "function", Name: "lookup", Content: "42"},
+			},
+			want: []Message{
+				{Role: "user", Content: "[Tool result from search (call_2)]\n3 hits\n\n[Function result from lookup]\n42"},
+			},
+		},
+		{
+			name: "empty messages and roles are dropped",
+			messages: []Message{
+				{Role: "", Content: "orphan"},
+				{Role: "system", Content: "  "},
+				{Role: "user", Content: "Hi"},
+				{Role: "assistant", Content: ""},
+				{Role: "user", Content: []interface{}{}},
+			},
+			want: []Message{{Role: "user", Content: "Hi"}},
+		},
+		{
+			name:     "roles are case-insensitive and unknown roles become user",
+			messages: []Message{{Role: "User", Content: "Hi"}, {Role: "narrator", Content: "Meanwhile"}},
+			want:     []Message{{Role: "user", Content: "Hi\n\nMeanwhile"}},
+		},
+		{
+			name:     "content parts are flattened",
+			messages: []Message{{Role: "user", Content: []interface{}{map[string]interface{}{"type": "text", "text": "Hi"}}}},
+			want:     []Message{{Role: "user", Content: "Hi"}},
+		},
+		{
+			name: "images are kept when turns are merged",
+			messages: []Message{
+				{Role: "user", Content: "Look:"},
+				{Role: "user", Content: []interface{}{map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "https://example.com/a.png"}}}},
+			},
+			want: []Message{{Role: "user", Content: []ContentPart{
+				{Type: "text", Text: "Look:"},
+				{Type: "image_url", ImageURL: &ImageURL{URL: "https://example.com/a.png"}},
+			}}},
+		},
+		{
+			name:     "trailing whitespace of a prefill is kept",
+			messages: []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Answer: "}},
+			want:     []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Answer: "}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeMessages(tt.messages)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeMessages() = %#v, want %#v", got, tt.want)
+			}
+			// 规整结果再次规整不变
+			if again := NormalizeMessages(got); !reflect.DeepEqual(again, got) {
+				t.Errorf("NormalizeMessages() is not idempotent: %#v", again)
+			}
+		})
+	}
+}
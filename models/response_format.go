@@ -0,0 +1,149 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// response_format 类型
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat 输出格式约束
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat json_schema 模式下的 schema 定义
+type JSONSchemaFormat struct {
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema,omitempty"`
+	Strict      bool                   `json:"strict,omitempty"`
+}
+
+// RequiresJSON 是否要求输出 JSON
+func (f *ResponseFormat) RequiresJSON() bool {
+	return f != nil && (f.Type == ResponseFormatJSONObject || f.Type == ResponseFormatJSONSchema)
+}
+
+// Validate 检查 response_format 是否有效
+func (f *ResponseFormat) Validate() error {
+	if f == nil {
+		return nil
+	}
+	switch f.Type {
+	case ResponseFormatText, ResponseFormatJSONObject:
+		return nil
+	case ResponseFormatJSONSchema:
+		if f.JSONSchema == nil || f.JSONSchema.Schema == nil {
+			return fmt.Errorf("response_format.json_schema.schema is required")
+		}
+		if unsupported := unsupportedSchemaKeywords("$", f.JSONSchema.Schema); len(unsupported) > 0 {
+			sort.Strings(unsupported)
+			return fmt.Errorf("response_format.json_schema.schema uses unsupported keywords: %s", strings.Join(unsupported, ", "))
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported response_format type: %s", f.Type)
+	}
+}
+
+// Instructions 返回注入到系统提示中的格式说明，不要求 JSON 时为空
+func (f *ResponseFormat) Instructions() string {
+	if !f.RequiresJSON() {
+		return ""
+	}
+	instructions := "Respond with valid JSON only. Do not wrap it in code fences and do not add any text before or after it."
+	if f.Type == ResponseFormatJSONObject {
+		return instructions + " The top-level value must be a JSON object."
+	}
+
+	schema, _ := json.MarshalIndent(f.JSONSchema.Schema, "", "  ")
+	instructions += " The JSON must conform to this JSON Schema"
+	if f.JSONSchema.Name != "" {
+		instructions += fmt.Sprintf(" (%s)", f.JSONSchema.Name)
+	}
+	if f.JSONSchema.Description != "" {
+		instructions += ": " + f.JSONSchema.Description
+	}
+	return instructions + "\n" + string(schema)
+}
+
+// supportedSchemaKeywords 输出校验（utils.ValidateJSONSchema）支持的关键字，以及不影响校验的注解
+var supportedSchemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true,
+	"items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "minimum": true, "maximum": true,
+	"anyOf": true, "oneOf": true, "allOf": true,
+	"title": true, "description": true, "default": true, "examples": true,
+	"format": true, "$schema": true, "$comment": true,
+}
+
+// unsupportedSchemaKeywords 递归查找 schema 中无法校验的关键字（如 $ref、pattern），
+// 避免这些约束被静默忽略
+func unsupportedSchemaKeywords(path string, schema map[string]interface{}) []string {
+	var found []string
+	for key, value := range schema {
+		if !supportedSchemaKeywords[key] {
+			found = append(found, path+"."+key)
+			continue
+		}
+		switch key {
+		case "properties":
+			properties, _ := value.(map[string]interface{})
+			for name, sub := range properties {
+				if subSchema, ok := sub.(map[string]interface{}); ok {
+					found = append(found, unsupportedSchemaKeywords(path+".properties."+name, subSchema)...)
+				}
+			}
+		case "additionalProperties":
+			if subSchema, ok := value.(map[string]interface{}); ok {
+				found = append(found, unsupportedSchemaKeywords(path+".additionalProperties", subSchema)...)
+			}
+		case "items":
+			switch items := value.(type) {
+			case map[string]interface{}:
+				found = append(found, unsupportedSchemaKeywords(path+".items", items)...)
+			case []interface{}:
+				// 元组形式的 items 不受支持
+				found = append(found, path+".items")
+			}
+		case "anyOf", "oneOf", "allOf":
+			subschemas, _ := value.([]interface{})
+			for i, sub := range subschemas {
+				if subSchema, ok := sub.(map[string]interface{}); ok {
+					found = append(found, unsupportedSchemaKeywords(fmt.Sprintf("%s.%s[%d]", path, key, i), subSchema)...)
+				}
+			}
+		}
+	}
+	return found
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"cursor2api-go/config"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// latencyEWMAAlpha 上游延迟滑动平均的权重
+	latencyEWMAAlpha = 0.2
+	// latencySpikeFactor 延迟超过平均值的倍数视为尖峰
+	latencySpikeFactor = 3
+	// latencyWarmupSamples 样本数不足时不判断相对尖峰
+	latencyWarmupSamples = 10
+	// adaptiveDecreaseCooldown 两次下调之间的最短间隔，避免同一波限流被重复计入
+	adaptiveDecreaseCooldown = 2 * time.Second
+)
+
+// AdaptiveController 按上游表现调整并发上限（AIMD）：
+// 健康时每个成功请求把上限加 1/limit（约每轮加 1），遇到 403/429 或延迟尖峰时乘以下调系数
+type AdaptiveController struct {
+	configs *config.Manager
+	limiter *Limiter
+
+	mu           sync.Mutex
+	limit        float64
+	latencyEWMA  float64
+	samples      int
+	lastDecrease time.Time
+	lastReason   string
+	increases    int64
+	decreases    int64
+}
+
+// AdaptiveStats 自适应并发状态
+type AdaptiveStats struct {
+	Limit              int     `json:"limit"`
+	Min                int     `json:"min"`
+	Max                int     `json:"max"`
+	LatencyEWMASeconds float64 `json:"latency_ewma_seconds"`
+	Increases          int64   `json:"increases_total"`
+	Decreases          int64   `json:"decreases_total"`
+	LastDecreaseReason string  `json:"last_decrease_reason,omitempty"`
+	LastDecreaseAt     int64   `json:"last_decrease_at,omitempty"`
+}
+
+// NewAdaptiveController 创建自适应并发控制器，并接管 limiter 的并发上限
+func NewAdaptiveController(configs *config.Manager, limiter *Limiter) *AdaptiveController {
+	cfg := configs.Get()
+	initial := cfg.UpstreamMaxConcurrency
+	if initial <= 0 {
+		initial = cfg.AdaptiveMinConcurrency
+	}
+
+	ac := &AdaptiveController{configs: configs, limiter: limiter}
+	ac.limit = ac.clamp(float64(initial), cfg)
+	limiter.SetLimit(int(ac.limit))
+	return ac
+}
+
+// Observe 记录一次上游响应（状态码与响应头到达前的延迟）
+func (ac *AdaptiveController) Observe(statusCode int, latency time.Duration) {
+	cfg := ac.configs.Get()
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	reason := ""
+	switch {
+	case statusCode == http.StatusForbidden || statusCode == http.StatusTooManyRequests:
+		reason = http.StatusText(statusCode)
+	case statusCode == http.StatusOK:
+		reason = ac.latencySpike(latency, cfg)
+	default:
+		// 其他错误与上游限流无关，不调整
+		return
+	}
+
+	if reason == "" {
+		ac.limit = ac.clamp(ac.limit+1/ac.limit, cfg)
+		ac.increases++
+	} else {
+		if time.Since(ac.lastDecrease) < adaptiveDecreaseCooldown {
+			return
+		}
+		ac.limit = ac.clamp(ac.limit*cfg.AdaptiveDecreaseFactor, cfg)
+		ac.lastDecrease = time.Now()
+		ac.lastReason = reason
+		ac.decreases++
+		logrus.WithFields(logrus.Fields{
+			"reason": reason,
+			"limit":  int(ac.limit),
+		}).Warn("Reducing upstream concurrency")
+	}
+	ac.limiter.SetLimit(int(ac.limit))
+}
+
+// Stats 返回当前状态
+func (ac *AdaptiveController) Stats() AdaptiveStats {
+	cfg := ac.configs.Get()
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+
+	stats := AdaptiveStats{
+		Limit:              int(ac.limit),
+		Min:                cfg.AdaptiveMinConcurrency,
+		Max:                cfg.AdaptiveMaxConcurrency,
+		LatencyEWMASeconds: ac.latencyEWMA / float64(time.Second),
+		Increases:          ac.increases,
+		Decreases:          ac.decreases,
+		LastDecreaseReason: ac.lastReason,
+	}
+	if !ac.lastDecrease.IsZero() {
+		stats.LastDecreaseAt = ac.lastDecrease.Unix()
+	}
+	return stats
+}
+
+// latencySpike 判断延迟是否为尖峰：超过绝对阈值，或预热后超过平均值的若干倍
+func (ac *AdaptiveController) latencySpike(latency time.Duration, cfg *config.Config) string {
+	value := float64(latency)
+	average := ac.latencyEWMA
+	if ac.samples == 0 {
+		ac.latencyEWMA = value
+	} else {
+		ac.latencyEWMA = latencyEWMAAlpha*value + (1-latencyEWMAAlpha)*ac.latencyEWMA
+	}
+	ac.samples++
+
+	if threshold := time.Duration(cfg.AdaptiveLatencyThresholdMs) * time.Millisecond; threshold > 0 && latency > threshold {
+		return "latency above threshold"
+	}
+	if ac.samples > latencyWarmupSamples && value > average*latencySpikeFactor {
+		return "latency spike"
+	}
+	return ""
+}
+
+// clamp 把上限限制在 [min, max] 内（配置可热更新，每次使用时读取）
+func (ac *AdaptiveController) clamp(limit float64, cfg *config.Config) float64 {
+	return math.Max(float64(cfg.AdaptiveMinConcurrency), math.Min(float64(cfg.AdaptiveMaxConcurrency), limit))
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"cursor2api-go/config"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestAdaptiveController(initial int) (*AdaptiveController, *Limiter) {
+	cfg := &config.Config{
+		UpstreamMaxConcurrency:     initial,
+		AdaptiveConcurrency:        true,
+		AdaptiveMinConcurrency:     1,
+		AdaptiveMaxConcurrency:     8,
+		AdaptiveDecreaseFactor:     0.5,
+		AdaptiveLatencyThresholdMs: 1000,
+	}
+	limiter := NewLimiter(0)
+	return NewAdaptiveController(config.NewManager(cfg, ""), limiter), limiter
+}
+
+func TestAdaptiveControllerAdditiveIncrease(t *testing.T) {
+	ac, limiter := newTestAdaptiveController(2)
+	if limiter.Limit() != 2 {
+		t.Fatalf("initial limit = %d, want 2", limiter.Limit())
+	}
+
+	// 每次成功增加 1/limit：2 → 2.5 → 2.9 → 3.24
+	for i := 0; i < 3; i++ {
+		ac.Observe(http.StatusOK, 10*time.Millisecond)
+	}
+	if limiter.Limit() != 3 {
+		t.Errorf("limit = %d, want 3", limiter.Limit())
+	}
+
+	for i := 0; i < 100; i++ {
+		ac.Observe(http.StatusOK, 10*time.Millisecond)
+	}
+	if limiter.Limit() != 8 {
+		t.Errorf("limit = %d, want capped at 8", limiter.Limit())
+	}
+}
+
+func TestAdaptiveControllerMultiplicativeDecrease(t *testing.T) {
+	ac, limiter := newTestAdaptiveController(8)
+
+	ac.Observe(http.StatusTooManyRequests, 10*time.Millisecond)
+	if limiter.Limit() != 4 {
+		t.Fatalf("limit = %d, want 4 after 429", limiter.Limit())
+	}
+
+	// 冷却期内的连续限流只计一次
+	ac.Observe(http.StatusForbidden, 10*time.Millisecond)
+	if limiter.Limit() != 4 {
+		t.Errorf("limit = %d, want 4 during cooldown", limiter.Limit())
+	}
+
+	ac.lastDecrease = time.Time{}
+	ac.Observe(http.StatusOK, 2*time.Second)
+	if limiter.Limit() != 2 {
+		t.Errorf("limit = %d, want 2 after latency spike", limiter.Limit())
+	}
+
+	// 与限流无关的错误不调整
+	ac.lastDecrease = time.Time{}
+	ac.Observe(http.StatusInternalServerError, 10*time.Millisecond)
+	if limiter.Limit() != 2 {
+		t.Errorf("limit = %d, want 2 after 500", limiter.Limit())
+	}
+
+	stats := ac.Stats()
+	if stats.Decreases != 2 || stats.LastDecreaseReason == "" {
+		t.Errorf("stats = %+v, want 2 decreases with a reason", stats)
+	}
+}
+
+func TestAdaptiveControllerRelativeLatencySpike(t *testing.T) {
+	ac, limiter := newTestAdaptiveController(8)
+	for i := 0; i < latencyWarmupSamples; i++ {
+		ac.Observe(http.StatusOK, 50*time.Millisecond)
+	}
+	ac.Observe(http.StatusOK, 500*time.Millisecond)
+	if limiter.Limit() != 4 {
+		t.Errorf("limit = %d, want 4 after relative latency spike", limiter.Limit())
+	}
+}
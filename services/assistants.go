@@ -0,0 +1,555 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Assistants API 的错误，均表示对象不存在或不属于调用方
+var (
+	ErrAssistantNotFound = errors.New("assistant not found")
+	ErrThreadNotFound    = errors.New("thread not found")
+	ErrMessageNotFound   = errors.New("message not found")
+	ErrRunNotFound       = errors.New("run not found")
+)
+
+// ErrRunActive 线程上已有未结束的运行
+var ErrRunActive = errors.New("thread already has an active run")
+
+// ErrRunNotCancellable 运行已结束，不能取消
+var ErrRunNotCancellable = errors.New("run is not cancellable")
+
+var (
+	assistantsBucket = []byte("assistants")
+	threadsBucket    = []byte("threads")
+	messagesBucket   = []byte("messages") // 每个线程一个子桶，键为自增序号
+	runsBucket       = []byte("runs")     // 同上
+)
+
+// storedAssistant 数据库中保存的助手，owner 为 API 密钥的摘要
+type storedAssistant struct {
+	Owner     string           `json:"owner"`
+	Assistant models.Assistant `json:"assistant"`
+}
+
+// storedThread 数据库中保存的线程；线程下的消息和运行归属于线程的 owner
+type storedThread struct {
+	Owner  string        `json:"owner"`
+	Thread models.Thread `json:"thread"`
+}
+
+// ListOptions 分页列出对象的参数，After 为上一页最后一个对象的 ID
+type ListOptions struct {
+	Limit int
+	Desc  bool
+	After string
+}
+
+// AssistantStore Assistants 风格的助手、线程和运行，保存在嵌入式数据库中，按 API 密钥隔离
+type AssistantStore struct {
+	configs *config.Manager
+	service *CursorService
+	db      *bolt.DB
+
+	mu     sync.Mutex
+	active map[string]*activeRun // 正在执行的运行
+	wg     sync.WaitGroup
+}
+
+// NewAssistantStore 打开助手数据库，把上次退出时未结束的运行标记为失败；未启用时返回 nil
+func NewAssistantStore(configs *config.Manager, service *CursorService) (*AssistantStore, error) {
+	cfg := configs.Get()
+	if !cfg.AssistantsEnabled {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.AssistantsDBPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create assistants dir: %w", err)
+	}
+	db, err := bolt.Open(cfg.AssistantsDBPath, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open assistants database: %w", err)
+	}
+
+	as := &AssistantStore{configs: configs, service: service, db: db, active: make(map[string]*activeRun)}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{assistantsBucket, threadsBucket, messagesBucket, runsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return as.failInterrupted(tx)
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return as, nil
+}
+
+// failInterrupted 进程退出时仍在执行的运行无法恢复，标记为失败
+// bbolt 不允许在 ForEach 中修改桶，先收集需要更新的运行，遍历结束后再写入
+func (as *AssistantStore) failInterrupted(tx *bolt.Tx) error {
+	type interrupted struct {
+		bucket *bolt.Bucket
+		key    []byte
+		run    models.Run
+	}
+
+	now := time.Now().Unix()
+	var runs []interrupted
+	err := tx.Bucket(runsBucket).ForEachBucket(func(threadID []byte) error {
+		bucket := tx.Bucket(runsBucket).Bucket(threadID)
+		return bucket.ForEach(func(key, data []byte) error {
+			var run models.Run
+			if err := json.Unmarshal(data, &run); err != nil || runFinished(run.Status) {
+				return nil
+			}
+			// key 只在遍历期间有效，需要复制
+			runs = append(runs, interrupted{bucket: bucket, key: append([]byte{}, key...), run: run})
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range runs {
+		r.run.Status = models.RunStatusFailed
+		r.run.FailedAt = &now
+		r.run.LastError = &models.RunError{Code: "server_error", Message: "run was interrupted by a server restart"}
+		logrus.WithField("run", r.run.ID).Warn("Marking interrupted run as failed")
+		if err := putJSON(r.bucket, r.key, r.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkModel 检查模型是否在 MODELS 中，与聊天请求一样返回 model_not_found
+func (as *AssistantStore) checkModel(model string) error {
+	if !as.configs.Get().IsValidModel(model) {
+		return middleware.NewInvalidRequestError(fmt.Sprintf("Invalid model specified: %s", model), "model_not_found")
+	}
+	return nil
+}
+
+// runFinished 运行是否已结束
+func runFinished(status string) bool {
+	switch status {
+	case models.RunStatusCompleted, models.RunStatusFailed, models.RunStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CreateAssistant 创建助手
+func (as *AssistantStore) CreateAssistant(apiKey string, request *models.AssistantRequest) (*models.Assistant, error) {
+	if request.Model == nil || *request.Model == "" {
+		return nil, middleware.NewInvalidRequestError("model is required", "missing_model")
+	}
+	if err := as.checkModel(*request.Model); err != nil {
+		return nil, err
+	}
+	assistant := models.Assistant{
+		ID:        "asst_" + utils.GenerateRandomString(24),
+		Object:    "assistant",
+		CreatedAt: time.Now().Unix(),
+	}
+	applyAssistantRequest(&assistant, request)
+
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(assistantsBucket), []byte(assistant.ID), storedAssistant{Owner: ownerHash(apiKey), Assistant: assistant})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &assistant, nil
+}
+
+// GetAssistant 获取助手
+func (as *AssistantStore) GetAssistant(apiKey, id string) (*models.Assistant, error) {
+	var assistant *models.Assistant
+	err := as.db.View(func(tx *bolt.Tx) error {
+		stored, err := lookupAssistant(tx, apiKey, id)
+		if err == nil {
+			assistant = &stored.Assistant
+		}
+		return err
+	})
+	return assistant, err
+}
+
+// ListAssistants 分页列出调用方的助手
+func (as *AssistantStore) ListAssistants(apiKey string, opts ListOptions) ([]*models.Assistant, bool, error) {
+	owner := ownerHash(apiKey)
+	var all []*models.Assistant
+	err := as.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(assistantsBucket).ForEach(func(_, data []byte) error {
+			var stored storedAssistant
+			if err := json.Unmarshal(data, &stored); err == nil && stored.Owner == owner {
+				all = append(all, &stored.Assistant)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	// 键是随机 ID，按创建时间排序
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].CreatedAt != all[j].CreatedAt {
+			return all[i].CreatedAt < all[j].CreatedAt
+		}
+		return all[i].ID < all[j].ID
+	})
+	page, more := paginate(all, opts, func(a *models.Assistant) string { return a.ID })
+	return page, more, nil
+}
+
+// UpdateAssistant 修改助手，只更新请求中提供的字段
+func (as *AssistantStore) UpdateAssistant(apiKey, id string, request *models.AssistantRequest) (*models.Assistant, error) {
+	if request.Model != nil {
+		if *request.Model == "" {
+			return nil, middleware.NewInvalidRequestError("model must not be empty", "missing_model")
+		}
+		if err := as.checkModel(*request.Model); err != nil {
+			return nil, err
+		}
+	}
+	var assistant *models.Assistant
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		stored, err := lookupAssistant(tx, apiKey, id)
+		if err != nil {
+			return err
+		}
+		applyAssistantRequest(&stored.Assistant, request)
+		assistant = &stored.Assistant
+		return putJSON(tx.Bucket(assistantsBucket), []byte(id), stored)
+	})
+	return assistant, err
+}
+
+// DeleteAssistant 删除助手，已有的线程和运行记录不受影响
+func (as *AssistantStore) DeleteAssistant(apiKey, id string) error {
+	return as.db.Update(func(tx *bolt.Tx) error {
+		if _, err := lookupAssistant(tx, apiKey, id); err != nil {
+			return err
+		}
+		return tx.Bucket(assistantsBucket).Delete([]byte(id))
+	})
+}
+
+// CreateThread 创建线程，可同时添加初始消息
+func (as *AssistantStore) CreateThread(apiKey string, request *models.ThreadRequest) (*models.Thread, error) {
+	for _, message := range request.Messages {
+		if err := validateThreadMessage(&message); err != nil {
+			return nil, err
+		}
+	}
+	thread := models.Thread{
+		ID:        "thread_" + utils.GenerateRandomString(24),
+		Object:    "thread",
+		CreatedAt: time.Now().Unix(),
+		Metadata:  request.Metadata,
+	}
+
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		if err := putJSON(tx.Bucket(threadsBucket), []byte(thread.ID), storedThread{Owner: ownerHash(apiKey), Thread: thread}); err != nil {
+			return err
+		}
+		for _, message := range request.Messages {
+			if _, err := addThreadMessage(tx, thread.ID, newThreadMessage(thread.ID, &message)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &thread, nil
+}
+
+// GetThread 获取线程
+func (as *AssistantStore) GetThread(apiKey, id string) (*models.Thread, error) {
+	var thread *models.Thread
+	err := as.db.View(func(tx *bolt.Tx) error {
+		stored, err := lookupThread(tx, apiKey, id)
+		if err == nil {
+			thread = &stored.Thread
+		}
+		return err
+	})
+	return thread, err
+}
+
+// UpdateThread 修改线程元数据
+func (as *AssistantStore) UpdateThread(apiKey, id string, request *models.ThreadRequest) (*models.Thread, error) {
+	var thread *models.Thread
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		stored, err := lookupThread(tx, apiKey, id)
+		if err != nil {
+			return err
+		}
+		if request.Metadata != nil {
+			stored.Thread.Metadata = request.Metadata
+		}
+		thread = &stored.Thread
+		return putJSON(tx.Bucket(threadsBucket), []byte(id), stored)
+	})
+	return thread, err
+}
+
+// DeleteThread 删除线程及其消息和运行；有运行未结束时拒绝删除
+func (as *AssistantStore) DeleteThread(apiKey, id string) error {
+	return as.db.Update(func(tx *bolt.Tx) error {
+		if _, err := lookupThread(tx, apiKey, id); err != nil {
+			return err
+		}
+		if activeRunID(tx, id) != "" {
+			return ErrRunActive
+		}
+		for _, name := range [][]byte{messagesBucket, runsBucket} {
+			if tx.Bucket(name).Bucket([]byte(id)) != nil {
+				if err := tx.Bucket(name).DeleteBucket([]byte(id)); err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Bucket(threadsBucket).Delete([]byte(id))
+	})
+}
+
+// CreateMessage 向线程添加消息；有运行未结束时拒绝添加
+func (as *AssistantStore) CreateMessage(apiKey, threadID string, request *models.ThreadMessageRequest) (*models.ThreadMessage, error) {
+	if err := validateThreadMessage(request); err != nil {
+		return nil, err
+	}
+	message := newThreadMessage(threadID, request)
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		if _, err := lookupThread(tx, apiKey, threadID); err != nil {
+			return err
+		}
+		if activeRunID(tx, threadID) != "" {
+			return ErrRunActive
+		}
+		_, err := addThreadMessage(tx, threadID, message)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// GetMessage 获取线程中的消息
+func (as *AssistantStore) GetMessage(apiKey, threadID, id string) (*models.ThreadMessage, error) {
+	messages, err := as.threadMessages(apiKey, threadID)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		if message.ID == id {
+			return message, nil
+		}
+	}
+	return nil, ErrMessageNotFound
+}
+
+// ListMessages 分页列出线程中的消息，默认按创建顺序倒序
+func (as *AssistantStore) ListMessages(apiKey, threadID string, opts ListOptions) ([]*models.ThreadMessage, bool, error) {
+	messages, err := as.threadMessages(apiKey, threadID)
+	if err != nil {
+		return nil, false, err
+	}
+	page, more := paginate(messages, opts, func(m *models.ThreadMessage) string { return m.ID })
+	return page, more, nil
+}
+
+// threadMessages 按创建顺序返回线程中的全部消息
+func (as *AssistantStore) threadMessages(apiKey, threadID string) ([]*models.ThreadMessage, error) {
+	var messages []*models.ThreadMessage
+	err := as.db.View(func(tx *bolt.Tx) error {
+		if _, err := lookupThread(tx, apiKey, threadID); err != nil {
+			return err
+		}
+		bucket := tx.Bucket(messagesBucket).Bucket([]byte(threadID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, data []byte) error {
+			var message models.ThreadMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				return err
+			}
+			messages = append(messages, &message)
+			return nil
+		})
+	})
+	return messages, err
+}
+
+// Close 取消正在执行的运行并关闭数据库
+func (as *AssistantStore) Close() error {
+	as.mu.Lock()
+	for _, run := range as.active {
+		run.cancel()
+	}
+	as.mu.Unlock()
+	as.wg.Wait()
+	return as.db.Close()
+}
+
+// applyAssistantRequest 把请求中提供的字段写入助手
+func applyAssistantRequest(assistant *models.Assistant, request *models.AssistantRequest) {
+	if request.Model != nil {
+		assistant.Model = *request.Model
+	}
+	if request.Name != nil {
+		assistant.Name = *request.Name
+	}
+	if request.Description != nil {
+		assistant.Description = *request.Description
+	}
+	if request.Instructions != nil {
+		assistant.Instructions = *request.Instructions
+	}
+	if request.Metadata != nil {
+		assistant.Metadata = request.Metadata
+	}
+}
+
+// validateThreadMessage 线程消息只能是 user 或 assistant 的非空文本
+func validateThreadMessage(request *models.ThreadMessageRequest) error {
+	if request.Role != "user" && request.Role != "assistant" {
+		return middleware.NewInvalidRequestError("message role must be user or assistant", "invalid_role")
+	}
+	if strings.TrimSpace((&models.Message{Content: request.Content}).GetStringContent()) == "" {
+		return middleware.NewInvalidRequestError("message content must not be empty", "invalid_content")
+	}
+	return nil
+}
+
+// newThreadMessage 根据请求创建线程消息
+func newThreadMessage(threadID string, request *models.ThreadMessageRequest) *models.ThreadMessage {
+	return &models.ThreadMessage{
+		ID:        "msg_" + utils.GenerateRandomString(24),
+		Object:    "thread.message",
+		CreatedAt: time.Now().Unix(),
+		ThreadID:  threadID,
+		Status:    "completed",
+		Role:      request.Role,
+		Content:   models.TextContent((&models.Message{Content: request.Content}).GetStringContent()),
+		Metadata:  request.Metadata,
+	}
+}
+
+// addThreadMessage 把消息追加到线程的消息子桶
+func addThreadMessage(tx *bolt.Tx, threadID string, message *models.ThreadMessage) ([]byte, error) {
+	bucket, err := tx.Bucket(messagesBucket).CreateBucketIfNotExists([]byte(threadID))
+	if err != nil {
+		return nil, err
+	}
+	key, err := nextKey(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return key, putJSON(bucket, key, message)
+}
+
+// lookupAssistant 查找属于调用方的助手
+func lookupAssistant(tx *bolt.Tx, apiKey, id string) (*storedAssistant, error) {
+	data := tx.Bucket(assistantsBucket).Get([]byte(id))
+	var stored storedAssistant
+	if data == nil || json.Unmarshal(data, &stored) != nil || stored.Owner != ownerHash(apiKey) {
+		return nil, ErrAssistantNotFound
+	}
+	return &stored, nil
+}
+
+// lookupThread 查找属于调用方的线程
+func lookupThread(tx *bolt.Tx, apiKey, id string) (*storedThread, error) {
+	data := tx.Bucket(threadsBucket).Get([]byte(id))
+	var stored storedThread
+	if data == nil || json.Unmarshal(data, &stored) != nil || stored.Owner != ownerHash(apiKey) {
+		return nil, ErrThreadNotFound
+	}
+	return &stored, nil
+}
+
+// nextKey 生成子桶内按插入顺序排列的键
+func nextKey(bucket *bolt.Bucket) ([]byte, error) {
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key, nil
+}
+
+// putJSON 序列化后写入桶
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// paginate 对按创建顺序升序排列的对象分页，返回本页和是否还有更多
+func paginate[T any](items []T, opts ListOptions, id func(T) string) ([]T, bool) {
+	ordered := make([]T, len(items))
+	copy(ordered, items)
+	if opts.Desc {
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	}
+	if opts.After != "" {
+		for i, item := range ordered {
+			if id(item) == opts.After {
+				ordered = ordered[i+1:]
+				break
+			}
+		}
+	}
+	if opts.Limit > 0 && len(ordered) > opts.Limit {
+		return ordered[:opts.Limit], true
+	}
+	return ordered, false
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestAssistantStore(t *testing.T, path string, s *CursorService) *AssistantStore {
+	t.Helper()
+	as, err := NewAssistantStore(config.NewManager(&config.Config{AssistantsEnabled: true, AssistantsDBPath: path, Models: "model-a,model-b"}, ""), s)
+	if err != nil {
+		t.Fatalf("NewAssistantStore() error = %v", err)
+	}
+	return as
+}
+
+func TestAssistantRunStreamsAndSavesReply(t *testing.T) {
+	s := newReplayService(t, &config.Config{}, nil)
+	request := &models.ChatCompletionRequest{
+		Model:  "model-a",
+		Stream: true,
+		Messages: []models.Message{
+			{Role: "system", Content: "Be brief"},
+			{Role: "user", Content: "Hello"},
+		},
+	}
+	request.MaxTokens = models.ValidateMaxTokens(request.Model, nil)
+	recordCassette(s, request, delta("Hi ")+delta("there"))
+
+	path := filepath.Join(t.TempDir(), "assistants.db")
+	as := newTestAssistantStore(t, path, s)
+	model, instructions := "model-a", "Be brief"
+	assistant, err := as.CreateAssistant("key-a", &models.AssistantRequest{Model: &model, Instructions: &instructions})
+	if err != nil {
+		t.Fatalf("CreateAssistant() error = %v", err)
+	}
+	thread, err := as.CreateThread("key-a", &models.ThreadRequest{Messages: []models.ThreadMessageRequest{{Role: "user", Content: "Hello"}}})
+	if err != nil {
+		t.Fatalf("CreateThread() error = %v", err)
+	}
+
+	run, events, err := as.CreateRun(context.Background(), "key-a", thread.ID, &models.RunRequest{AssistantID: assistant.ID, Stream: true})
+	if err != nil {
+		t.Fatalf("CreateRun() error = %v", err)
+	}
+	var names []string
+	for event := range events {
+		names = append(names, event.Event)
+	}
+	want := []string{
+		"thread.run.created", "thread.run.queued", "thread.run.in_progress",
+		"thread.message.created", "thread.message.delta", "thread.message.delta", "thread.message.completed",
+		"thread.run.completed",
+	}
+	if len(names) != len(want) {
+		t.Fatalf("events = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("events = %v, want %v", names, want)
+		}
+	}
+
+	// 其他密钥看不到线程
+	if _, err := as.GetThread("key-b", thread.ID); !errors.Is(err, ErrThreadNotFound) {
+		t.Errorf("GetThread() with another key error = %v, want ErrThreadNotFound", err)
+	}
+	if err := as.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// 重新打开后运行和回复仍在
+	reopened := newTestAssistantStore(t, path, s)
+	defer reopened.Close()
+	got, err := reopened.GetRun("key-a", thread.ID, run.ID)
+	if err != nil || got.Status != models.RunStatusCompleted || got.CompletedAt == nil {
+		t.Fatalf("GetRun() = %+v, %v, want completed run", got, err)
+	}
+	messages, _, err := reopened.ListMessages("key-a", thread.ID, ListOptions{})
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("ListMessages() = %d messages, %v, want 2", len(messages), err)
+	}
+	if reply := messages[1]; reply.Role != "assistant" || reply.ContentText() != "Hi there" || reply.RunID != run.ID {
+		t.Errorf("reply = %+v, want assistant message %q", reply, "Hi there")
+	}
+}
+
+func TestAssistantRunFailsAndAllowsNextRun(t *testing.T) {
+	// 没有录制回放，上游调用失败
+	s := newReplayService(t, &config.Config{}, nil)
+	as := newTestAssistantStore(t, filepath.Join(t.TempDir(), "assistants.db"), s)
+	defer as.Close()
+
+	model := "model-a"
+	assistant, _ := as.CreateAssistant("key-a", &models.AssistantRequest{Model: &model})
+	thread, _ := as.CreateThread("key-a", &models.ThreadRequest{Messages: []models.ThreadMessageRequest{{Role: "user", Content: "Hello"}}})
+
+	_, events, err := as.CreateRun(context.Background(), "key-a", thread.ID, &models.RunRequest{AssistantID: assistant.ID, Stream: true})
+	if err != nil {
+		t.Fatalf("CreateRun() error = %v", err)
+	}
+	var last models.RunEvent
+	for event := range events {
+		last = event
+	}
+	if run, ok := last.Data.(models.Run); !ok || run.Status != models.RunStatusFailed || run.LastError == nil {
+		t.Fatalf("last event = %+v, want failed run", last)
+	}
+
+	// 运行结束后线程可以继续添加消息
+	if _, err := as.CreateMessage("key-a", thread.ID, &models.ThreadMessageRequest{Role: "user", Content: "Again"}); err != nil {
+		t.Errorf("CreateMessage() after failed run error = %v", err)
+	}
+}
+
+func TestAssistantStoreFailsInterruptedRuns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "assistants.db")
+	as := newTestAssistantStore(t, path, nil)
+	thread, _ := as.CreateThread("key-a", &models.ThreadRequest{})
+
+	// 模拟进程退出时仍在执行的运行
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(runsBucket).CreateBucketIfNotExists([]byte(thread.ID))
+		if err != nil {
+			return err
+		}
+		for _, id := range []string{"run_0", "run_1"} {
+			key, _ := nextKey(bucket)
+			if err := putJSON(bucket, key, models.Run{ID: id, Object: "thread.run", ThreadID: thread.ID, Status: models.RunStatusInProgress}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("db.Update() error = %v", err)
+	}
+	if _, err := as.CreateMessage("key-a", thread.ID, &models.ThreadMessageRequest{Role: "user", Content: "Hi"}); !errors.Is(err, ErrRunActive) {
+		t.Errorf("CreateMessage() during run error = %v, want ErrRunActive", err)
+	}
+	as.Close()
+
+	reopened := newTestAssistantStore(t, path, nil)
+	defer reopened.Close()
+	for _, id := range []string{"run_0", "run_1"} {
+		got, err := reopened.GetRun("key-a", thread.ID, id)
+		if err != nil || got.Status != models.RunStatusFailed || got.LastError == nil || got.LastError.Code != "server_error" {
+			t.Errorf("GetRun(%s) = %+v, %v, want failed run", id, got, err)
+		}
+	}
+}
+
+func TestAssistantStoreRejectsUnknownModels(t *testing.T) {
+	as := newTestAssistantStore(t, filepath.Join(t.TempDir(), "assistants.db"), nil)
+	defer as.Close()
+
+	var invalid *middleware.InvalidRequestError
+	unknown, valid := "model-x", "model-a"
+	if _, err := as.CreateAssistant("key-a", &models.AssistantRequest{Model: &unknown}); !errors.As(err, &invalid) || invalid.Code != "model_not_found" {
+		t.Errorf("CreateAssistant() error = %v, want model_not_found", err)
+	}
+	assistant, err := as.CreateAssistant("key-a", &models.AssistantRequest{Model: &valid})
+	if err != nil {
+		t.Fatalf("CreateAssistant() error = %v", err)
+	}
+	if _, err := as.UpdateAssistant("key-a", assistant.ID, &models.AssistantRequest{Model: &unknown}); !errors.As(err, &invalid) || invalid.Code != "model_not_found" {
+		t.Errorf("UpdateAssistant() error = %v, want model_not_found", err)
+	}
+
+	thread, _ := as.CreateThread("key-a", &models.ThreadRequest{})
+	_, _, err = as.CreateRun(context.Background(), "key-a", thread.ID, &models.RunRequest{AssistantID: assistant.ID, Model: unknown})
+	if !errors.As(err, &invalid) || invalid.Code != "model_not_found" {
+		t.Errorf("CreateRun() error = %v, want model_not_found", err)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// attachmentTruncatedMarker 附件被截断时追加的标记
+const attachmentTruncatedMarker = "\n... [truncated]"
+
+// PrepareAttachments 把消息中的 file / input_file 部分移到 request.Attachments（原位置留下附件名），
+// 再按上下文预算裁剪附件：附件总量不超过模型上下文窗口的 ATTACHMENT_CONTEXT_RATIO 减去消息本身
+// 和注入的系统提示、格式说明与预填充指令，超出时按水位线分配，小附件完整保留，大附件截断尾部。
+// 消息已占满预算时返回 InvalidRequestError。返回每个附件的裁剪结果
+func (s *CursorService) PrepareAttachments(request *models.ChatCompletionRequest) ([]models.AttachmentReport, error) {
+	if err := extractFileParts(request); err != nil {
+		return nil, err
+	}
+	if len(request.Attachments) == 0 {
+		return nil, nil
+	}
+
+	cfg := s.cfg()
+	budget := -1
+	if ratio := cfg.AttachmentContextRatio; ratio > 0 {
+		budget = int(float64(models.GetContextWindowForModel(request.Model)) * ratio)
+		for i := range request.Messages {
+			budget -= models.EstimateTokens(request.Messages[i].GetStringContent())
+		}
+		// buildCursorRequest 注入的文本同样占用上下文
+		budget -= models.EstimateTokens(cfg.SystemPromptInject)
+		budget -= models.EstimateTokens(request.ResponseFormat.Instructions())
+		if _, ok := models.Prefill(request.Messages); ok {
+			budget -= models.EstimateTokens(models.PrefillInstruction)
+		}
+		if budget <= 0 {
+			return nil, middleware.NewInvalidRequestError(
+				"the messages leave no room for attachments in the context window; shorten the conversation or send fewer files",
+				"context_length_exceeded")
+		}
+	}
+
+	reports := fitAttachments(request.Attachments, budget)
+	for _, report := range reports {
+		if report.Omitted {
+			logrus.WithFields(logrus.Fields{
+				"attachment": report.Name,
+				"tokens":     report.Tokens,
+			}).Warn("Attachment omitted, no context budget left")
+		} else if report.Truncated {
+			logrus.WithFields(logrus.Fields{
+				"attachment": report.Name,
+				"tokens":     report.Tokens,
+				"included":   report.IncludedTokens,
+			}).Warn("Attachment truncated to fit the context window")
+		}
+	}
+	return reports, nil
+}
+
+// extractFileParts 把消息中的文件部分解码为附件
+func extractFileParts(request *models.ChatCompletionRequest) error {
+	var messages []models.Message
+	for i := range request.Messages {
+		msg := request.Messages[i]
+		if len(msg.Files()) > 0 {
+			var parts []models.ContentPart
+			for _, part := range msg.ContentParts() {
+				if part.File == nil || (part.Type != "file" && part.Type != "input_file") {
+					parts = append(parts, part)
+					continue
+				}
+				if part.File.FileID != "" && part.File.FileData == "" {
+					return middleware.NewInvalidRequestError("file_id attachments are not supported, send file_data instead", "unsupported_attachment")
+				}
+				text, err := part.File.Text()
+				if err != nil || !utf8.ValidString(text) {
+					return middleware.NewInvalidRequestError(
+						fmt.Sprintf("attachment %q is not a text file", part.File.Filename), "unsupported_attachment")
+				}
+				name := part.File.Filename
+				if name == "" {
+					name = fmt.Sprintf("attachment-%d", len(request.Attachments)+1)
+				}
+				request.Attachments = append(request.Attachments, models.Attachment{Name: name, Content: text})
+				parts = append(parts, models.ContentPart{Type: "text", Text: "\n[Attached file: " + name + "]"})
+			}
+			msg.Content = parts
+		}
+		messages = append(messages, msg)
+	}
+	request.Messages = messages
+	return nil
+}
+
+// fitAttachments 按预算（token 数，-1 表示不限制）裁剪附件
+func fitAttachments(attachments []models.Attachment, budget int) []models.AttachmentReport {
+	reports := make([]models.AttachmentReport, len(attachments))
+	order := make([]int, len(attachments))
+	for i, attachment := range attachments {
+		tokens := models.EstimateTokens(attachment.Content)
+		reports[i] = models.AttachmentReport{Name: attachment.Name, Tokens: tokens, IncludedTokens: tokens}
+		order[i] = i
+	}
+	if budget < 0 {
+		return reports
+	}
+
+	// 从小到大分配，每个附件最多分到剩余预算的平均值
+	sort.SliceStable(order, func(a, b int) bool { return reports[order[a]].Tokens < reports[order[b]].Tokens })
+	remaining := budget
+	for k, i := range order {
+		share := remaining / (len(order) - k)
+		switch {
+		case reports[i].Tokens > 0 && share == 0:
+			// 预算分不到任何内容时整个省略，不发送只剩截断标记的空附件
+			attachments[i].Content = ""
+			reports[i].IncludedTokens = 0
+			reports[i].Truncated = true
+			reports[i].Omitted = true
+		case reports[i].Tokens > share:
+			attachments[i].Content = truncateBytes(attachments[i].Content, share*4) + attachmentTruncatedMarker
+			reports[i].IncludedTokens = share
+			reports[i].Truncated = true
+		}
+		remaining -= reports[i].IncludedTokens
+	}
+	return reports
+}
+
+// truncateBytes 截断到最多 n 字节，不切断多字节字符
+func truncateBytes(text string, n int) string {
+	if len(text) <= n {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
+
+// attachmentContext 把附件转换为 Cursor 请求的 context
+func attachmentContext(attachments []models.Attachment) []interface{} {
+	context := make([]interface{}, 0, len(attachments))
+	for _, attachment := range attachments {
+		// 内容为空（包括预算不足被省略）的附件不发送
+		if attachment.Content == "" {
+			continue
+		}
+		context = append(context, models.CursorContextFile{Type: "file", Name: attachment.Name, Content: attachment.Content})
+	}
+	return context
+}
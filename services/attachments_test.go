@@ -0,0 +1,158 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrepareAttachments(t *testing.T) {
+	s := newReplayService(t, &config.Config{}, nil)
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: []interface{}{
+		map[string]interface{}{"type": "text", "text": "Review these"},
+		map[string]interface{}{"type": "file", "file": map[string]interface{}{
+			"filename":  "main.go",
+			"file_data": "data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte("package main")),
+		}},
+		map[string]interface{}{"type": "input_file", "filename": "README.md", "file_data": "# Title"},
+	}}}
+	request.Attachments = []models.Attachment{{Name: "notes.txt", Content: "extra"}}
+
+	reports, err := s.PrepareAttachments(request)
+	if err != nil {
+		t.Fatalf("PrepareAttachments() error = %v", err)
+	}
+	if len(reports) != 3 || reports[0].Truncated {
+		t.Errorf("reports = %+v, want 3 untruncated attachments", reports)
+	}
+
+	payload := s.buildCursorRequest(request)
+	if got := payload.Messages[0].Parts[0].Text; got != "Review these\n[Attached file: main.go]\n[Attached file: README.md]" {
+		t.Errorf("message text = %q", got)
+	}
+	want := []interface{}{
+		models.CursorContextFile{Type: "file", Name: "notes.txt", Content: "extra"},
+		models.CursorContextFile{Type: "file", Name: "main.go", Content: "package main"},
+		models.CursorContextFile{Type: "file", Name: "README.md", Content: "# Title"},
+	}
+	if len(payload.Context) != len(want) {
+		t.Fatalf("context = %+v, want %+v", payload.Context, want)
+	}
+	for i := range want {
+		if payload.Context[i] != want[i] {
+			t.Errorf("context[%d] = %+v, want %+v", i, payload.Context[i], want[i])
+		}
+	}
+}
+
+func TestPrepareAttachmentsRejectsBinary(t *testing.T) {
+	s := newReplayService(t, &config.Config{}, nil)
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: []interface{}{
+		map[string]interface{}{"type": "file", "file": map[string]interface{}{
+			"filename":  "logo.bin",
+			"file_data": "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe, 0x00}),
+		}},
+	}}}
+
+	_, err := s.PrepareAttachments(request)
+	var invalid *middleware.InvalidRequestError
+	if !errors.As(err, &invalid) || invalid.Code != "unsupported_attachment" {
+		t.Errorf("PrepareAttachments() error = %v, want unsupported_attachment", err)
+	}
+}
+
+func TestPrepareAttachmentsBudget(t *testing.T) {
+	attachmentRequest := func(messageBytes int) *models.ChatCompletionRequest {
+		request := fallbackTestRequest("model-a")
+		request.Messages = []models.Message{{Role: "user", Content: strings.Repeat("m", messageBytes)}}
+		request.Attachments = []models.Attachment{{Name: "notes.txt", Content: strings.Repeat("n", 4000)}}
+		return request
+	}
+
+	// model-a 不在注册表中，上下文窗口按 128000 token 计算，预算为 1280
+	s := newReplayService(t, &config.Config{AttachmentContextRatio: 0.01}, nil)
+	_, err := s.PrepareAttachments(attachmentRequest(1280 * 4))
+	var invalid *middleware.InvalidRequestError
+	if !errors.As(err, &invalid) || invalid.Code != "context_length_exceeded" {
+		t.Errorf("PrepareAttachments() error = %v, want context_length_exceeded", err)
+	}
+
+	// response_format 的格式说明同样计入预算
+	request := attachmentRequest(1000 * 4)
+	request.ResponseFormat = &models.ResponseFormat{Type: models.ResponseFormatJSONObject}
+	reports, err := s.PrepareAttachments(request)
+	if err != nil {
+		t.Fatalf("PrepareAttachments() error = %v", err)
+	}
+	instructions := models.EstimateTokens(request.ResponseFormat.Instructions())
+	if got, want := reports[0].IncludedTokens, 280-instructions; got != want {
+		t.Errorf("included = %d, want %d", got, want)
+	}
+}
+
+func TestFitAttachmentsOmitsZeroShare(t *testing.T) {
+	attachments := []models.Attachment{
+		{Name: "a", Content: strings.Repeat("a", 40)},
+		{Name: "b", Content: strings.Repeat("b", 40)},
+	}
+	reports := fitAttachments(attachments, 1)
+	if !reports[0].Omitted || reports[0].IncludedTokens != 0 || attachments[0].Content != "" {
+		t.Errorf("reports[0] = %+v, want the attachment omitted", reports[0])
+	}
+	if len(attachmentContext(attachments)) != 1 {
+		t.Error("omitted attachments should not be sent")
+	}
+}
+
+func TestFitAttachments(t *testing.T) {
+	attachments := []models.Attachment{
+		{Name: "big", Content: strings.Repeat("a", 400)},  // 100 tokens
+		{Name: "small", Content: strings.Repeat("b", 40)}, // 10 tokens
+		{Name: "mid", Content: strings.Repeat("c", 200)},  // 50 tokens
+	}
+
+	// 预算 90：small 完整保留，剩余 80 由 mid 和 big 平分
+	reports := fitAttachments(attachments, 90)
+	want := []models.AttachmentReport{
+		{Name: "big", Tokens: 100, IncludedTokens: 40, Truncated: true},
+		{Name: "small", Tokens: 10, IncludedTokens: 10},
+		{Name: "mid", Tokens: 50, IncludedTokens: 40, Truncated: true},
+	}
+	for i := range want {
+		if reports[i] != want[i] {
+			t.Errorf("reports[%d] = %+v, want %+v", i, reports[i], want[i])
+		}
+	}
+	if got := attachments[0].Content; got != strings.Repeat("a", 160)+attachmentTruncatedMarker {
+		t.Errorf("truncated content = %q", got)
+	}
+	if attachments[1].Content != strings.Repeat("b", 40) {
+		t.Error("small attachment should be kept whole")
+	}
+}
@@ -0,0 +1,331 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// builtinRedactRules 内置脱敏规则
+var builtinRedactRules = map[string]*regexp.Regexp{
+	"email":   regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	"api_key": regexp.MustCompile(`(?i)\b(?:sk|pk|rk|ak)-[A-Za-z0-9_\-]{16,}|\bBearer\s+[A-Za-z0-9._\-]{8,}|\bAKIA[0-9A-Z]{16}\b|\bgh[pousr]_[A-Za-z0-9]{20,}`),
+	"phone":   regexp.MustCompile(`(?:\+?\d{1,3}[\s\-.]?)?(?:\(\d{2,4}\)[\s\-.]?|\d{2,4}[\s\-.])\d{3,4}[\s\-.]?\d{3,4}\b|\b1[3-9]\d{9}\b`),
+}
+
+// redactRule 单条脱敏规则
+type redactRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// Redactor 在写入审计日志前对文本进行脱敏
+type Redactor struct {
+	rules []redactRule
+}
+
+// NewRedactor 根据内置规则名称和自定义正则创建脱敏器
+func NewRedactor(ruleNames, patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, name := range ruleNames {
+		pattern, ok := builtinRedactRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown redact rule: %s", name)
+		}
+		r.rules = append(r.rules, redactRule{name: name, pattern: pattern})
+	}
+	for i, expr := range patterns {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", expr, err)
+		}
+		r.rules = append(r.rules, redactRule{name: fmt.Sprintf("custom_%d", i+1), pattern: pattern})
+	}
+	return r, nil
+}
+
+// RedactString 对单个字符串应用所有脱敏规则
+func (r *Redactor) RedactString(s string) string {
+	for _, rule := range r.rules {
+		s = rule.pattern.ReplaceAllString(s, "[REDACTED:"+rule.name+"]")
+	}
+	return s
+}
+
+// redactValue 递归脱敏 JSON 解码后的任意值
+func (r *Redactor) redactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		return r.RedactString(val)
+	case []interface{}:
+		for i := range val {
+			val[i] = r.redactValue(val[i])
+		}
+		return val
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = r.redactValue(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// AuditRecord 单条审计记录
+type AuditRecord struct {
+	Time          time.Time            `json:"time"`
+	RequestID     string               `json:"request_id"`
+	APIKey        string               `json:"api_key"`
+	Model         string               `json:"model"`
+	Stream        bool                 `json:"stream"`
+	Messages      []models.Message     `json:"messages"`
+	CursorRequest models.CursorRequest `json:"cursor_request"`
+	Completion    string               `json:"completion"`
+	Usage         *models.Usage        `json:"usage,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	DurationMs    int64                `json:"duration_ms"`
+}
+
+// AuditLogger 将审计记录写入按大小轮转的 JSONL 文件
+type AuditLogger struct {
+	configs  *config.Manager
+	redactor *Redactor
+	dir      string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	seq  int
+	rng  *rand.Rand
+}
+
+// NewAuditLogger 创建审计日志记录器，未启用时返回 nil
+// 采样率和退出名单每次请求时读取，支持热重载
+func NewAuditLogger(configs *config.Manager) (*AuditLogger, error) {
+	cfg := configs.Get()
+	if !cfg.AuditEnabled {
+		return nil, nil
+	}
+
+	redactor, err := NewRedactor(cfg.GetAuditRedactRules(), cfg.GetAuditRedactPatterns())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(cfg.AuditDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create audit dir: %w", err)
+	}
+
+	maxSize := int64(cfg.AuditMaxSizeMB) * 1024 * 1024
+	if maxSize <= 0 {
+		maxSize = 100 * 1024 * 1024
+	}
+
+	return &AuditLogger{
+		configs:  configs,
+		redactor: redactor,
+		dir:      cfg.AuditDir,
+		maxSize:  maxSize,
+		maxFiles: cfg.AuditMaxFiles,
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// shouldRecord 根据密钥退出名单和采样率决定是否记录本次请求
+func (a *AuditLogger) shouldRecord(apiKey string) bool {
+	cfg := a.configs.Get()
+	if cfg.IsAuditOptOut(apiKey) {
+		return false
+	}
+	if cfg.AuditSampleRate >= 1 {
+		return true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rng.Float64() < cfg.AuditSampleRate
+}
+
+// newRecord 创建一条审计记录，本次请求不需要记录时返回 nil
+func (a *AuditLogger) newRecord(ctx context.Context, request *models.ChatCompletionRequest, payload models.CursorRequest) *AuditRecord {
+	apiKey := middleware.APIKeyFromContext(ctx)
+	if !a.shouldRecord(apiKey) {
+		return nil
+	}
+	return &AuditRecord{
+		Time:          time.Now(),
+		RequestID:     payload.ID,
+		APIKey:        maskKey(apiKey),
+		Model:         request.Model,
+		Stream:        request.Stream,
+		Messages:      request.Messages,
+		CursorRequest: payload,
+	}
+}
+
+// Wrap 包装输出流，在流结束后写入一条包含完整回复的审计记录
+func (a *AuditLogger) Wrap(ctx context.Context, request *models.ChatCompletionRequest, payload models.CursorRequest, in <-chan interface{}) <-chan interface{} {
+	record := a.newRecord(ctx, request, payload)
+	if record == nil {
+		return in
+	}
+
+	var completion strings.Builder
+
+	observe := func(item interface{}) {
+		switch v := item.(type) {
+		case string:
+			completion.WriteString(v)
+		case models.Usage:
+			usage := v
+			record.Usage = &usage
+		case error:
+			record.Error = v.Error()
+		}
+	}
+
+	done := func() {
+		record.Completion = completion.String()
+		record.DurationMs = time.Since(record.Time).Milliseconds()
+		if err := a.write(record); err != nil {
+			logrus.WithError(err).Warn("Failed to write audit record")
+		}
+	}
+
+	return teeStream(ctx, in, observe, done)
+}
+
+// Log 为非流式的完整结果写入一条审计记录，start 为请求开始时间
+func (a *AuditLogger) Log(ctx context.Context, request *models.ChatCompletionRequest, payload models.CursorRequest, start time.Time, completion string, usage models.Usage, err error) {
+	record := a.newRecord(ctx, request, payload)
+	if record == nil {
+		return
+	}
+	record.Time = start
+	record.Completion = completion
+	record.Usage = &usage
+	if err != nil {
+		record.Error = err.Error()
+	}
+	record.DurationMs = time.Since(start).Milliseconds()
+	if err := a.write(record); err != nil {
+		logrus.WithError(err).Warn("Failed to write audit record")
+	}
+}
+
+// write 脱敏并追加一条记录，必要时轮转文件
+func (a *AuditLogger) write(record *AuditRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+
+	// 先解码成通用结构再逐个字符串脱敏，保证输出仍是合法 JSON
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return fmt.Errorf("failed to decode audit record: %w", err)
+	}
+	line, err := json.Marshal(a.redactor.redactValue(generic))
+	if err != nil {
+		return fmt.Errorf("failed to marshal redacted audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil || a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	return err
+}
+
+// rotate 关闭当前文件并打开新文件，清理超出保留数量的旧文件
+func (a *AuditLogger) rotate() error {
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+
+	// 序号保证同一毫秒内多次轮转也不会写回同一个文件
+	a.seq++
+	name := filepath.Join(a.dir, fmt.Sprintf("audit-%s-%04d.jsonl", time.Now().Format("20060102-150405.000"), a.seq%10000))
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %w", err)
+	}
+	a.file = file
+	a.size = 0
+
+	if a.maxFiles > 0 {
+		files, _ := filepath.Glob(filepath.Join(a.dir, "audit-*.jsonl"))
+		sort.Strings(files)
+		for len(files) > a.maxFiles {
+			os.Remove(files[0])
+			files = files[1:]
+		}
+	}
+
+	return nil
+}
+
+// Close 关闭当前审计文件
+func (a *AuditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// maskKey 掩码 API 密钥，只保留前 4 位
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "****"
+	}
+	return key[:4] + "****"
+}
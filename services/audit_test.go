@@ -0,0 +1,163 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"bufio"
+	"context"
+	"cursor2api-go/config"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+	redactor, err := NewRedactor([]string{"email", "api_key", "phone"}, []string{`secret-\d+`})
+	if err != nil {
+		t.Fatalf("NewRedactor() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		contains string
+		hidden   string
+	}{
+		{"email", "mail me at alice@example.com", "[REDACTED:email]", "alice@example.com"},
+		{"api key", "key sk-abcdefghijklmnopqrstuvwx", "[REDACTED:api_key]", "sk-abcdefghijklmnopqrstuvwx"},
+		{"bearer token", "Authorization: Bearer abcdef123456", "[REDACTED:api_key]", "abcdef123456"},
+		{"phone", "call +1 415-555-0132", "[REDACTED:phone]", "555-0132"},
+		{"mobile", "手机 13812345678", "[REDACTED:phone]", "13812345678"},
+		{"custom", "token secret-42 here", "[REDACTED:custom_1]", "secret-42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := redactor.RedactString(tt.input)
+			if !strings.Contains(result, tt.contains) || strings.Contains(result, tt.hidden) {
+				t.Errorf("RedactString(%q) = %q", tt.input, result)
+			}
+		})
+	}
+}
+
+func TestNewRedactorUnknownRule(t *testing.T) {
+	if _, err := NewRedactor([]string{"ssn"}, nil); err == nil {
+		t.Error("NewRedactor() expected error for unknown rule")
+	}
+}
+
+func TestAuditLoggerWriteAndRotate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		AuditEnabled:     true,
+		AuditDir:         dir,
+		AuditMaxSizeMB:   1,
+		AuditMaxFiles:    2,
+		AuditSampleRate:  1,
+		AuditRedactRules: "email",
+	}
+
+	logger, err := NewAuditLogger(config.NewManager(cfg, ""))
+	if err != nil {
+		t.Fatalf("NewAuditLogger() error = %v", err)
+	}
+	defer logger.Close()
+	logger.maxSize = 512
+
+	for i := 0; i < 5; i++ {
+		record := &AuditRecord{Model: "test", Completion: strings.Repeat("x", 300) + " bob@example.com"}
+		if err := logger.write(record); err != nil {
+			t.Fatalf("write() error = %v", err)
+		}
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if len(files) != 2 {
+		t.Fatalf("audit files = %d, want 2", len(files))
+	}
+
+	file, err := os.Open(files[len(files)-1])
+	if err != nil {
+		t.Fatalf("open audit file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid JSONL line: %v", err)
+		}
+		if strings.Contains(record.Completion, "bob@example.com") {
+			t.Errorf("email not redacted: %s", record.Completion)
+		}
+	}
+}
+
+func TestAuditLoggerDisabled(t *testing.T) {
+	logger, err := NewAuditLogger(config.NewManager(&config.Config{}, ""))
+	if err != nil || logger != nil {
+		t.Errorf("NewAuditLogger() = %v, %v, want nil, nil", logger, err)
+	}
+}
+
+func TestCompleteWritesOneAuditRecord(t *testing.T) {
+	dir := t.TempDir()
+	s := newReplayService(t, &config.Config{ModelFallbacks: "model-a->model-b"}, map[string]string{
+		// model-a 没有录制，回退到 model-b；回退尝试不应各写一条记录
+		"model-b": "data: {\"type\":\"text-delta\",\"delta\":\"Hi\"}\n\n",
+	})
+	logger, err := NewAuditLogger(config.NewManager(&config.Config{AuditEnabled: true, AuditDir: dir, AuditSampleRate: 1}, ""))
+	if err != nil {
+		t.Fatalf("NewAuditLogger() error = %v", err)
+	}
+	s.audit = logger
+
+	completion, err := s.Complete(context.Background(), fallbackTestRequest("model-a"))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	collectText(completion.Stream)
+	logger.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("audit files = %d, want 1", len(files))
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("read audit file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("audit records = %d, want 1", len(lines))
+	}
+	var record AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid JSONL line: %v", err)
+	}
+	if record.Model != "model-a" || record.Completion != "Hi" {
+		t.Errorf("record = %s/%q, want model-a/%q", record.Model, record.Completion, "Hi")
+	}
+}
@@ -0,0 +1,661 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrBatchNotFound 批处理不存在或不属于调用方
+var ErrBatchNotFound = errors.New("batch not found")
+
+// ErrBatchNotCancellable 批处理已结束，不能取消
+var ErrBatchNotCancellable = errors.New("batch is not cancellable")
+
+// batchEndpoint 批处理支持的接口
+const batchEndpoint = "/v1/chat/completions"
+
+// batchCompletionWindow 批处理支持的完成时限
+const batchCompletionWindow = "24h"
+
+// maxBatchErrors 输入文件校验失败时最多列出的错误数
+const maxBatchErrors = 100
+
+var (
+	errBatchCancelled = errors.New("batch cancelled")
+	errBatchStopped   = errors.New("batch store closed")
+)
+
+// storedBatch 磁盘上保存的批处理；结果文件 ID 在创建时预先分配，结束时才对外公开
+type storedBatch struct {
+	Owner        string       `json:"owner"`
+	Batch        models.Batch `json:"batch"`
+	OutputFileID string       `json:"output_file"`
+	ErrorFileID  string       `json:"error_file"`
+}
+
+// batchLine 校验通过的输入行
+type batchLine struct {
+	CustomID string
+	Request  *models.ChatCompletionRequest
+}
+
+// BatchStore 异步批处理：后台按 BATCH_CONCURRENCY 逐行调用 Cursor 服务，
+// 每行的结果和错误追加写入结果文件，进程重启后跳过已完成的行继续执行
+type BatchStore struct {
+	configs *config.Manager
+	service *CursorService
+	files   *FileStore
+	dir     jsonDir
+	slots   chan struct{} // 所有批处理共享的并发槽位
+
+	ctx  context.Context // 关闭时取消全部批处理
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	items   map[string]*storedBatch
+	cancels map[string]context.CancelCauseFunc
+}
+
+// NewBatchStore 创建批处理存储，加载已有批处理并继续执行未结束的批处理；未启用时返回 nil
+func NewBatchStore(configs *config.Manager, service *CursorService, files *FileStore) (*BatchStore, error) {
+	cfg := configs.Get()
+	if !cfg.BatchEnabled {
+		return nil, nil
+	}
+	dir, err := openJSONDir(filepath.Join(cfg.BatchDir, "batches"), "batch")
+	if err != nil {
+		return nil, err
+	}
+	items, err := loadJSONDir(dir, "batch", func(b *storedBatch) string { return b.Batch.ID })
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	bs := &BatchStore{
+		configs: configs,
+		service: service,
+		files:   files,
+		dir:     dir,
+		slots:   make(chan struct{}, max(cfg.BatchConcurrency, 1)),
+		ctx:     ctx,
+		stop:    stop,
+		items:   items,
+		cancels: make(map[string]context.CancelCauseFunc),
+	}
+
+	// 上次退出时未结束的批处理继续执行：按保存的调用方哈希找回 API 密钥，缓存、限流和审计仍按调用方区分；
+	// 密钥已从配置中移除的批处理不再执行
+	for id, stored := range bs.items {
+		if batchFinished(stored.Batch.Status) {
+			continue
+		}
+		apiKey, ok := ownerKey(cfg, stored.Owner)
+		if !ok {
+			logrus.WithField("batch", id).Warn("API key of batch is no longer configured, failing batch")
+			bs.update(id, func(batch *models.Batch) {
+				now := time.Now().Unix()
+				batch.Status = models.BatchStatusFailed
+				batch.FailedAt = &now
+				batch.Errors = &models.BatchErrors{Object: "list", Data: []models.BatchError{{
+					Code:    "api_key_revoked",
+					Message: "the API key that created this batch is no longer configured",
+				}}}
+			})
+			continue
+		}
+		logrus.WithField("batch", id).Info("Resuming batch")
+		bs.start(middleware.WithAPIKey(context.Background(), apiKey), id)
+	}
+	return bs, nil
+}
+
+// batchFinished 批处理是否已结束
+func batchFinished(status string) bool {
+	switch status {
+	case models.BatchStatusFailed, models.BatchStatusCompleted, models.BatchStatusExpired, models.BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Create 以上传的输入文件创建批处理并在后台执行
+func (bs *BatchStore) Create(ctx context.Context, apiKey string, request *models.BatchRequest) (*models.Batch, error) {
+	if request.Endpoint != batchEndpoint {
+		return nil, middleware.NewInvalidRequestError(fmt.Sprintf("endpoint must be %s", batchEndpoint), "invalid_endpoint")
+	}
+	if request.CompletionWindow != batchCompletionWindow {
+		return nil, middleware.NewInvalidRequestError(fmt.Sprintf("completion_window must be %s", batchCompletionWindow), "invalid_completion_window")
+	}
+	file, err := bs.files.Get(apiKey, request.InputFileID)
+	if err != nil {
+		return nil, err
+	}
+	if file.Purpose != "batch" {
+		return nil, middleware.NewInvalidRequestError("input file must be uploaded with purpose batch", "invalid_input_file")
+	}
+
+	now := time.Now()
+	stored := &storedBatch{
+		Owner: ownerHash(apiKey),
+		Batch: models.Batch{
+			ID:               "batch_" + utils.GenerateRandomString(24),
+			Object:           "batch",
+			Endpoint:         request.Endpoint,
+			InputFileID:      request.InputFileID,
+			CompletionWindow: request.CompletionWindow,
+			Status:           models.BatchStatusValidating,
+			CreatedAt:        now.Unix(),
+			ExpiresAt:        now.Add(24 * time.Hour).Unix(),
+			Metadata:         request.Metadata,
+		},
+		OutputFileID: "file-" + utils.GenerateRandomString(24),
+		ErrorFileID:  "file-" + utils.GenerateRandomString(24),
+	}
+
+	bs.mu.Lock()
+	if err := bs.save(stored); err != nil {
+		bs.mu.Unlock()
+		return nil, err
+	}
+	bs.items[stored.Batch.ID] = stored
+	batch := stored.Batch
+	bs.mu.Unlock()
+
+	bs.start(ctx, batch.ID)
+	return &batch, nil
+}
+
+// Get 获取批处理及其进度
+func (bs *BatchStore) Get(apiKey, id string) (*models.Batch, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	stored, err := bs.lookup(apiKey, id)
+	if err != nil {
+		return nil, err
+	}
+	batch := stored.Batch
+	return &batch, nil
+}
+
+// List 按创建时间倒序分页列出调用方的批处理
+func (bs *BatchStore) List(apiKey string, opts ListOptions) ([]*models.Batch, bool) {
+	owner := ownerHash(apiKey)
+	bs.mu.Lock()
+	var all []*models.Batch
+	for _, stored := range bs.items {
+		if stored.Owner == owner {
+			batch := stored.Batch
+			all = append(all, &batch)
+		}
+	}
+	bs.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].CreatedAt != all[j].CreatedAt {
+			return all[i].CreatedAt < all[j].CreatedAt
+		}
+		return all[i].ID < all[j].ID
+	})
+	return paginate(all, opts, func(b *models.Batch) string { return b.ID })
+}
+
+// Cancel 取消未结束的批处理：正在执行的请求被中止，已完成的结果仍写入结果文件
+func (bs *BatchStore) Cancel(apiKey, id string) (*models.Batch, error) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	stored, err := bs.lookup(apiKey, id)
+	if err != nil {
+		return nil, err
+	}
+	if status := stored.Batch.Status; status != models.BatchStatusValidating && status != models.BatchStatusInProgress {
+		return nil, ErrBatchNotCancellable
+	}
+
+	updated := *stored
+	now := time.Now().Unix()
+	updated.Batch.Status = models.BatchStatusCancelling
+	updated.Batch.CancellingAt = &now
+	if err := bs.save(&updated); err != nil {
+		return nil, err
+	}
+	bs.items[id] = &updated
+	if cancel, ok := bs.cancels[id]; ok {
+		cancel(errBatchCancelled)
+	}
+	batch := updated.Batch
+	return &batch, nil
+}
+
+// Close 停止全部批处理，未结束的批处理在下次启动时继续
+func (bs *BatchStore) Close() {
+	bs.stop()
+	bs.wg.Wait()
+}
+
+// start 在后台执行批处理。批处理保留请求中的调用方信息，但不随请求取消，并以 low 优先级排队
+func (bs *BatchStore) start(ctx context.Context, id string) {
+	runCtx, cancel := context.WithCancelCause(WithPriority(context.WithoutCancel(ctx), "low"))
+	stopOnClose := context.AfterFunc(bs.ctx, func() { cancel(errBatchStopped) })
+
+	bs.mu.Lock()
+	bs.cancels[id] = cancel
+	bs.mu.Unlock()
+
+	bs.wg.Add(1)
+	go func() {
+		defer bs.wg.Done()
+		defer func() {
+			stopOnClose()
+			cancel(nil)
+			bs.mu.Lock()
+			delete(bs.cancels, id)
+			bs.mu.Unlock()
+		}()
+		bs.run(runCtx, id)
+	}()
+}
+
+// run 校验输入文件，逐行执行请求，最后公开结果文件
+func (bs *BatchStore) run(ctx context.Context, id string) {
+	stored := bs.snapshot(id)
+	if stored.Batch.Status == models.BatchStatusCancelling {
+		// 取消后、结束前进程退出
+		bs.finalize(id, false)
+		return
+	}
+	ctx, cancelDeadline := context.WithDeadline(ctx, time.Unix(stored.Batch.ExpiresAt, 0))
+	defer cancelDeadline()
+
+	lines, validationErrors, err := bs.readInput(stored.Batch.InputFileID)
+	if err != nil {
+		validationErrors = []models.BatchError{{Code: "invalid_input_file", Message: err.Error()}}
+	}
+	if len(validationErrors) > 0 {
+		bs.update(id, func(batch *models.Batch) {
+			now := time.Now().Unix()
+			batch.Status = models.BatchStatusFailed
+			batch.FailedAt = &now
+			batch.Errors = &models.BatchErrors{Object: "list", Data: validationErrors}
+		})
+		return
+	}
+
+	// 重启后跳过结果文件中已有的行，进度按结果文件重新统计
+	done := make(map[string]bool)
+	completed := bs.countResults(stored.OutputFileID, done)
+	failed := bs.countResults(stored.ErrorFileID, done)
+	bs.update(id, func(batch *models.Batch) {
+		if batch.Status == models.BatchStatusValidating {
+			now := time.Now().Unix()
+			batch.Status = models.BatchStatusInProgress
+			batch.InProgressAt = &now
+		}
+		batch.RequestCounts = models.BatchRequestCounts{Total: len(lines), Completed: completed, Failed: failed}
+	})
+
+	output, err := os.OpenFile(bs.files.contentPath(stored.OutputFileID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		logrus.WithError(err).WithField("batch", id).Error("Failed to open batch output file")
+		return
+	}
+	defer output.Close()
+	errorsFile, err := os.OpenFile(bs.files.contentPath(stored.ErrorFileID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		logrus.WithError(err).WithField("batch", id).Error("Failed to open batch error file")
+		return
+	}
+	defer errorsFile.Close()
+
+	var (
+		wg      sync.WaitGroup
+		writeMu sync.Mutex
+	)
+lines:
+	for _, line := range lines {
+		if done[line.CustomID] {
+			continue
+		}
+		select {
+		case bs.slots <- struct{}{}:
+		case <-ctx.Done():
+			break lines
+		}
+
+		wg.Add(1)
+		go func(line batchLine) {
+			defer wg.Done()
+			defer func() { <-bs.slots }()
+			result, ok := bs.process(ctx, line)
+			if ctx.Err() != nil {
+				// 被取消或超时中止的请求不记录结果
+				return
+			}
+
+			data, _ := json.Marshal(result)
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			target := output
+			if !ok {
+				target = errorsFile
+			}
+			if _, err := target.Write(append(data, '\n')); err != nil {
+				logrus.WithError(err).WithField("batch", id).Error("Failed to write batch result")
+				return
+			}
+			bs.update(id, func(batch *models.Batch) {
+				if ok {
+					batch.RequestCounts.Completed++
+				} else {
+					batch.RequestCounts.Failed++
+				}
+			})
+		}(line)
+	}
+	wg.Wait()
+
+	if errors.Is(context.Cause(ctx), errBatchStopped) {
+		return
+	}
+	bs.finalize(id, errors.Is(ctx.Err(), context.DeadlineExceeded))
+}
+
+// process 执行一行请求，返回结果行以及是否成功
+func (bs *BatchStore) process(ctx context.Context, line batchLine) (models.BatchOutputLine, bool) {
+	result := models.BatchOutputLine{ID: "batch_req_" + utils.GenerateRandomString(24), CustomID: line.CustomID}
+	request := *line.Request
+	request.MaxTokens = models.ValidateMaxTokens(request.Model, request.MaxTokens)
+
+	response, err := bs.complete(ctx, &request)
+	if err != nil {
+		code := "server_error"
+		var invalid *middleware.InvalidRequestError
+		if errors.As(err, &invalid) {
+			code = invalid.Code
+		}
+		result.Error = &models.BatchLineError{Code: code, Message: err.Error()}
+		return result, false
+	}
+	result.Response = &models.BatchLineResponse{
+		StatusCode: 200,
+		RequestID:  utils.GenerateRandomString(24),
+		Body:       response,
+	}
+	return result, true
+}
+
+// complete 调用 Cursor 服务并收集完整回复
+func (bs *BatchStore) complete(ctx context.Context, request *models.ChatCompletionRequest) (*models.ChatCompletionResponse, error) {
+	if _, err := bs.service.PrepareAttachments(request); err != nil {
+		return nil, err
+	}
+	completion, err := bs.service.Complete(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		content strings.Builder
+		choices []*strings.Builder
+		usage   models.Usage
+		failure error
+	)
+	for item := range completion.Stream {
+		switch v := item.(type) {
+		case string:
+			content.WriteString(v)
+		case models.ChoiceChunk:
+			for len(choices) <= v.Index {
+				choices = append(choices, &strings.Builder{})
+			}
+			choices[v.Index].WriteString(v.Content)
+		case models.Usage:
+			usage = v
+		case error:
+			failure = v
+		}
+	}
+	if failure != nil {
+		return nil, failure
+	}
+
+	id := utils.GenerateChatCompletionID()
+	if len(choices) > 0 {
+		contents := make([]string, len(choices))
+		for i := range choices {
+			contents[i] = choices[i].String()
+		}
+		return models.NewChatCompletionChoicesResponse(id, completion.Model, contents, usage), nil
+	}
+	return models.NewChatCompletionResponse(id, completion.Model, content.String(), usage), nil
+}
+
+// finalize 公开非空的结果文件并把批处理标记为结束
+func (bs *BatchStore) finalize(id string, expired bool) {
+	stored := bs.update(id, func(batch *models.Batch) {
+		if batch.Status != models.BatchStatusCancelling {
+			now := time.Now().Unix()
+			batch.Status = models.BatchStatusFinalizing
+			batch.FinalizingAt = &now
+		}
+	})
+
+	var outputID, errorID *string
+	for _, file := range []struct {
+		id     string
+		suffix string
+		target **string
+	}{
+		{stored.OutputFileID, "output", &outputID},
+		{stored.ErrorFileID, "error", &errorID},
+	} {
+		path := bs.files.contentPath(file.id)
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			os.Remove(path)
+			continue
+		}
+		if _, err := bs.files.register(stored.Owner, file.id, fmt.Sprintf("%s_%s.jsonl", id, file.suffix), "batch_output"); err != nil {
+			logrus.WithError(err).WithField("batch", id).Error("Failed to register batch result file")
+			continue
+		}
+		fileID := file.id
+		*file.target = &fileID
+	}
+
+	bs.update(id, func(batch *models.Batch) {
+		now := time.Now().Unix()
+		batch.OutputFileID = outputID
+		batch.ErrorFileID = errorID
+		switch {
+		case batch.Status == models.BatchStatusCancelling:
+			batch.Status = models.BatchStatusCancelled
+			batch.CancelledAt = &now
+		case expired:
+			batch.Status = models.BatchStatusExpired
+			batch.ExpiredAt = &now
+		default:
+			batch.Status = models.BatchStatusCompleted
+			batch.CompletedAt = &now
+		}
+	})
+}
+
+// readInput 读取并校验输入文件，返回校验通过的行；任何一行不合法时返回校验错误
+func (bs *BatchStore) readInput(fileID string) ([]batchLine, []models.BatchError, error) {
+	file, err := os.Open(bs.files.contentPath(fileID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("input file %s is not available", fileID)
+	}
+	defer file.Close()
+
+	cfg := bs.configs.Get()
+	var (
+		lines    []batchLine
+		problems []models.BatchError
+		seen     = make(map[string]bool)
+	)
+	reader := bufio.NewReader(file)
+	for number := 1; ; number++ {
+		raw, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			line, problem := parseBatchLine(cfg, raw, seen)
+			if problem != nil {
+				problem.Line = number
+				if len(problems) < maxBatchErrors {
+					problems = append(problems, *problem)
+				}
+			} else {
+				lines = append(lines, line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch {
+	case len(problems) > 0:
+	case len(lines) == 0:
+		problems = append(problems, models.BatchError{Code: "empty_file", Message: "input file contains no requests"})
+	case cfg.BatchMaxRequests > 0 && len(lines) > cfg.BatchMaxRequests:
+		problems = append(problems, models.BatchError{
+			Code:    "too_many_requests",
+			Message: fmt.Sprintf("input file contains %d requests, the limit is %d", len(lines), cfg.BatchMaxRequests),
+		})
+	}
+	return lines, problems, nil
+}
+
+// parseBatchLine 解析并校验一行输入，校验规则与 /v1/chat/completions 一致
+func parseBatchLine(cfg *config.Config, raw []byte, seen map[string]bool) (batchLine, *models.BatchError) {
+	var input models.BatchInputLine
+	if err := json.Unmarshal(raw, &input); err != nil {
+		return batchLine{}, &models.BatchError{Code: "invalid_json_line", Message: "line is not valid JSON"}
+	}
+	switch {
+	case input.CustomID == "":
+		return batchLine{}, &models.BatchError{Code: "missing_custom_id", Message: "custom_id is required", Param: "custom_id"}
+	case seen[input.CustomID]:
+		return batchLine{}, &models.BatchError{Code: "duplicate_custom_id", Message: fmt.Sprintf("custom_id %q is not unique", input.CustomID), Param: "custom_id"}
+	case !strings.EqualFold(input.Method, "POST"):
+		return batchLine{}, &models.BatchError{Code: "invalid_method", Message: "method must be POST", Param: "method"}
+	case input.URL != batchEndpoint:
+		return batchLine{}, &models.BatchError{Code: "invalid_url", Message: fmt.Sprintf("url must be %s", batchEndpoint), Param: "url"}
+	}
+	seen[input.CustomID] = true
+
+	var request models.ChatCompletionRequest
+	if err := json.Unmarshal(input.Body, &request); err != nil {
+		return batchLine{}, &models.BatchError{Code: "invalid_body", Message: "body is not a valid chat completion request", Param: "body"}
+	}
+	var problem string
+	switch {
+	case !cfg.IsValidModel(request.Model):
+		problem = "Invalid model specified"
+	case len(request.Messages) == 0:
+		problem = "Messages cannot be empty"
+	case request.ResponseFormat.Validate() != nil:
+		problem = request.ResponseFormat.Validate().Error()
+	case request.N < 0 || request.N > max(cfg.MaxChoices, 1):
+		problem = fmt.Sprintf("n must be between 1 and %d", max(cfg.MaxChoices, 1))
+	case request.ConversationID != "":
+		problem = "conversation_id is not supported in batches"
+	}
+	if problem != "" {
+		return batchLine{}, &models.BatchError{Code: "invalid_body", Message: problem, Param: "body"}
+	}
+	request.Stream = false
+	return batchLine{CustomID: input.CustomID, Request: &request}, nil
+}
+
+// countResults 统计结果文件中的行数，并记录已完成的 custom_id
+func (bs *BatchStore) countResults(fileID string, done map[string]bool) int {
+	data, err := os.ReadFile(bs.files.contentPath(fileID))
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, raw := range bytes.Split(data, []byte("\n")) {
+		var line models.BatchOutputLine
+		if json.Unmarshal(raw, &line) == nil && line.CustomID != "" && !done[line.CustomID] {
+			done[line.CustomID] = true
+			count++
+		}
+	}
+	return count
+}
+
+// snapshot 复制批处理记录
+func (bs *BatchStore) snapshot(id string) storedBatch {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return *bs.items[id]
+}
+
+// update 修改批处理并保存，返回修改后的记录
+func (bs *BatchStore) update(id string, mutate func(*models.Batch)) storedBatch {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	updated := *bs.items[id]
+	mutate(&updated.Batch)
+	if err := bs.save(&updated); err != nil {
+		logrus.WithError(err).WithField("batch", id).Error("Failed to save batch")
+	}
+	bs.items[id] = &updated
+	return updated
+}
+
+// lookup 查找属于调用方的批处理，调用方需持有锁
+func (bs *BatchStore) lookup(apiKey, id string) (*storedBatch, error) {
+	stored, ok := bs.items[id]
+	if !ok || stored.Owner != ownerHash(apiKey) {
+		return nil, ErrBatchNotFound
+	}
+	return stored, nil
+}
+
+// save 原子写入批处理文件，调用方需持有锁
+func (bs *BatchStore) save(stored *storedBatch) error {
+	return bs.dir.save(stored.Batch.ID, stored)
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestBatchStore 创建回放服务和文件存储，批处理存储由各测试自行创建
+func newTestBatchStore(t *testing.T, dir string) (*CursorService, *FileStore) {
+	t.Helper()
+	s := newReplayService(t, &config.Config{}, nil)
+	s.configs = config.NewManager(&config.Config{
+		CassetteMode:       config.CassetteModeReplay,
+		APIKey:             "key-a",
+		MaxInputLength:     100000,
+		Models:             "model-a",
+		BatchEnabled:       true,
+		BatchDir:           dir,
+		BatchConcurrency:   2,
+		BatchMaxFileSizeMB: 1,
+		BatchMaxRequests:   10,
+	}, "")
+	files, err := NewFileStore(s.configs)
+	if err != nil {
+		t.Fatalf("NewFileStore() error = %v", err)
+	}
+	return s, files
+}
+
+func batchTestLine(customID, content string) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"custom_id": customID,
+		"method":    "POST",
+		"url":       "/v1/chat/completions",
+		"body": map[string]interface{}{
+			"model":    "model-a",
+			"messages": []map[string]string{{"role": "user", "content": content}},
+		},
+	})
+	return string(data) + "\n"
+}
+
+func batchTestRequest(content string) *models.ChatCompletionRequest {
+	request := &models.ChatCompletionRequest{Model: "model-a", Messages: []models.Message{{Role: "user", Content: content}}}
+	request.MaxTokens = models.ValidateMaxTokens(request.Model, nil)
+	return request
+}
+
+// waitBatch 等待批处理结束
+func waitBatch(t *testing.T, bs *BatchStore, id string) *models.Batch {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		batch, err := bs.Get("key-a", id)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if batchFinished(batch.Status) {
+			return batch
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("batch %s did not finish", id)
+	return nil
+}
+
+func readFileContent(t *testing.T, files *FileStore, id string) string {
+	t.Helper()
+	file, err := files.Open("key-a", id)
+	if err != nil {
+		t.Fatalf("Open(%s) error = %v", id, err)
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+	return string(data)
+}
+
+func TestBatchWritesResultsAndErrors(t *testing.T) {
+	s, files := newTestBatchStore(t, t.TempDir())
+	recordCassette(s, batchTestRequest("Hello"), delta("Hi"))
+	bs, err := NewBatchStore(s.configs, s, files)
+	if err != nil {
+		t.Fatalf("NewBatchStore() error = %v", err)
+	}
+	defer bs.Close()
+
+	// "b" 没有录制回放，上游调用失败
+	input, err := files.Create("key-a", "input.jsonl", "batch", strings.NewReader(batchTestLine("a", "Hello")+batchTestLine("b", "Missing")))
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	created, err := bs.Create(context.Background(), "key-a", &models.BatchRequest{
+		InputFileID:      input.ID,
+		Endpoint:         "/v1/chat/completions",
+		CompletionWindow: "24h",
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := bs.Get("key-b", created.ID); err != ErrBatchNotFound {
+		t.Errorf("Get() with another key error = %v, want ErrBatchNotFound", err)
+	}
+
+	batch := waitBatch(t, bs, created.ID)
+	if batch.Status != models.BatchStatusCompleted || batch.RequestCounts != (models.BatchRequestCounts{Total: 2, Completed: 1, Failed: 1}) {
+		t.Fatalf("batch = %+v, want completed with 1 success and 1 failure", batch)
+	}
+	if batch.OutputFileID == nil || batch.ErrorFileID == nil {
+		t.Fatalf("batch files = %v, %v, want both set", batch.OutputFileID, batch.ErrorFileID)
+	}
+
+	var line models.BatchOutputLine
+	if err := json.Unmarshal([]byte(readFileContent(t, files, *batch.OutputFileID)), &line); err != nil {
+		t.Fatalf("output line error = %v", err)
+	}
+	body, _ := json.Marshal(line.Response.Body)
+	if line.CustomID != "a" || line.Response.StatusCode != 200 || !strings.Contains(string(body), `"content":"Hi"`) {
+		t.Errorf("output line = %+v (%s), want response for a", line, body)
+	}
+	if errorsContent := readFileContent(t, files, *batch.ErrorFileID); !strings.Contains(errorsContent, `"custom_id":"b"`) || !strings.Contains(errorsContent, `"error":{`) {
+		t.Errorf("error file = %s, want error for b", errorsContent)
+	}
+}
+
+func TestBatchFailsValidation(t *testing.T) {
+	s, files := newTestBatchStore(t, t.TempDir())
+	bs, err := NewBatchStore(s.configs, s, files)
+	if err != nil {
+		t.Fatalf("NewBatchStore() error = %v", err)
+	}
+	defer bs.Close()
+
+	content := batchTestLine("a", "Hello") + batchTestLine("a", "Again") + "not json\n"
+	input, _ := files.Create("key-a", "input.jsonl", "batch", strings.NewReader(content))
+	created, err := bs.Create(context.Background(), "key-a", &models.BatchRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	batch := waitBatch(t, bs, created.ID)
+	if batch.Status != models.BatchStatusFailed || batch.Errors == nil || len(batch.Errors.Data) != 2 {
+		t.Fatalf("batch = %+v, want failed with 2 errors", batch)
+	}
+	if got := batch.Errors.Data[0]; got.Code != "duplicate_custom_id" || got.Line != 2 {
+		t.Errorf("first error = %+v, want duplicate_custom_id on line 2", got)
+	}
+	if got := batch.Errors.Data[1]; got.Code != "invalid_json_line" || got.Line != 3 {
+		t.Errorf("second error = %+v, want invalid_json_line on line 3", got)
+	}
+}
+
+func writeStoredBatch(t *testing.T, dir string, stored storedBatch) {
+	t.Helper()
+	data, _ := json.Marshal(stored)
+	if err := os.MkdirAll(filepath.Join(dir, "batches"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "batches", stored.Batch.ID+".json"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchResumesSkippingFinishedLines(t *testing.T) {
+	dir := t.TempDir()
+	s, files := newTestBatchStore(t, dir)
+	input, _ := files.Create("key-a", "input.jsonl", "batch", strings.NewReader(batchTestLine("a", "Hello")+batchTestLine("b", "Missing")))
+
+	// 模拟重启前已完成 "a" 的批处理；"a" 没有录制回放，重新执行会失败
+	stored := storedBatch{
+		Owner: ownerHash("key-a"),
+		Batch: models.Batch{
+			ID:               "batch_resume",
+			Object:           "batch",
+			Endpoint:         "/v1/chat/completions",
+			InputFileID:      input.ID,
+			CompletionWindow: "24h",
+			Status:           models.BatchStatusInProgress,
+			CreatedAt:        time.Now().Unix(),
+			ExpiresAt:        time.Now().Add(time.Hour).Unix(),
+		},
+		OutputFileID: "file-output",
+		ErrorFileID:  "file-error",
+	}
+	writeStoredBatch(t, dir, stored)
+	if err := os.WriteFile(files.contentPath("file-output"), []byte(`{"id":"batch_req_1","custom_id":"a","response":{"status_code":200},"error":null}`+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := NewBatchStore(s.configs, s, files)
+	if err != nil {
+		t.Fatalf("NewBatchStore() error = %v", err)
+	}
+	defer bs.Close()
+
+	batch := waitBatch(t, bs, "batch_resume")
+	if batch.RequestCounts != (models.BatchRequestCounts{Total: 2, Completed: 1, Failed: 1}) {
+		t.Errorf("request counts = %+v, want a kept and b failed", batch.RequestCounts)
+	}
+	if output := readFileContent(t, files, "file-output"); strings.Count(output, "\n") != 1 {
+		t.Errorf("output file = %q, want the original single line", output)
+	}
+}
+
+func TestBatchResumeFailsWhenKeyRevoked(t *testing.T) {
+	dir := t.TempDir()
+	s, files := newTestBatchStore(t, dir)
+	input, _ := files.Create("key-gone", "input.jsonl", "batch", strings.NewReader(batchTestLine("a", "Hello")))
+
+	// 创建批处理的密钥已从配置中移除，重启后不应以匿名身份继续执行
+	writeStoredBatch(t, dir, storedBatch{
+		Owner: ownerHash("key-gone"),
+		Batch: models.Batch{
+			ID:               "batch_revoked",
+			Object:           "batch",
+			Endpoint:         "/v1/chat/completions",
+			InputFileID:      input.ID,
+			CompletionWindow: "24h",
+			Status:           models.BatchStatusInProgress,
+			CreatedAt:        time.Now().Unix(),
+			ExpiresAt:        time.Now().Add(time.Hour).Unix(),
+		},
+	})
+
+	bs, err := NewBatchStore(s.configs, s, files)
+	if err != nil {
+		t.Fatalf("NewBatchStore() error = %v", err)
+	}
+	defer bs.Close()
+
+	batch, err := bs.Get("key-gone", "batch_revoked")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if batch.Status != models.BatchStatusFailed || batch.Errors == nil || batch.Errors.Data[0].Code != "api_key_revoked" {
+		t.Errorf("batch = %+v, want failed with api_key_revoked", batch)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// broadcaster 保留全部数据并广播给订阅者：晚到的订阅者先回放已有的数据，再跟随实时推送
+type broadcaster[T any] struct {
+	mu      sync.Mutex
+	buffer  []T
+	done    bool
+	changed chan struct{} // 每次追加数据或结束时关闭并替换，用于唤醒订阅者
+}
+
+func newBroadcaster[T any]() *broadcaster[T] {
+	return &broadcaster[T]{changed: make(chan struct{})}
+}
+
+// publish 追加一项数据并唤醒订阅者
+func (b *broadcaster[T]) publish(item T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buffer = append(b.buffer, item)
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// finish 结束广播，订阅者收完剩余数据后退出
+func (b *broadcaster[T]) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.done {
+		b.done = true
+		close(b.changed)
+	}
+}
+
+// finished 是否已结束
+func (b *broadcaster[T]) finished() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.done
+}
+
+// subscribe 从第一项开始把数据写入 out，广播结束或 ctx 结束时关闭 out
+func (b *broadcaster[T]) subscribe(ctx context.Context, out chan<- T) {
+	defer close(out)
+
+	next := 0
+	for {
+		b.mu.Lock()
+		items := b.buffer[next:]
+		done := b.done
+		changed := b.changed
+		b.mu.Unlock()
+
+		for _, item := range items {
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return
+			}
+		}
+		next += len(items)
+
+		if len(items) > 0 {
+			continue
+		}
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
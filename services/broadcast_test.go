@@ -0,0 +1,64 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBroadcasterReplaysToLateSubscriber(t *testing.T) {
+	b := newBroadcaster[int]()
+	b.publish(1)
+
+	early := make(chan int, 8)
+	go b.subscribe(context.Background(), early)
+	b.publish(2)
+
+	late := make(chan int, 8)
+	go b.subscribe(context.Background(), late)
+	b.publish(3)
+	b.finish()
+
+	for name, out := range map[string]chan int{"early": early, "late": late} {
+		var got []int
+		for item := range out {
+			got = append(got, item)
+		}
+		if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+			t.Errorf("%s subscriber got %v, want [1 2 3]", name, got)
+		}
+	}
+	if !b.finished() {
+		t.Error("finished() = false after finish()")
+	}
+}
+
+func TestBroadcasterSubscriberCancel(t *testing.T) {
+	b := newBroadcaster[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan int)
+	go b.subscribe(ctx, out)
+	cancel()
+	// 取消后通道关闭，不必等待广播结束
+	for range out {
+	}
+}
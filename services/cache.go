@@ -0,0 +1,410 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CacheEntry 缓存的完整回复
+type CacheEntry struct {
+	Key          string        `json:"key"`
+	Content      string        `json:"content"`
+	FinishReason string        `json:"finish_reason,omitempty"`
+	Usage        *models.Usage `json:"usage,omitempty"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+}
+
+// CacheControl 请求级缓存控制（来自 Cache-Control 请求头）
+type CacheControl struct {
+	NoCache bool // 不读取缓存，但仍用新结果刷新缓存
+	NoStore bool // 不读取也不写入缓存
+}
+
+type cacheControlKey struct{}
+
+// WithCacheControl 将请求的缓存控制附加到上下文
+func WithCacheControl(ctx context.Context, cc CacheControl) context.Context {
+	return context.WithValue(ctx, cacheControlKey{}, cc)
+}
+
+// ParseCacheControl 解析 Cache-Control 请求头
+func ParseCacheControl(header string) CacheControl {
+	var cc CacheControl
+	for _, directive := range strings.Split(header, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache":
+			cc.NoCache = true
+		case "no-store":
+			cc.NoCache = true
+			cc.NoStore = true
+		}
+	}
+	return cc
+}
+
+func cacheControlFromContext(ctx context.Context) CacheControl {
+	cc, _ := ctx.Value(cacheControlKey{}).(CacheControl)
+	return cc
+}
+
+// ResponseCache 两级响应缓存：内存 LRU + 可选的磁盘目录
+type ResponseCache struct {
+	configs      *config.Manager
+	maxEntries   int
+	dir          string
+	diskMaxBytes int64
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+
+	// 磁盘目录的估算大小和上次清理时间，由 mu 保护
+	diskBytes int64
+	lastSweep time.Time
+	sweeping  bool
+}
+
+// cacheSweepInterval 两次按 TTL 清理磁盘缓存的最小间隔
+const cacheSweepInterval = 10 * time.Minute
+
+// cacheKey 按调用方密钥隔离缓存，不同密钥的相同请求互不命中
+func cacheKey(apiKey, fingerprint string) string {
+	sum := sha256.Sum256([]byte(apiKey + "\x00" + fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewResponseCache 创建响应缓存，未启用时返回 nil
+func NewResponseCache(configs *config.Manager) (*ResponseCache, error) {
+	cfg := configs.Get()
+	if !cfg.CacheEnabled {
+		return nil, nil
+	}
+
+	if cfg.CacheDir != "" {
+		if err := os.MkdirAll(cfg.CacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cache dir: %w", err)
+		}
+	}
+
+	maxEntries := cfg.CacheMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+
+	rc := &ResponseCache{
+		configs:      configs,
+		maxEntries:   maxEntries,
+		dir:          cfg.CacheDir,
+		diskMaxBytes: int64(cfg.CacheDiskMaxMB) * 1024 * 1024,
+		ll:           list.New(),
+		items:        make(map[string]*list.Element),
+	}
+	if rc.dir != "" {
+		rc.sweeping = true
+		rc.sweepDisk()
+	}
+	return rc, nil
+}
+
+// enabledFor 检查调用方密钥是否启用了缓存
+func (rc *ResponseCache) enabledFor(apiKey string) bool {
+	return rc.configs.Get().IsCacheEnabledForKey(apiKey)
+}
+
+// Get 依次查找内存和磁盘，磁盘命中时提升到内存
+func (rc *ResponseCache) Get(key string) (*CacheEntry, bool) {
+	now := time.Now()
+
+	rc.mu.Lock()
+	if elem, ok := rc.items[key]; ok {
+		entry := elem.Value.(*CacheEntry)
+		if now.Before(entry.ExpiresAt) {
+			rc.ll.MoveToFront(elem)
+			rc.mu.Unlock()
+			return entry, true
+		}
+		rc.removeElement(elem)
+	}
+	rc.mu.Unlock()
+
+	if rc.dir == "" {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(rc.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || !now.Before(entry.ExpiresAt) {
+		os.Remove(rc.path(key))
+		return nil, false
+	}
+
+	rc.mu.Lock()
+	rc.addLocked(&entry)
+	rc.mu.Unlock()
+	return &entry, true
+}
+
+// Set 写入内存和磁盘
+func (rc *ResponseCache) Set(entry *CacheEntry) {
+	rc.mu.Lock()
+	rc.addLocked(entry)
+	rc.mu.Unlock()
+
+	if rc.dir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	tmp := rc.path(entry.Key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		logrus.WithError(err).Warn("Failed to write cache entry to disk")
+		return
+	}
+	if err := os.Rename(tmp, rc.path(entry.Key)); err != nil {
+		logrus.WithError(err).Warn("Failed to write cache entry to disk")
+		return
+	}
+
+	rc.mu.Lock()
+	rc.diskBytes += int64(len(data))
+	sweep := !rc.sweeping && ((rc.diskMaxBytes > 0 && rc.diskBytes > rc.diskMaxBytes) || time.Since(rc.lastSweep) >= cacheSweepInterval)
+	if sweep {
+		rc.sweeping = true
+	}
+	rc.mu.Unlock()
+	if sweep {
+		rc.sweepDisk()
+	}
+}
+
+// sweepDisk 删除磁盘上已过期的条目，超过 CACHE_DISK_MAX_MB 时再按修改时间从旧到新删除
+// 调用前需在 mu 下把 sweeping 置为 true
+func (rc *ResponseCache) sweepDisk() {
+	type diskFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	now := time.Now()
+	ttl := time.Duration(rc.configs.Get().CacheTTL) * time.Second
+	var files []diskFile
+	var total int64
+
+	entries, err := os.ReadDir(rc.dir)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to read cache dir")
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(rc.dir, e.Name())
+		if now.Sub(info.ModTime()) >= ttl {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, diskFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	if rc.diskMaxBytes > 0 && total > rc.diskMaxBytes {
+		sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+		for _, f := range files {
+			if total <= rc.diskMaxBytes {
+				break
+			}
+			if err := os.Remove(f.path); err == nil || os.IsNotExist(err) {
+				total -= f.size
+			}
+		}
+	}
+
+	rc.mu.Lock()
+	rc.diskBytes = total
+	rc.lastSweep = now
+	rc.sweeping = false
+	rc.mu.Unlock()
+}
+
+// Len 返回内存中的条目数
+func (rc *ResponseCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.ll.Len()
+}
+
+func (rc *ResponseCache) addLocked(entry *CacheEntry) {
+	if elem, ok := rc.items[entry.Key]; ok {
+		elem.Value = entry
+		rc.ll.MoveToFront(elem)
+		return
+	}
+	rc.items[entry.Key] = rc.ll.PushFront(entry)
+	for rc.ll.Len() > rc.maxEntries {
+		rc.removeElement(rc.ll.Back())
+	}
+}
+
+func (rc *ResponseCache) removeElement(elem *list.Element) {
+	rc.ll.Remove(elem)
+	delete(rc.items, elem.Value.(*CacheEntry).Key)
+}
+
+func (rc *ResponseCache) path(key string) string {
+	return filepath.Join(rc.dir, key+".json")
+}
+
+// Lookup 在缓存启用且未被请求绕过时查找缓存，命中时返回按配置节奏输出的流
+// key 应由 cacheKey 生成，以免不同密钥共享缓存
+func (rc *ResponseCache) Lookup(ctx context.Context, request *models.ChatCompletionRequest, key string) (<-chan interface{}, bool) {
+	if !rc.enabledFor(middleware.APIKeyFromContext(ctx)) || cacheControlFromContext(ctx).NoCache {
+		return nil, false
+	}
+
+	entry, ok := rc.Get(key)
+	if !ok {
+		return nil, false
+	}
+	logrus.WithField("key", key).Debug("Serving chat completion from cache")
+
+	cfg := rc.configs.Get()
+	output := make(chan interface{}, 32)
+	go func() {
+		defer close(output)
+		if request.Stream {
+			chunks := chunkString(entry.Content, cfg.CacheStreamChunkSize)
+			interval := time.Duration(cfg.CacheStreamIntervalMs) * time.Millisecond
+			for i, chunk := range chunks {
+				if i > 0 && interval > 0 {
+					select {
+					case <-time.After(interval):
+					case <-ctx.Done():
+						return
+					}
+				}
+				select {
+				case output <- chunk:
+				case <-ctx.Done():
+					return
+				}
+			}
+		} else if entry.Content != "" {
+			output <- entry.Content
+		}
+		if entry.FinishReason != "" {
+			output <- models.StreamFinish{Reason: entry.FinishReason}
+		}
+		if entry.Usage != nil {
+			output <- *entry.Usage
+		}
+	}()
+	return output, true
+}
+
+// Wrap 在流成功结束后把完整回复写入缓存
+func (rc *ResponseCache) Wrap(ctx context.Context, key string, in <-chan interface{}) <-chan interface{} {
+	if !rc.enabledFor(middleware.APIKeyFromContext(ctx)) || cacheControlFromContext(ctx).NoStore {
+		return in
+	}
+
+	var content strings.Builder
+	var usage *models.Usage
+	var finishReason string
+	failed := false
+
+	observe := func(item interface{}) {
+		switch v := item.(type) {
+		case string:
+			content.WriteString(v)
+		case models.StreamFinish:
+			finishReason = v.Reason
+		case models.Usage:
+			u := v
+			usage = &u
+		case error:
+			failed = true
+		}
+	}
+	done := func() {
+		// 出错或客户端中途断开导致回复不完整时不缓存
+		if failed || ctx.Err() != nil || content.Len() == 0 {
+			return
+		}
+		rc.Set(&CacheEntry{
+			Key:          key,
+			Content:      content.String(),
+			FinishReason: finishReason,
+			Usage:        usage,
+			ExpiresAt:    time.Now().Add(time.Duration(rc.configs.Get().CacheTTL) * time.Second),
+		})
+	}
+
+	return teeStream(ctx, in, observe, done)
+}
+
+// chunkString 按字符数切分字符串，size <= 0 时不切分
+func chunkString(s string, size int) []string {
+	if size <= 0 || utf8.RuneCountInString(s) <= size {
+		if s == "" {
+			return nil
+		}
+		return []string{s}
+	}
+
+	var chunks []string
+	runes := []rune(s)
+	for start := 0; start < len(runes); start += size {
+		end := start + size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[start:end]))
+	}
+	return chunks
+}
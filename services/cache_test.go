@@ -0,0 +1,190 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T, cfg *config.Config) *ResponseCache {
+	t.Helper()
+	cfg.CacheEnabled = true
+	cache, err := NewResponseCache(config.NewManager(cfg, ""))
+	if err != nil {
+		t.Fatalf("NewResponseCache() error = %v", err)
+	}
+	return cache
+}
+
+func TestResponseCacheLRUAndDisk(t *testing.T) {
+	dir := t.TempDir()
+	cache := newTestCache(t, &config.Config{CacheMaxEntries: 2, CacheDir: dir, CacheTTL: 60})
+
+	expires := time.Now().Add(time.Minute)
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(&CacheEntry{Key: key, Content: "content-" + key, ExpiresAt: expires})
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", cache.Len())
+	}
+
+	// "a" 已被挤出内存，但仍能从磁盘读回
+	entry, ok := cache.Get("a")
+	if !ok || entry.Content != "content-a" {
+		t.Fatalf("Get(a) = %v, %v, want disk hit", entry, ok)
+	}
+
+	cache.Set(&CacheEntry{Key: "old", Content: "stale", ExpiresAt: time.Now().Add(-time.Second)})
+	if _, ok := cache.Get("old"); ok {
+		t.Error("Get(old) returned an expired entry")
+	}
+}
+
+func TestResponseCacheSweepsDisk(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.json")
+	if err := os.WriteFile(stale, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Minute)
+	os.Chtimes(stale, old, old)
+
+	// 启动时按 TTL 清理过期文件
+	cache := newTestCache(t, &config.Config{CacheDir: dir, CacheTTL: 60, CacheDiskMaxMB: 1})
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale cache file not removed: %v", err)
+	}
+
+	// 超过磁盘上限时从最旧的条目开始删除
+	expires := time.Now().Add(time.Minute)
+	big := strings.Repeat("x", 400*1024)
+	for i, key := range []string{"a", "b", "c"} {
+		cache.Set(&CacheEntry{Key: key, Content: big, ExpiresAt: expires})
+		mod := time.Now().Add(time.Duration(i-3) * time.Second)
+		os.Chtimes(cache.path(key), mod, mod)
+	}
+	if _, err := os.Stat(cache.path("a")); !os.IsNotExist(err) {
+		t.Errorf("oldest entry not evicted from disk: %v", err)
+	}
+	if _, err := os.Stat(cache.path("c")); err != nil {
+		t.Errorf("newest entry evicted from disk: %v", err)
+	}
+}
+
+func TestCacheKeyScopedByAPIKey(t *testing.T) {
+	if cacheKey("key-a", "fp") == cacheKey("key-b", "fp") {
+		t.Error("cacheKey() should differ between API keys")
+	}
+	if cacheKey("key-a", "fp") != cacheKey("key-a", "fp") {
+		t.Error("cacheKey() should be stable")
+	}
+}
+
+func TestResponseCacheLookupStream(t *testing.T) {
+	cache := newTestCache(t, &config.Config{CacheTTL: 60, CacheStreamChunkSize: 4})
+	usage := models.Usage{TotalTokens: 3}
+	cache.Set(&CacheEntry{Key: "k", Content: "hello world", Usage: &usage, ExpiresAt: time.Now().Add(time.Minute)})
+
+	stream, ok := cache.Lookup(context.Background(), &models.ChatCompletionRequest{Stream: true}, "k")
+	if !ok {
+		t.Fatal("Lookup() missed")
+	}
+
+	var chunks []string
+	var gotUsage bool
+	for item := range stream {
+		switch v := item.(type) {
+		case string:
+			chunks = append(chunks, v)
+		case models.Usage:
+			gotUsage = v.TotalTokens == 3
+		}
+	}
+	if strings.Join(chunks, "") != "hello world" || len(chunks) != 3 {
+		t.Errorf("chunks = %q, want 3 chunks of hello world", chunks)
+	}
+	if !gotUsage {
+		t.Error("cached usage not replayed")
+	}
+
+	ctx := WithCacheControl(context.Background(), ParseCacheControl("no-cache"))
+	if _, ok := cache.Lookup(ctx, &models.ChatCompletionRequest{}, "k"); ok {
+		t.Error("Lookup() should be bypassed with Cache-Control: no-cache")
+	}
+}
+
+func TestResponseCacheWrapStoresCompleteResponses(t *testing.T) {
+	cache := newTestCache(t, &config.Config{CacheTTL: 60})
+
+	in := make(chan interface{}, 3)
+	in <- "partial "
+	in <- "answer"
+	in <- models.Usage{TotalTokens: 2}
+	close(in)
+	for range cache.Wrap(context.Background(), "ok", in) {
+	}
+
+	failed := make(chan interface{}, 2)
+	failed <- "partial"
+	failed <- context.DeadlineExceeded
+	close(failed)
+	for range cache.Wrap(context.Background(), "failed", failed) {
+	}
+
+	if entry, ok := cache.Get("ok"); !ok || entry.Content != "partial answer" {
+		t.Errorf("Get(ok) = %v, %v", entry, ok)
+	}
+	if _, ok := cache.Get("failed"); ok {
+		t.Error("failed stream should not be cached")
+	}
+}
+
+func TestResponseCacheReplaysFinishReason(t *testing.T) {
+	cache := newTestCache(t, &config.Config{CacheTTL: 60})
+
+	in := make(chan interface{}, 2)
+	in <- "cut off"
+	in <- models.StreamFinish{Reason: "length"}
+	close(in)
+	for range cache.Wrap(context.Background(), "truncated", in) {
+	}
+
+	stream, ok := cache.Lookup(context.Background(), &models.ChatCompletionRequest{}, "truncated")
+	if !ok {
+		t.Fatal("Lookup() missed")
+	}
+	var finish models.StreamFinish
+	for item := range stream {
+		if v, ok := item.(models.StreamFinish); ok {
+			finish = v
+		}
+	}
+	if !finish.IsTruncated() {
+		t.Errorf("finish = %+v, want the cached length reason", finish)
+	}
+}
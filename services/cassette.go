@@ -0,0 +1,176 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"cursor2api-go/models"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Cassette 一次上游请求的录制内容（原始 SSE 字节和请求元数据）
+type Cassette struct {
+	Key        string               `json:"key"`
+	RecordedAt time.Time            `json:"recorded_at"`
+	Model      string               `json:"model"`
+	Request    models.CursorRequest `json:"request"`
+	StatusCode int                  `json:"status_code"`
+	Body       string               `json:"body"`
+}
+
+// CassetteStore 按请求指纹读写录制文件
+type CassetteStore struct {
+	dir string
+}
+
+// NewCassetteStore 创建录制文件存储
+func NewCassetteStore(dir string) (*CassetteStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cassette dir: %w", err)
+	}
+	return &CassetteStore{dir: dir}, nil
+}
+
+// requestFingerprint 计算 Cursor 请求的规范哈希（忽略每次随机生成的 ID）
+func requestFingerprint(payload models.CursorRequest) string {
+	canonical := struct {
+		Model    string                 `json:"model"`
+		Messages []models.CursorMessage `json:"messages"`
+		Context  []interface{}          `json:"context,omitempty"`
+	}{
+		Model:    payload.Model,
+		Messages: payload.Messages,
+		Context:  payload.Context,
+	}
+	data, _ := json.Marshal(canonical)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (cs *CassetteStore) path(key string) string {
+	return filepath.Join(cs.dir, key+".json")
+}
+
+// Load 读取指定指纹的录制文件
+func (cs *CassetteStore) Load(key string) (*Cassette, error) {
+	data, err := os.ReadFile(cs.path(key))
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", key, err)
+	}
+	return &cassette, nil
+}
+
+// Save 写入录制文件（先写临时文件再重命名，避免回放读到半个文件）
+func (cs *CassetteStore) Save(cassette *Cassette) error {
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	tmp := cs.path(cassette.Key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmp, cs.path(cassette.Key))
+}
+
+// Replay 从录制文件构造上游响应；没有匹配的录制时返回错误
+func (cs *CassetteStore) Replay(payload models.CursorRequest) (*http.Response, error) {
+	key := requestFingerprint(payload)
+	cassette, err := cs.Load(key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no cassette recorded for request %s", key)
+		}
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"key":         key,
+		"recorded_at": cassette.RecordedAt,
+	}).Debug("Replaying upstream response from cassette")
+
+	return &http.Response{
+		StatusCode: cassette.StatusCode,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(strings.NewReader(cassette.Body)),
+	}, nil
+}
+
+// Record 包装上游响应体，在响应体关闭时把已读取的原始字节写入录制文件
+func (cs *CassetteStore) Record(model string, payload models.CursorRequest, resp *http.Response) {
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		onClose: func(body []byte) {
+			cassette := &Cassette{
+				Key:        requestFingerprint(payload),
+				RecordedAt: time.Now(),
+				Model:      model,
+				Request:    payload,
+				StatusCode: resp.StatusCode,
+				Body:       string(body),
+			}
+			if err := cs.Save(cassette); err != nil {
+				logrus.WithError(err).Warn("Failed to save cassette")
+				return
+			}
+			logrus.WithField("key", cassette.Key).Debug("Recorded upstream response to cassette")
+		},
+	}
+}
+
+// recordingBody 在读取时复制一份原始字节
+type recordingBody struct {
+	io.ReadCloser
+	buf     bytes.Buffer
+	once    sync.Once
+	onClose func([]byte)
+}
+
+func (r *recordingBody) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.buf.Write(p[:n])
+	return n, err
+}
+
+func (r *recordingBody) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() {
+		r.onClose(r.buf.Bytes())
+	})
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	store, err := NewCassetteStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCassetteStore() error = %v", err)
+	}
+
+	payload := models.CursorRequest{
+		ID:    "first",
+		Model: "anthropic/claude-sonnet-4.6",
+		Messages: []models.CursorMessage{
+			{Role: "user", Parts: []models.CursorPart{{Type: "text", Text: "Hello"}}},
+		},
+	}
+	raw := "data: {\"type\":\"text-delta\",\"delta\":\"Hi\"}\n\ndata: {\"type\":\"text-delta\",\"delta\":\" there\"}\n\n"
+
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(raw))}
+	store.Record("claude-sonnet-4.6", payload, resp)
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// 随机 ID 不同也应命中同一个录制
+	payload.ID = "second"
+	replayed, err := store.Replay(payload)
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	output := make(chan interface{}, 8)
+	if err := utils.ReadSSEStream(context.Background(), replayed, output); err != nil {
+		t.Fatalf("ReadSSEStream() error = %v", err)
+	}
+	close(output)
+
+	var text strings.Builder
+	for item := range output {
+		if s, ok := item.(string); ok {
+			text.WriteString(s)
+		}
+	}
+	if text.String() != "Hi there" {
+		t.Errorf("replayed content = %q, want %q", text.String(), "Hi there")
+	}
+
+	payload.Messages[0].Parts[0].Text = "Different"
+	if _, err := store.Replay(payload); err == nil {
+		t.Error("Replay() expected error for unrecorded request")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/models"
+	"sync"
+)
+
+type independentKey struct{}
+
+// withIndependentGeneration 标记请求需要独立生成：不读写响应缓存，也不与相同请求合并
+func withIndependentGeneration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, independentKey{}, true)
+}
+
+func isIndependentGeneration(ctx context.Context) bool {
+	independent, _ := ctx.Value(independentKey{}).(bool)
+	return independent
+}
+
+// completeChoices 并行发起 n 次独立生成，合并为一个流：
+// 文本以 models.ChoiceChunk 带上候选下标交错输出，每个候选结束时输出 models.ChoiceFinish，
+// 最后输出所有候选用量之和。任一候选在首个 token 前失败时整体失败
+func (s *CursorService) completeChoices(ctx context.Context, request *models.ChatCompletionRequest, n int) (*Completion, error) {
+	ctx, cancel := context.WithCancel(withIndependentGeneration(ctx))
+	model := s.routeModel(ctx, request)
+
+	completions := make([]*Completion, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			completions[i], errs[i] = s.completeSingle(ctx, request, model)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			cancel()
+			for _, completion := range completions {
+				if completion != nil {
+					go drain(completion.Stream)
+				}
+			}
+			return nil, err
+		}
+	}
+
+	// 各候选由同一个模型应答时直接报告该模型；部分候选回退到其他模型时报告路由到的模型，
+	// 并按下标给出每个候选的模型
+	result := &Completion{Model: completions[0].Model}
+	choiceModels := make([]string, n)
+	for i, completion := range completions {
+		result.Fallback = result.Fallback || completion.Fallback
+		choiceModels[i] = completion.Model
+		if completion.Model != result.Model {
+			result.ChoiceModels = choiceModels
+		}
+	}
+	if result.ChoiceModels != nil {
+		result.Model = model
+	}
+
+	out := make(chan interface{}, 32)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		var mu sync.Mutex
+		var usage models.Usage
+		hasUsage := false
+		send := func(item interface{}) bool {
+			select {
+			case out <- item:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var streams sync.WaitGroup
+		for i, completion := range completions {
+			streams.Add(1)
+			go func(i int, stream <-chan interface{}) {
+				defer streams.Done()
+				defer drain(stream)
+				for item := range stream {
+					var ok bool
+					switch v := item.(type) {
+					case string:
+						ok = send(models.ChoiceChunk{Index: i, Content: v})
+					case models.Usage:
+						mu.Lock()
+						usage.Add(v)
+						hasUsage = true
+						mu.Unlock()
+						ok = true
+					default:
+						ok = send(v)
+						if _, isErr := v.(error); isErr {
+							// 一个候选出错时结束整个响应
+							cancel()
+							return
+						}
+					}
+					if !ok {
+						return
+					}
+				}
+				send(models.ChoiceFinish{Index: i})
+			}(i, completion.Stream)
+		}
+		streams.Wait()
+
+		if hasUsage && ctx.Err() == nil {
+			send(usage)
+		}
+	}()
+
+	result.Stream = out
+	return result, nil
+}
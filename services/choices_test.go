@@ -0,0 +1,71 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"testing"
+)
+
+func TestCompleteChoices(t *testing.T) {
+	s := newReplayService(t, &config.Config{CoalesceEnabled: true}, map[string]string{
+		"model-a": "data: {\"type\":\"text-delta\",\"delta\":\"Hi\"}\n\n" +
+			"data: {\"type\":\"finish\",\"messageMetadata\":{\"usage\":{\"inputTokens\":3,\"outputTokens\":2,\"totalTokens\":5}}}\n\n",
+	})
+	s.coalescer = NewCoalescer()
+
+	request := fallbackTestRequest("model-a")
+	request.N = 3
+	completion, err := s.Complete(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	contents := map[int]string{}
+	finished := map[int]bool{}
+	var usage models.Usage
+	for item := range completion.Stream {
+		switch v := item.(type) {
+		case models.ChoiceChunk:
+			contents[v.Index] += v.Content
+		case models.ChoiceFinish:
+			finished[v.Index] = true
+		case models.Usage:
+			usage = v
+		default:
+			t.Fatalf("unexpected stream item %T: %v", v, v)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if contents[i] != "Hi" || !finished[i] {
+			t.Errorf("choice %d: content %q finished %v, want Hi and finished", i, contents[i], finished[i])
+		}
+	}
+	if usage.TotalTokens != 15 {
+		t.Errorf("aggregated TotalTokens = %d, want 15", usage.TotalTokens)
+	}
+	if completion.Model != "model-a" || completion.ChoiceModels != nil {
+		t.Errorf("Model = %s, ChoiceModels = %v, want model-a and nil", completion.Model, completion.ChoiceModels)
+	}
+}
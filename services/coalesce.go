@@ -0,0 +1,165 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// flight 一次正在进行的上游流，结果被广播给所有订阅者
+type flight struct {
+	key     string
+	started chan struct{} // 上游建立完成（成功或失败）后关闭
+	err     error
+	stream  *broadcaster[interface{}]
+
+	mu     sync.Mutex
+	refs   int
+	cancel context.CancelFunc
+}
+
+// Coalescer 合并并发的相同请求：只发起一次上游流，广播给所有等待的客户端
+type Coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// NewCoalescer 创建请求合并器
+func NewCoalescer() *Coalescer {
+	return &Coalescer{flights: make(map[string]*flight)}
+}
+
+// flightKey 合并键：上游上下文沿用第一个调用方的密钥、优先级和缓存控制，
+// 因此这些值不同的请求不能共享同一次上游调用
+func flightKey(ctx context.Context, cfg *config.Config, fingerprint string) string {
+	apiKey := middleware.APIKeyFromContext(ctx)
+	cc := cacheControlFromContext(ctx)
+	return fmt.Sprintf("%s|%s|%t|%t", cacheKey(apiKey, fingerprint), requestPriority(ctx, cfg, apiKey), cc.NoCache, cc.NoStore)
+}
+
+// Join 加入 key 对应的进行中请求，不存在时调用 start 发起新的上游流
+// 后加入的订阅者会先收到已缓冲的前缀；单个订阅者取消不会影响仍在订阅的其他客户端，
+// 所有订阅者都离开后才取消上游
+func (co *Coalescer) Join(ctx context.Context, key string, start func(ctx context.Context) (<-chan interface{}, error)) (<-chan interface{}, error) {
+	co.mu.Lock()
+	f, ok := co.flights[key]
+	if ok {
+		f.mu.Lock()
+		f.refs++
+		f.mu.Unlock()
+		logrus.WithField("key", key).Debug("Joined in-flight upstream request")
+	} else {
+		// 上游使用独立的上下文，保留请求上下文中的值，但不随发起者断开而取消
+		upstreamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{
+			key:     key,
+			started: make(chan struct{}),
+			stream:  newBroadcaster[interface{}](),
+			refs:    1,
+			cancel:  cancel,
+		}
+		co.flights[key] = f
+		go co.run(upstreamCtx, f, start)
+	}
+	co.mu.Unlock()
+
+	select {
+	case <-f.started:
+	case <-ctx.Done():
+		co.leave(f)
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		co.leave(f)
+		return nil, f.err
+	}
+
+	// 先回放已缓冲的数据，再跟随上游实时推送
+	out := make(chan interface{}, 32)
+	go func() {
+		f.stream.subscribe(ctx, out)
+		co.leave(f)
+	}()
+	return out, nil
+}
+
+// InFlight 返回正在进行的合并请求数
+func (co *Coalescer) InFlight() int {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	return len(co.flights)
+}
+
+// run 发起上游流并广播给订阅者
+func (co *Coalescer) run(ctx context.Context, f *flight, start func(ctx context.Context) (<-chan interface{}, error)) {
+	defer f.cancel()
+
+	upstream, err := start(ctx)
+	if err != nil {
+		f.err = err
+		co.remove(f)
+		f.stream.finish()
+		close(f.started)
+		return
+	}
+	close(f.started)
+
+	for item := range upstream {
+		f.stream.publish(item)
+	}
+
+	// 结束后不再接受新的订阅者，后续相同请求会重新发起（或命中缓存）
+	co.remove(f)
+	f.stream.finish()
+}
+
+// leave 订阅者离开；最后一个订阅者离开且上游未结束时取消上游
+func (co *Coalescer) leave(f *flight) {
+	// 与 Join 相同的加锁顺序，保证判定“无人订阅”和从表中移除之间不会有新订阅者加入
+	co.mu.Lock()
+	f.mu.Lock()
+	f.refs--
+	abandoned := f.refs == 0 && !f.stream.finished()
+	f.mu.Unlock()
+	if abandoned && co.flights[f.key] == f {
+		delete(co.flights, f.key)
+	}
+	co.mu.Unlock()
+
+	if abandoned {
+		logrus.WithField("key", f.key).Debug("All subscribers left, cancelling upstream request")
+		f.cancel()
+	}
+}
+
+func (co *Coalescer) remove(f *flight) {
+	co.mu.Lock()
+	if co.flights[f.key] == f {
+		delete(co.flights, f.key)
+	}
+	co.mu.Unlock()
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func collectText(ch <-chan interface{}) string {
+	var text strings.Builder
+	for item := range ch {
+		if s, ok := item.(string); ok {
+			text.WriteString(s)
+		}
+	}
+	return text.String()
+}
+
+func TestCoalescerSharesUpstream(t *testing.T) {
+	co := NewCoalescer()
+	upstream := make(chan interface{})
+	var starts int32
+	start := func(ctx context.Context) (<-chan interface{}, error) {
+		atomic.AddInt32(&starts, 1)
+		return upstream, nil
+	}
+
+	first, err := co.Join(context.Background(), "k", start)
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	upstream <- "Hello"
+
+	// 中途加入的订阅者先收到已缓冲的前缀
+	late, err := co.Join(context.Background(), "k", start)
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+
+	// 第三个订阅者中途取消，不应影响其他订阅者
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	quitter, err := co.Join(cancelCtx, "k", start)
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	cancel()
+	for range quitter {
+	}
+
+	go func() {
+		upstream <- ", world"
+		close(upstream)
+	}()
+
+	results := make(chan string, 2)
+	go func() { results <- collectText(first) }()
+	go func() { results <- collectText(late) }()
+	for i := 0; i < 2; i++ {
+		select {
+		case got := <-results:
+			if got != "Hello, world" {
+				t.Errorf("subscriber got %q, want %q", got, "Hello, world")
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for subscribers")
+		}
+	}
+
+	if n := atomic.LoadInt32(&starts); n != 1 {
+		t.Errorf("upstream started %d times, want 1", n)
+	}
+	if co.InFlight() != 0 {
+		t.Errorf("InFlight() = %d, want 0 after completion", co.InFlight())
+	}
+}
+
+func TestCoalescerCancelsWhenAllSubscribersLeave(t *testing.T) {
+	co := NewCoalescer()
+	cancelled := make(chan struct{})
+	start := func(ctx context.Context) (<-chan interface{}, error) {
+		out := make(chan interface{})
+		go func() {
+			defer close(out)
+			<-ctx.Done()
+			close(cancelled)
+		}()
+		return out, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := co.Join(ctx, "k", start)
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	cancel()
+	for range stream {
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("upstream was not cancelled after the last subscriber left")
+	}
+}
+
+func TestCoalescerPropagatesStartError(t *testing.T) {
+	co := NewCoalescer()
+	wantErr := errors.New("upstream down")
+	_, err := co.Join(context.Background(), "k", func(ctx context.Context) (<-chan interface{}, error) {
+		return nil, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Errorf("Join() error = %v, want %v", err, wantErr)
+	}
+}
+
+func TestFlightKeySeparatesCallerSettings(t *testing.T) {
+	cfg := &config.Config{}
+	base := flightKey(context.Background(), cfg, "fp")
+	if flightKey(context.Background(), cfg, "fp") != base {
+		t.Error("flightKey() should be stable for identical callers")
+	}
+	if flightKey(WithCacheControl(context.Background(), ParseCacheControl("no-store")), cfg, "fp") == base {
+		t.Error("flightKey() should differ by cache control")
+	}
+	if flightKey(WithPriority(context.Background(), "low"), cfg, "fp") == base {
+		t.Error("flightKey() should differ by priority")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/models"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	continueInstruction = "Your previous reply was cut off. Continue exactly where it stopped, without repeating anything already written and without any preamble."
+	// continueOverlapWindow 续写开头最多缓冲多少字节用于去除与前文重复的部分
+	continueOverlapWindow = 256
+	// continueMinOverlap 重复部分至少多长才去除，避免误删恰好相同的短片段
+	continueMinOverlap = 16
+)
+
+// completeContinued 生成输出，并在输出被截断时自动续写：上游报告因长度结束，或输出停在未闭合的代码块中时，
+// 把已生成的部分作为 assistant 消息、附上续写指令再次请求，续写内容无缝拼接到同一个流中，
+// 最多续写 AUTO_CONTINUE_MAX 次，用量为各次之和
+func (s *CursorService) completeContinued(ctx context.Context, request *models.ChatCompletionRequest, model string) (*Completion, error) {
+	limit := s.cfg().AutoContinueMax
+	completion, err := s.completeWithFallback(ctx, request, model)
+	if err != nil || limit <= 0 {
+		return completion, err
+	}
+
+	out := make(chan interface{}, 32)
+	go func() {
+		defer close(out)
+		send := func(item interface{}) bool {
+			select {
+			case out <- item:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var text strings.Builder
+		var usage models.Usage
+		hasUsage := false
+		stream := completion.Stream
+		for continuation := 0; ; continuation++ {
+			var finish models.StreamFinish
+			// 续写的开头先缓冲，去掉与前文重复的部分后再输出
+			var head strings.Builder
+			stitching := continuation > 0
+			emit := func(chunk string) bool {
+				if stitching {
+					head.WriteString(chunk)
+					if head.Len() < continueOverlapWindow {
+						return true
+					}
+					chunk = trimOverlap(text.String(), head.String())
+					stitching = false
+				}
+				text.WriteString(chunk)
+				return chunk == "" || send(chunk)
+			}
+
+			for item := range stream {
+				ok := true
+				switch v := item.(type) {
+				case string:
+					ok = emit(v)
+				case models.StreamFinish:
+					finish = v
+				case models.Usage:
+					usage.Add(v)
+					hasUsage = true
+				case error:
+					send(v)
+					go drain(stream)
+					return
+				default:
+					ok = send(item)
+				}
+				if !ok {
+					go drain(stream)
+					return
+				}
+			}
+			if stitching && head.Len() > 0 {
+				stitching = false
+				if !emit(trimOverlap(text.String(), head.String())) {
+					return
+				}
+			}
+
+			truncated := finish.IsTruncated()
+			if continuation >= limit || !(truncated || hasUnclosedFence(text.String())) {
+				break
+			}
+			logrus.WithFields(logrus.Fields{
+				"model":        completion.Model,
+				"continuation": continuation + 1,
+				"truncated":    truncated,
+			}).Info("Output cut off, continuing")
+
+			next, err := s.completeWithFallback(ctx, continueRequest(request, text.String()), completion.Model)
+			if err != nil {
+				send(err)
+				return
+			}
+			stream = next.Stream
+		}
+
+		if hasUsage {
+			send(usage)
+		}
+	}()
+
+	return &Completion{Model: completion.Model, Fallback: completion.Fallback, Stream: out}, nil
+}
+
+// continueRequest 构造续写请求：原消息之后加上已生成的部分和续写指令。
+// 原请求带预填充时，已生成的部分接在前缀之后，合并为一条 assistant 消息
+func continueRequest(request *models.ChatCompletionRequest, partial string) *models.ChatCompletionRequest {
+	history := request.Messages
+	if prefix, ok := models.Prefill(history); ok {
+		history = history[:len(history)-1]
+		partial = prefix + partial
+	}
+	next := *request
+	next.Messages = append(append([]models.Message{}, history...),
+		models.Message{Role: "assistant", Content: partial},
+		models.Message{Role: "user", Content: continueInstruction},
+	)
+	return &next
+}
+
+// hasUnclosedFence 判断文本是否停在未闭合的 ``` 代码块中
+func hasUnclosedFence(text string) bool {
+	open := false
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			open = !open
+		}
+	}
+	return open
+}
+
+// trimOverlap 去掉续写开头与前文结尾重复的部分
+func trimOverlap(previous, next string) string {
+	for n := min(len(previous), len(next)); n >= continueMinOverlap; n-- {
+		if strings.HasSuffix(previous, next[:n]) {
+			return next[n:]
+		}
+	}
+	return next
+}
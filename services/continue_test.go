@@ -0,0 +1,78 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"testing"
+)
+
+const finishLength = "data: {\"type\":\"finish\",\"finishReason\":\"length\"}\n\n"
+
+func TestCompleteContinuesTruncatedOutput(t *testing.T) {
+	s := newReplayService(t, &config.Config{AutoContinueMax: 2}, nil)
+	request := fallbackTestRequest("model-a")
+	recordCassette(s, request, delta("The quick brown fox jumps")+finishLength)
+
+	// 续写重复了前文结尾，拼接时去掉
+	partial := "The quick brown fox jumps"
+	recordCassette(s, continueRequest(request, partial), delta("quick brown fox jumps over the lazy dog."))
+
+	completion, err := s.Complete(context.Background(), fallbackTestRequest("model-a"))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got, want := collectText(completion.Stream), "The quick brown fox jumps over the lazy dog."; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestCompleteContinuesUnclosedFence(t *testing.T) {
+	s := newReplayService(t, &config.Config{AutoContinueMax: 1}, nil)
+	request := fallbackTestRequest("model-a")
+	recordCassette(s, request, delta("```go\nfunc main() {\n"))
+	partial := "```go\nfunc main() {\n"
+	// 第二次仍未闭合，但已达到续写上限
+	recordCassette(s, continueRequest(request, partial), delta("}\n"))
+
+	completion, err := s.Complete(context.Background(), fallbackTestRequest("model-a"))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got, want := collectText(completion.Stream), "```go\nfunc main() {\n}\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestHasUnclosedFence(t *testing.T) {
+	tests := map[string]bool{
+		"plain text":                  false,
+		"```go\ncode\n```\n":          false,
+		"```go\ncode\n":               true,
+		"a\n  ```\nb\n```\n```python": true,
+	}
+	for text, want := range tests {
+		if got := hasUnclosedFence(text); got != want {
+			t.Errorf("hasUnclosedFence(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrConversationNotFound 会话不存在或不属于调用方
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// ErrConversationBusy 会话上一轮的回复还在生成
+var ErrConversationBusy = errors.New("conversation already has a turn in progress")
+
+// storedConversation 磁盘上保存的会话，owner 为 API 密钥的摘要
+type storedConversation struct {
+	Owner        string              `json:"owner"`
+	Conversation models.Conversation `json:"conversation"`
+}
+
+// ConversationStore 服务端会话存储：内存索引 + 每个会话一个 JSON 文件，按 API 密钥隔离
+type ConversationStore struct {
+	configs *config.Manager
+	dir     jsonDir
+
+	mu    sync.Mutex
+	items map[string]*storedConversation
+	turns map[string]*ConversationTurn // 进行中的轮次，按会话 ID
+}
+
+// ConversationTurn 会话中进行中的一轮。交给 Record 后在回复记录完毕时结束，否则由调用方 End
+type ConversationTurn struct {
+	store     *ConversationStore
+	id        string
+	key       string
+	owned     bool
+	handedOff atomic.Bool
+	once      sync.Once
+}
+
+// End 结束本轮；已交给 Record 的轮次由 Record 结束，这里不做任何事
+func (t *ConversationTurn) End() {
+	if !t.handedOff.Load() {
+		t.release()
+	}
+}
+
+func (t *ConversationTurn) release() {
+	if !t.owned {
+		return
+	}
+	t.once.Do(func() {
+		t.store.mu.Lock()
+		defer t.store.mu.Unlock()
+		if t.store.turns[t.id] == t {
+			delete(t.store.turns, t.id)
+		}
+	})
+}
+
+// NewConversationStore 创建会话存储并加载目录中已有的会话，未启用时返回 nil
+func NewConversationStore(configs *config.Manager) (*ConversationStore, error) {
+	if !configs.Get().ConversationsEnabled {
+		return nil, nil
+	}
+	dir, err := openJSONDir(configs.Get().ConversationDir, "conversation")
+	if err != nil {
+		return nil, err
+	}
+	items, err := loadJSONDir(dir, "conversation", func(c *storedConversation) string { return c.Conversation.ID })
+	if err != nil {
+		return nil, err
+	}
+	return &ConversationStore{configs: configs, dir: dir, items: items, turns: make(map[string]*ConversationTurn)}, nil
+}
+
+// Create 创建会话
+func (cs *ConversationStore) Create(apiKey string, request *models.ConversationRequest) (*models.Conversation, error) {
+	now := time.Now().Unix()
+	conv := models.Conversation{
+		ID:        "conv_" + utils.GenerateRandomString(24),
+		Object:    "conversation",
+		Metadata:  request.Metadata,
+		Messages:  request.Messages,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if request.Title != nil {
+		conv.Title = *request.Title
+	}
+	if request.Model != nil {
+		conv.Model = *request.Model
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stored := &storedConversation{Owner: ownerHash(apiKey), Conversation: conv}
+	if err := cs.save(stored); err != nil {
+		return nil, err
+	}
+	cs.items[conv.ID] = stored
+	return cs.snapshot(stored, true), nil
+}
+
+// Get 获取会话（含全部消息）
+func (cs *ConversationStore) Get(apiKey, id string) (*models.Conversation, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stored, err := cs.lookup(apiKey, id)
+	if err != nil {
+		return nil, err
+	}
+	return cs.snapshot(stored, true), nil
+}
+
+// Begin 开始会话的一轮并返回会话（含全部消息）。同一会话同时只允许一轮，避免并发的轮次读到相同的历史、
+// 交错写入回复；已有进行中的一轮时返回 ErrConversationBusy。key 非空且与进行中那一轮相同时
+// （同一 Idempotency-Key 的重试，只会回放原来的响应）放行，但不接管这一轮
+func (cs *ConversationStore) Begin(apiKey, id, key string) (*models.Conversation, *ConversationTurn, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stored, err := cs.lookup(apiKey, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	turn := &ConversationTurn{store: cs, id: id, key: key}
+	if active, ok := cs.turns[id]; ok {
+		if key == "" || active.key != key {
+			return nil, nil, ErrConversationBusy
+		}
+	} else {
+		turn.owned = true
+		cs.turns[id] = turn
+	}
+	return cs.snapshot(stored, true), turn, nil
+}
+
+// List 按更新时间倒序列出调用方的会话（不含消息）
+func (cs *ConversationStore) List(apiKey string, limit int) []*models.Conversation {
+	owner := ownerHash(apiKey)
+	cs.mu.Lock()
+	var result []*models.Conversation
+	for _, stored := range cs.items {
+		if stored.Owner == owner {
+			result = append(result, cs.snapshot(stored, false))
+		}
+	}
+	cs.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UpdatedAt != result[j].UpdatedAt {
+			return result[i].UpdatedAt > result[j].UpdatedAt
+		}
+		return result[i].ID < result[j].ID
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// Update 修改会话，只更新请求中提供的字段；提供 messages 时替换全部历史
+func (cs *ConversationStore) Update(apiKey, id string, request *models.ConversationRequest) (*models.Conversation, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stored, err := cs.lookup(apiKey, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *stored
+	conv := &updated.Conversation
+	if request.Title != nil {
+		conv.Title = *request.Title
+	}
+	if request.Model != nil {
+		conv.Model = *request.Model
+	}
+	if request.Metadata != nil {
+		conv.Metadata = request.Metadata
+	}
+	if request.Messages != nil {
+		conv.Messages = request.Messages
+	}
+	conv.UpdatedAt = time.Now().Unix()
+	if err := cs.save(&updated); err != nil {
+		return nil, err
+	}
+	cs.items[id] = &updated
+	return cs.snapshot(&updated, true), nil
+}
+
+// Delete 删除会话
+func (cs *ConversationStore) Delete(apiKey, id string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if _, err := cs.lookup(apiKey, id); err != nil {
+		return err
+	}
+	if err := cs.dir.remove(id); err != nil {
+		return err
+	}
+	delete(cs.items, id)
+	return nil
+}
+
+// Append 把消息追加到会话末尾
+func (cs *ConversationStore) Append(apiKey, id string, messages ...models.Message) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stored, err := cs.lookup(apiKey, id)
+	if err != nil {
+		return err
+	}
+
+	updated := *stored
+	updated.Conversation.Messages = append(append([]models.Message{}, stored.Conversation.Messages...), messages...)
+	updated.Conversation.UpdatedAt = time.Now().Unix()
+	if err := cs.save(&updated); err != nil {
+		return err
+	}
+	cs.items[id] = &updated
+	return nil
+}
+
+// History 返回发给上游的历史消息：开头的系统消息始终保留，其余只保留最近 CONVERSATION_MAX_MESSAGES 条，
+// 且不以 assistant 消息开头
+func (cs *ConversationStore) History(conv *models.Conversation) []models.Message {
+	messages := conv.Messages
+	var system []models.Message
+	for len(messages) > 0 && strings.EqualFold(messages[0].Role, "system") {
+		system = append(system, messages[0])
+		messages = messages[1:]
+	}
+
+	if limit := cs.configs.Get().ConversationMaxMessages; limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+		for len(messages) > 0 && strings.EqualFold(messages[0].Role, "assistant") {
+			messages = messages[1:]
+		}
+	}
+	return append(system, messages...)
+}
+
+// Record 在回复生成完毕后把本轮消息和回复追加到会话，然后结束 ct；生成出错或回复为空时不记录。
+// 多个候选（n > 1）时记录第一个候选
+func (cs *ConversationStore) Record(ctx context.Context, apiKey string, ct *ConversationTurn, turn []models.Message, completion *Completion) *Completion {
+	ct.handedOff.Store(true)
+	var reply strings.Builder
+	failed := false
+	observe := func(item interface{}) {
+		switch v := item.(type) {
+		case string:
+			reply.WriteString(v)
+		case models.ChoiceChunk:
+			if v.Index == 0 {
+				reply.WriteString(v.Content)
+			}
+		case error:
+			failed = true
+		}
+	}
+	done := func() {
+		defer ct.release()
+		if failed || reply.Len() == 0 {
+			return
+		}
+		messages := append(append([]models.Message{}, turn...), models.Message{Role: "assistant", Content: reply.String()})
+		if err := cs.Append(apiKey, ct.id, messages...); err != nil {
+			logrus.WithError(err).WithField("conversation", ct.id).Warn("Failed to record conversation turn")
+		}
+	}
+
+	recorded := *completion
+	recorded.Stream = teeStream(ctx, completion.Stream, observe, done)
+	return &recorded
+}
+
+// lookup 查找属于调用方的会话，调用方需持有锁
+func (cs *ConversationStore) lookup(apiKey, id string) (*storedConversation, error) {
+	stored, ok := cs.items[id]
+	if !ok || stored.Owner != ownerHash(apiKey) {
+		return nil, ErrConversationNotFound
+	}
+	return stored, nil
+}
+
+// snapshot 复制会话，withMessages 为 false 时不含消息
+func (cs *ConversationStore) snapshot(stored *storedConversation, withMessages bool) *models.Conversation {
+	conv := stored.Conversation
+	conv.MessageCount = len(conv.Messages)
+	if withMessages {
+		conv.Messages = append([]models.Message{}, conv.Messages...)
+	} else {
+		conv.Messages = nil
+	}
+	return &conv
+}
+
+// save 原子写入会话文件，调用方需持有锁
+func (cs *ConversationStore) save(stored *storedConversation) error {
+	return cs.dir.save(stored.Conversation.ID, stored)
+}
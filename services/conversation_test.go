@@ -0,0 +1,183 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestConversationStore(t *testing.T, dir string, maxMessages int) *ConversationStore {
+	t.Helper()
+	cs, err := NewConversationStore(config.NewManager(&config.Config{
+		ConversationsEnabled:    true,
+		ConversationDir:         dir,
+		ConversationMaxMessages: maxMessages,
+	}, ""))
+	if err != nil {
+		t.Fatalf("NewConversationStore() error = %v", err)
+	}
+	return cs
+}
+
+func TestConversationStoreCRUD(t *testing.T) {
+	dir := t.TempDir()
+	cs := newTestConversationStore(t, dir, 0)
+
+	title := "Trip"
+	conv, err := cs.Create("key-a", &models.ConversationRequest{Title: &title, Messages: []models.Message{{Role: "system", Content: "Be brief"}}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := cs.Append("key-a", conv.ID, models.Message{Role: "user", Content: "Hi"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	// 其他密钥看不到该会话
+	if _, err := cs.Get("key-b", conv.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Get() with another key error = %v, want ErrConversationNotFound", err)
+	}
+	if list := cs.List("key-b", 0); len(list) != 0 {
+		t.Errorf("List() with another key = %d conversations, want 0", len(list))
+	}
+
+	// 重新加载后内容仍在
+	reloaded := newTestConversationStore(t, dir, 0)
+	got, err := reloaded.Get("key-a", conv.ID)
+	if err != nil {
+		t.Fatalf("Get() after reload error = %v", err)
+	}
+	if got.Title != "Trip" || got.MessageCount != 2 || got.Messages[1].Content != "Hi" {
+		t.Errorf("reloaded conversation = %+v", got)
+	}
+	if list := reloaded.List("key-a", 0); len(list) != 1 || list[0].Messages != nil || list[0].MessageCount != 2 {
+		t.Errorf("List() = %+v, want one summary without messages", list)
+	}
+
+	renamed := "Holiday"
+	if updated, err := reloaded.Update("key-a", conv.ID, &models.ConversationRequest{Title: &renamed}); err != nil || updated.Title != "Holiday" || updated.MessageCount != 2 {
+		t.Errorf("Update() = %+v, %v", updated, err)
+	}
+	if err := reloaded.Delete("key-a", conv.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := newTestConversationStore(t, dir, 0).Get("key-a", conv.ID); !errors.Is(err, ErrConversationNotFound) {
+		t.Errorf("Get() after delete error = %v, want ErrConversationNotFound", err)
+	}
+}
+
+func TestConversationHistory(t *testing.T) {
+	cs := newTestConversationStore(t, t.TempDir(), 3)
+	conv := &models.Conversation{Messages: []models.Message{
+		{Role: "system", Content: "Be brief"},
+		{Role: "user", Content: "1"},
+		{Role: "assistant", Content: "2"},
+		{Role: "user", Content: "3"},
+		{Role: "assistant", Content: "4"},
+	}}
+
+	// 保留系统消息和最近三条，再去掉开头的 assistant 消息
+	history := cs.History(conv)
+	if len(history) != 3 || history[0].Content != "Be brief" || history[1].Content != "3" || history[2].Content != "4" {
+		t.Errorf("History() = %+v", history)
+	}
+}
+
+func TestConversationRecord(t *testing.T) {
+	cs := newTestConversationStore(t, t.TempDir(), 0)
+	conv, _ := cs.Create("key-a", &models.ConversationRequest{})
+
+	stream := make(chan interface{}, 3)
+	stream <- "Hel"
+	stream <- "lo"
+	stream <- models.Usage{TotalTokens: 3}
+	close(stream)
+
+	_, ct, err := cs.Begin("key-a", conv.ID, "")
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	turn := []models.Message{{Role: "user", Content: "Hi"}}
+	recorded := cs.Record(context.Background(), "key-a", ct, turn, &Completion{Model: "m", Stream: stream})
+	if got := collectText(recorded.Stream); got != "Hello" {
+		t.Errorf("stream = %q, want Hello", got)
+	}
+
+	// 记录在流结束后异步完成
+	deadline := time.Now().Add(time.Second)
+	for {
+		got, _ := cs.Get("key-a", conv.ID)
+		if got.MessageCount == 2 {
+			if got.Messages[0].Content != "Hi" || got.Messages[1].Role != "assistant" || got.Messages[1].Content != "Hello" {
+				t.Errorf("messages = %+v", got.Messages)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("turn was not recorded, messages = %+v", got.Messages)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 记录完毕后本轮结束，可以开始下一轮
+	if _, next, err := cs.Begin("key-a", conv.ID, ""); err != nil {
+		t.Errorf("Begin() after Record error = %v", err)
+	} else {
+		next.End()
+	}
+}
+
+func TestConversationBeginSerializesTurns(t *testing.T) {
+	cs := newTestConversationStore(t, t.TempDir(), 0)
+	conv, _ := cs.Create("key-a", &models.ConversationRequest{})
+
+	_, first, err := cs.Begin("key-a", conv.ID, "idem-1")
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	if _, _, err := cs.Begin("key-a", conv.ID, ""); !errors.Is(err, ErrConversationBusy) {
+		t.Errorf("concurrent Begin() error = %v, want ErrConversationBusy", err)
+	}
+	if _, _, err := cs.Begin("key-a", conv.ID, "idem-2"); !errors.Is(err, ErrConversationBusy) {
+		t.Errorf("Begin() with another key error = %v, want ErrConversationBusy", err)
+	}
+
+	// 同一 Idempotency-Key 的重试放行，但结束它不会释放原来的一轮
+	_, retry, err := cs.Begin("key-a", conv.ID, "idem-1")
+	if err != nil {
+		t.Fatalf("Begin() retry error = %v", err)
+	}
+	retry.End()
+	if _, _, err := cs.Begin("key-a", conv.ID, ""); !errors.Is(err, ErrConversationBusy) {
+		t.Errorf("Begin() after retry ended error = %v, want ErrConversationBusy", err)
+	}
+
+	first.End()
+	if _, next, err := cs.Begin("key-a", conv.ID, ""); err != nil {
+		t.Errorf("Begin() after End error = %v", err)
+	} else {
+		next.End()
+	}
+}
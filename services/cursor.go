@@ -46,7 +46,7 @@ const cursorAPIURL = "https://cursor.com/api/chat"
 
 // CursorService handles interactions with Cursor API.
 type CursorService struct {
-	config          *config.Config
+	configs         *config.Manager
 	client          *req.Client
 	mainJS          string
 	envJS           string
@@ -54,10 +54,23 @@ type CursorService struct {
 	scriptCacheTime time.Time
 	scriptMutex     sync.RWMutex
 	headerGenerator *utils.HeaderGenerator
+	jsRunner        *utils.JSRunner
+	audit           *AuditLogger
+	cache           *ResponseCache
+	coalescer       *Coalescer
+	cassettes       *CassetteStore
+	limiter         *Limiter
+	adaptive        *AdaptiveController
+	upstream        upstreamState
+	upstreamMutex   sync.Mutex
+	node            nodeVersion
+	nodeOnce        sync.Once
 }
 
 // NewCursorService creates a new service instance.
-func NewCursorService(cfg *config.Config) *CursorService {
+func NewCursorService(configs *config.Manager) *CursorService {
+	cfg := configs.Get()
+
 	mainJS, err := os.ReadFile(filepath.Join("jscode", "main.js"))
 	if err != nil {
 		logrus.Fatalf("failed to read jscode/main.js: %v", err)
@@ -80,26 +93,176 @@ func NewCursorService(cfg *config.Config) *CursorService {
 		client.SetCookieJar(jar)
 	}
 
-	return &CursorService{
-		config:          cfg,
+	audit, err := NewAuditLogger(configs)
+	if err != nil {
+		logrus.Fatalf("failed to initialize audit log: %v", err)
+	}
+
+	cache, err := NewResponseCache(configs)
+	if err != nil {
+		logrus.Fatalf("failed to initialize response cache: %v", err)
+	}
+
+	var cassettes *CassetteStore
+	if cfg.CassetteMode != "" {
+		cassettes, err = NewCassetteStore(cfg.CassetteDir)
+		if err != nil {
+			logrus.Fatalf("failed to initialize cassette store: %v", err)
+		}
+		logrus.Infof("Cassette %s mode enabled, dir: %s", cfg.CassetteMode, cfg.CassetteDir)
+	}
+
+	limiter := NewLimiter(cfg.UpstreamMaxConcurrency)
+	var adaptive *AdaptiveController
+	if cfg.AdaptiveConcurrency {
+		// 自适应模式下并发上限由控制器管理
+		adaptive = NewAdaptiveController(configs, limiter)
+	} else {
+		configs.OnReload(func(old, new *config.Config) error {
+			if old.UpstreamMaxConcurrency != new.UpstreamMaxConcurrency {
+				limiter.SetLimit(new.UpstreamMaxConcurrency)
+			}
+			return nil
+		})
+	}
+
+	s := &CursorService{
+		configs:         configs,
 		client:          client,
 		mainJS:          string(mainJS),
 		envJS:           string(envJS),
 		headerGenerator: utils.NewHeaderGenerator(),
+		jsRunner:        utils.NewJSRunner(cfg.JSMaxConcurrency),
+		audit:           audit,
+		cache:           cache,
+		coalescer:       NewCoalescer(),
+		cassettes:       cassettes,
+		limiter:         limiter,
+		adaptive:        adaptive,
 	}
+
+	// 脚本地址变化后旧脚本不再有效，下次请求重新获取
+	configs.OnReload(func(old, new *config.Config) error {
+		if old.ScriptURL != new.ScriptURL {
+			s.clearScriptCache()
+		}
+		return nil
+	})
+	return s
+}
+
+// clearScriptCache 清除 x-is-human 脚本缓存
+func (s *CursorService) clearScriptCache() {
+	s.scriptMutex.Lock()
+	s.scriptCache = ""
+	s.scriptCacheTime = time.Time{}
+	s.scriptMutex.Unlock()
 }
 
 // ChatCompletion creates a chat completion stream for the given request.
 func (s *CursorService) ChatCompletion(ctx context.Context, request *models.ChatCompletionRequest) (<-chan interface{}, error) {
 	payload := s.buildCursorRequest(request)
 
+	return s.openStream(ctx, request, payload)
+}
+
+// openStream 依次尝试缓存、录制回放和上游请求
+func (s *CursorService) openStream(ctx context.Context, request *models.ChatCompletionRequest, payload models.CursorRequest) (<-chan interface{}, error) {
+	key := requestFingerprint(payload)
+	storeKey := cacheKey(middleware.APIKeyFromContext(ctx), key)
+	// 独立生成（如 n > 1 的多个候选）不共享缓存和上游流
+	shared := !isIndependentGeneration(ctx)
+	if s.cache != nil && shared {
+		if cached, ok := s.cache.Lookup(ctx, request, storeKey); ok {
+			return cached, nil
+		}
+	}
+
+	start := func(ctx context.Context) (<-chan interface{}, error) {
+		var output <-chan interface{}
+		var err error
+		if s.cfg().CassetteMode == config.CassetteModeReplay {
+			// 回放模式：只从录制文件返回，不访问网络
+			output, err = s.replayCassette(ctx, payload)
+		} else {
+			var release func()
+			release, err = s.acquireUpstream(ctx)
+			if err != nil {
+				return nil, err
+			}
+			output, err = s.requestUpstream(ctx, request, payload)
+			if err == nil || !errors.Is(err, context.Canceled) {
+				s.recordUpstreamResult(err)
+			}
+			if err != nil {
+				release()
+				return nil, err
+			}
+			// 上游流结束后才归还名额
+			output = teeStream(ctx, output, nil, release)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if s.cache != nil && shared {
+			output = s.cache.Wrap(ctx, storeKey, output)
+		}
+		return output, nil
+	}
+
+	// 合并并发的相同请求，共享同一个上游流
+	if cfg := s.cfg(); cfg.CoalesceEnabled && shared {
+		return s.coalescer.Join(ctx, flightKey(ctx, cfg, key), start)
+	}
+	return start(ctx)
+}
+
+// acquireUpstream 在并发限制器中排队获取上游名额
+func (s *CursorService) acquireUpstream(ctx context.Context) (func(), error) {
+	cfg := s.cfg()
+	apiKey := middleware.APIKeyFromContext(ctx)
+	release, err := s.limiter.Acquire(ctx, apiKey, cfg.GetLimiterKeyWeight(apiKey), requestPriority(ctx, cfg, apiKey), time.Duration(cfg.QueueMaxWait)*time.Second)
+	var timeout *ErrQueueTimeout
+	if errors.As(err, &timeout) {
+		return nil, middleware.NewServiceUnavailableError("Upstream is busy, please retry later", "queue_timeout", 1)
+	}
+	return release, err
+}
+
+// LimiterStats 返回上游并发限制器的状态（启用时包含自适应并发状态）
+func (s *CursorService) LimiterStats() LimiterStats {
+	stats := s.limiter.Stats()
+	if s.adaptive != nil {
+		adaptive := s.adaptive.Stats()
+		stats.Adaptive = &adaptive
+	}
+	return stats
+}
+
+// replayCassette 从录制文件返回上游响应
+func (s *CursorService) replayCassette(ctx context.Context, payload models.CursorRequest) (<-chan interface{}, error) {
+	resp, err := s.cassettes.Replay(payload)
+	if err != nil {
+		return nil, middleware.NewCursorWebError(http.StatusBadGateway, err.Error())
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, middleware.NewCursorWebError(resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return s.startStream(ctx, resp), nil
+}
+
+// requestUpstream 向 Cursor 发起请求，失败时按策略重试
+func (s *CursorService) requestUpstream(ctx context.Context, request *models.ChatCompletionRequest, payload models.CursorRequest) (<-chan interface{}, error) {
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal cursor payload: %w", err)
 	}
 
-	// 尝试最多2次
-	maxRetries := 2
+	// 首次请求 + 配置的重试次数
+	maxRetries := s.cfg().UpstreamMaxRetries + 1
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		xIsHuman, err := s.fetchXIsHuman(ctx)
 		if err != nil {
@@ -121,12 +284,16 @@ func (s *CursorService) ChatCompletion(ctx context.Context, request *models.Chat
 			"attempt":        attempt,
 		}).Debug("Sending request to Cursor API")
 
+		sentAt := time.Now()
 		resp, err := s.client.R().
 			SetContext(ctx).
 			SetHeaders(headers).
 			SetBody(jsonPayload).
 			DisableAutoReadResponse().
 			Post(cursorAPIURL)
+		if err == nil && s.adaptive != nil {
+			s.adaptive.Observe(resp.StatusCode, time.Since(sentAt))
+		}
 		if err != nil {
 			if attempt < maxRetries {
 				logrus.WithError(err).Warnf("Cursor request failed (attempt %d/%d), retrying...", attempt, maxRetries)
@@ -136,6 +303,10 @@ func (s *CursorService) ChatCompletion(ctx context.Context, request *models.Chat
 			return nil, fmt.Errorf("cursor request failed: %w", err)
 		}
 
+		if s.cfg().CassetteMode == config.CassetteModeRecord {
+			s.cassettes.Record(request.Model, payload, resp.Response)
+		}
+
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Response.Body)
 			resp.Response.Body.Close()
@@ -161,10 +332,7 @@ func (s *CursorService) ChatCompletion(ctx context.Context, request *models.Chat
 				}).Debug("Refreshed browser fingerprint")
 
 				// 清除 token 缓存
-				s.scriptMutex.Lock()
-				s.scriptCache = ""
-				s.scriptCacheTime = time.Time{}
-				s.scriptMutex.Unlock()
+				s.clearScriptCache()
 
 				time.Sleep(time.Second * time.Duration(attempt))
 				continue
@@ -177,20 +345,43 @@ func (s *CursorService) ChatCompletion(ctx context.Context, request *models.Chat
 		}
 
 		// 成功,返回结果
-		output := make(chan interface{}, 32)
-		go s.consumeSSE(ctx, resp.Response, output)
-		return output, nil
+		return s.startStream(ctx, resp.Response), nil
 	}
 
 	return nil, fmt.Errorf("failed after %d attempts", maxRetries)
 }
 
+// cfg 返回当前生效的配置（支持热重载）
+func (s *CursorService) cfg() *config.Config {
+	return s.configs.Get()
+}
+
+// Close 释放服务持有的资源
+func (s *CursorService) Close() error {
+	if s.audit != nil {
+		return s.audit.Close()
+	}
+	return nil
+}
+
 func (s *CursorService) buildCursorRequest(request *models.ChatCompletionRequest) models.CursorRequest {
-	truncatedMessages := s.truncateMessages(request.Messages)
-	cursorMessages := models.ToCursorMessages(truncatedMessages, s.config.SystemPromptInject)
+	// 同一请求只读取一次配置，避免热重载时混用新旧配置
+	cfg := s.cfg()
+	// 只规整一次，预填充按规整后的消息判断，与实际发往上游的消息一致
+	truncatedMessages := truncateMessages(cfg, models.NormalizeMessages(request.Messages))
+
+	// response_format 的格式说明随系统提示一起注入
+	systemPrompt := cfg.SystemPromptInject
+	if instructions := request.ResponseFormat.Instructions(); instructions != "" {
+		if systemPrompt != "" {
+			systemPrompt += "\n\n"
+		}
+		systemPrompt += instructions
+	}
+	cursorMessages := models.ToCursorMessages(truncatedMessages, systemPrompt)
 
 	payload := models.CursorRequest{
-		Context:  []interface{}{},
+		Context:  attachmentContext(request.Attachments),
 		Model:    models.GetCursorModel(request.Model),
 		ID:       utils.GenerateRandomString(16),
 		Messages: cursorMessages,
@@ -200,6 +391,13 @@ func (s *CursorService) buildCursorRequest(request *models.ChatCompletionRequest
 	return payload
 }
 
+// startStream 开始消费上游 SSE 响应并返回输出通道
+func (s *CursorService) startStream(ctx context.Context, resp *http.Response) <-chan interface{} {
+	output := make(chan interface{}, 32)
+	go s.consumeSSE(ctx, resp, output)
+	return output
+}
+
 func (s *CursorService) consumeSSE(ctx context.Context, resp *http.Response, output chan interface{}) {
 	defer close(output)
 
@@ -207,6 +405,9 @@ func (s *CursorService) consumeSSE(ctx context.Context, resp *http.Response, out
 		if errors.Is(err, context.Canceled) {
 			return
 		}
+		if s.cfg().CassetteMode != config.CassetteModeReplay {
+			s.recordUpstreamResult(err)
+		}
 		errResp := middleware.NewCursorWebError(http.StatusBadGateway, err.Error())
 		select {
 		case output <- errResp:
@@ -217,6 +418,8 @@ func (s *CursorService) consumeSSE(ctx context.Context, resp *http.Response, out
 }
 
 func (s *CursorService) fetchXIsHuman(ctx context.Context) (string, error) {
+	cfg := s.cfg()
+
 	// 检查缓存
 	s.scriptMutex.RLock()
 	cached := s.scriptCache
@@ -225,13 +428,13 @@ func (s *CursorService) fetchXIsHuman(ctx context.Context) (string, error) {
 
 	var scriptBody string
 	// 缓存有效期缩短到1分钟,避免 token 过期
-	if cached != "" && time.Since(lastFetch) < 1*time.Minute {
+	if cached != "" && time.Since(lastFetch) < scriptCacheTTL {
 		scriptBody = cached
 	} else {
 		resp, err := s.client.R().
 			SetContext(ctx).
 			SetHeaders(s.scriptHeaders()).
-			Get(s.config.ScriptURL)
+			Get(cfg.ScriptURL)
 
 		if err != nil {
 			// 如果请求失败且有缓存，使用缓存
@@ -240,10 +443,7 @@ func (s *CursorService) fetchXIsHuman(ctx context.Context) (string, error) {
 				scriptBody = cached
 			} else {
 				// 清除缓存并生成一个简单的token
-				s.scriptMutex.Lock()
-				s.scriptCache = ""
-				s.scriptCacheTime = time.Time{}
-				s.scriptMutex.Unlock()
+				s.clearScriptCache()
 				// 生成一个简单的x-is-human token作为fallback
 				token := utils.GenerateRandomString(64)
 				logrus.Warnf("Failed to fetch script, generated fallback token")
@@ -256,10 +456,7 @@ func (s *CursorService) fetchXIsHuman(ctx context.Context) (string, error) {
 				scriptBody = cached
 			} else {
 				// 清除缓存并生成一个简单的token
-				s.scriptMutex.Lock()
-				s.scriptCache = ""
-				s.scriptCacheTime = time.Time{}
-				s.scriptMutex.Unlock()
+				s.clearScriptCache()
 				// 生成一个简单的x-is-human token作为fallback
 				token := utils.GenerateRandomString(64)
 				logrus.Warnf("Script fetch returned status %d, generated fallback token", resp.StatusCode)
@@ -275,17 +472,27 @@ func (s *CursorService) fetchXIsHuman(ctx context.Context) (string, error) {
 		}
 	}
 
-	compiled := s.prepareJS(scriptBody)
-	value, err := utils.RunJS(compiled)
+	compiled := s.prepareJS(cfg, scriptBody)
+	value, err := s.jsRunner.Run(ctx, compiled, utils.JSOptions{
+		Timeout:        time.Duration(cfg.JSTimeout) * time.Second,
+		MaxOldSpaceMB:  cfg.JSMaxOldSpaceMB,
+		MaxOutputBytes: cfg.JSMaxOutputBytes,
+	})
 	if err != nil {
-		// JS 执行失败时清除缓存并生成fallback token
-		s.scriptMutex.Lock()
-		s.scriptCache = ""
-		s.scriptCacheTime = time.Time{}
-		s.scriptMutex.Unlock()
-		token := utils.GenerateRandomString(64)
-		logrus.Warnf("Failed to execute JS, generated fallback token: %v", err)
-		return token, nil
+		// JS 超时错误同时包装了 context.DeadlineExceeded，需先于请求取消判断
+		switch {
+		case errors.Is(err, utils.ErrJSTimeout):
+			// 超时通常是机器负载过高而不是脚本本身有问题，保留脚本缓存
+			logrus.Warnf("JS execution timed out, generated fallback token: %v", err)
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			// 请求已取消，无需 token
+			return "", err
+		default:
+			// 崩溃或输出异常说明脚本可能已变化，清除缓存下次重新获取
+			s.clearScriptCache()
+			logrus.Warnf("Failed to execute JS, generated fallback token: %v", err)
+		}
+		return utils.GenerateRandomString(64), nil
 	}
 
 	logrus.WithField("length", len(value)).Debug("Fetched x-is-human token")
@@ -293,12 +500,12 @@ func (s *CursorService) fetchXIsHuman(ctx context.Context) (string, error) {
 	return value, nil
 }
 
-func (s *CursorService) prepareJS(cursorJS string) string {
+func (s *CursorService) prepareJS(cfg *config.Config, cursorJS string) string {
 	replacer := strings.NewReplacer(
-		"$$currentScriptSrc$$", s.config.ScriptURL,
-		"$$UNMASKED_VENDOR_WEBGL$$", s.config.FP.UNMASKED_VENDOR_WEBGL,
-		"$$UNMASKED_RENDERER_WEBGL$$", s.config.FP.UNMASKED_RENDERER_WEBGL,
-		"$$userAgent$$", s.config.FP.UserAgent,
+		"$$currentScriptSrc$$", cfg.ScriptURL,
+		"$$UNMASKED_VENDOR_WEBGL$$", cfg.FP.UNMASKED_VENDOR_WEBGL,
+		"$$UNMASKED_RENDERER_WEBGL$$", cfg.FP.UNMASKED_RENDERER_WEBGL,
+		"$$userAgent$$", cfg.FP.UserAgent,
 	)
 
 	mainScript := replacer.Replace(s.mainJS)
@@ -307,12 +514,12 @@ func (s *CursorService) prepareJS(cursorJS string) string {
 	return mainScript
 }
 
-func (s *CursorService) truncateMessages(messages []models.Message) []models.Message {
-	if len(messages) == 0 || s.config.MaxInputLength <= 0 {
+func truncateMessages(cfg *config.Config, messages []models.Message) []models.Message {
+	if len(messages) == 0 || cfg.MaxInputLength <= 0 {
 		return messages
 	}
 
-	maxLength := s.config.MaxInputLength
+	maxLength := cfg.MaxInputLength
 	total := 0
 	for _, msg := range messages {
 		total += len(msg.GetStringContent())
@@ -339,7 +546,7 @@ func (s *CursorService) truncateMessages(messages []models.Message) []models.Mes
 	for i := len(messages) - 1; i >= startIdx; i-- {
 		msg := messages[i]
 		msgLen := len(msg.GetStringContent())
-		if msgLen == 0 {
+		if msgLen == 0 && len(msg.Images()) == 0 {
 			continue
 		}
 		if current+msgLen > maxLength {
@@ -0,0 +1,177 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// judgeChoicePattern 从裁判回复中提取答案编号
+var judgeChoicePattern = regexp.MustCompile(`\d+`)
+
+// Ensemble 把同一请求并行发给多个模型，返回所有答案；指定裁判时由裁判模型挑选或综合最终答案
+// 调用方负责校验模型列表；只要有一个模型成功就返回结果，全部失败时返回第一个错误
+func (s *CursorService) Ensemble(ctx context.Context, request *models.EnsembleRequest, modelIDs []string, judge *models.EnsembleJudge) (*models.EnsembleResponse, error) {
+	start := time.Now()
+	answers := make([]models.EnsembleAnswer, len(modelIDs))
+	errs := make([]error, len(modelIDs))
+
+	var wg sync.WaitGroup
+	for i, model := range modelIDs {
+		wg.Add(1)
+		go func(i int, model string) {
+			defer wg.Done()
+			answers[i], errs[i] = s.collectAnswer(ctx, request.ChatRequest(model))
+		}(i, model)
+	}
+	wg.Wait()
+
+	response := &models.EnsembleResponse{
+		ID:      "ensemble-" + utils.GenerateRandomString(24),
+		Object:  "ensemble.completion",
+		Created: time.Now().Unix(),
+		Answers: answers,
+	}
+
+	var firstErr error
+	succeeded := 0
+	for i := range answers {
+		response.Usage.Add(answers[i].Usage)
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		succeeded++
+	}
+	if succeeded == 0 {
+		s.auditEnsemble(ctx, request, modelIDs, start, response, firstErr)
+		return nil, firstErr
+	}
+
+	if judge != nil {
+		final, selected := s.judgeAnswers(ctx, request, answers, judge)
+		response.Final = &final
+		response.Selected = selected
+		response.Usage.Add(final.Usage)
+	}
+	s.auditEnsemble(ctx, request, modelIDs, start, response, nil)
+	return response, nil
+}
+
+// auditEnsemble 为整个 ensemble 请求写一条审计记录：有最终答案时记录最终答案，否则按模型列出各个答案
+func (s *CursorService) auditEnsemble(ctx context.Context, request *models.EnsembleRequest, modelIDs []string, start time.Time, response *models.EnsembleResponse, err error) {
+	if s.audit == nil {
+		return
+	}
+	chatRequest := request.ChatRequest(strings.Join(modelIDs, ","))
+	var completion strings.Builder
+	if response.Final != nil {
+		completion.WriteString(response.Final.Content)
+	} else {
+		for _, answer := range response.Answers {
+			fmt.Fprintf(&completion, "### %s\n%s\n\n", answer.Model, answer.Content)
+		}
+	}
+	s.audit.Log(ctx, chatRequest, s.buildCursorRequest(chatRequest), start, strings.TrimSpace(completion.String()), response.Usage, err)
+}
+
+// collectAnswer 以非流式方式收集一个模型的完整答案
+func (s *CursorService) collectAnswer(ctx context.Context, request *models.ChatCompletionRequest) (models.EnsembleAnswer, error) {
+	start := time.Now()
+	answer := models.EnsembleAnswer{Model: request.Model}
+
+	// 成员和裁判的请求不单独审计，由 Ensemble 统一记录一条
+	completion, err := s.complete(ctx, request)
+	if err == nil {
+		answer.Model = completion.Model
+		var content strings.Builder
+		for item := range completion.Stream {
+			switch v := item.(type) {
+			case string:
+				content.WriteString(v)
+			case models.Usage:
+				answer.Usage = v
+			case error:
+				err = v
+			}
+		}
+		answer.Content = content.String()
+	}
+
+	answer.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		answer.Error = err.Error()
+		logrus.WithError(err).WithField("model", request.Model).Warn("Ensemble model failed")
+	}
+	return answer, err
+}
+
+// judgeAnswers 请裁判模型挑选（pick）或综合（merge）候选答案
+func (s *CursorService) judgeAnswers(ctx context.Context, request *models.EnsembleRequest, answers []models.EnsembleAnswer, judge *models.EnsembleJudge) (models.EnsembleAnswer, *int) {
+	var candidates []int
+	var prompt strings.Builder
+	if judge.Mode == models.JudgeModeMerge {
+		prompt.WriteString("Several assistants answered the conversation above. Combine their answers into a single best answer. Reply with the final answer only.\n")
+	} else {
+		prompt.WriteString("Several assistants answered the conversation above. Pick the best answer. Reply with its number only.\n")
+	}
+	for i, answer := range answers {
+		if answer.Error != "" {
+			continue
+		}
+		candidates = append(candidates, i)
+		fmt.Fprintf(&prompt, "\n### Answer %d\n%s\n", len(candidates), answer.Content)
+	}
+
+	judgeRequest := request.ChatRequest(judge.Model)
+	judgeRequest.Messages = append(append([]models.Message{}, request.Messages...), models.Message{
+		Role:    "user",
+		Content: prompt.String(),
+	})
+
+	final, err := s.collectAnswer(ctx, judgeRequest)
+	if err != nil || judge.Mode == models.JudgeModeMerge {
+		return final, nil
+	}
+
+	// pick 模式：最终答案为被选中的原始答案，解析失败时保留裁判的原始回复
+	if match := judgeChoicePattern.FindString(final.Content); match != "" {
+		if n, _ := strconv.Atoi(match); n >= 1 && n <= len(candidates) {
+			selected := candidates[n-1]
+			final.Content = answers[selected].Content
+			return final, &selected
+		}
+	}
+	logrus.WithField("reply", final.Content).Warn("Could not parse judge choice")
+	return final, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEnsembleWithJudge(t *testing.T) {
+	usage := func(n string) string {
+		return "data: {\"type\":\"finish\",\"messageMetadata\":{\"usage\":{\"inputTokens\":" + n + ",\"outputTokens\":" + n + ",\"totalTokens\":" + n + "}}}\n\n"
+	}
+	s := newReplayService(t, &config.Config{}, map[string]string{
+		"model-a": "data: {\"type\":\"text-delta\",\"delta\":\"answer a\"}\n\n" + usage("1"),
+		"model-b": "data: {\"type\":\"text-delta\",\"delta\":\"answer b\"}\n\n" + usage("2"),
+	})
+
+	request := &models.EnsembleRequest{Messages: []models.Message{{Role: "user", Content: "Hello"}}}
+
+	// 裁判请求包含候选答案，按其实际载荷录制
+	judgeRequest := request.ChatRequest("judge")
+	judgeRequest.Messages = append(judgeRequest.Messages, models.Message{
+		Role:    "user",
+		Content: "Several assistants answered the conversation above. Pick the best answer. Reply with its number only.\n\n### Answer 1\nanswer a\n\n### Answer 2\nanswer b\n",
+	})
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("data: {\"type\":\"text-delta\",\"delta\":\"2\"}\n\n" + usage("4")))}
+	s.cassettes.Record("judge", s.buildCursorRequest(judgeRequest), resp)
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	response, err := s.Ensemble(context.Background(), request, []string{"model-a", "model-b", "model-missing"}, &models.EnsembleJudge{Model: "judge", Mode: models.JudgeModePick})
+	if err != nil {
+		t.Fatalf("Ensemble() error = %v", err)
+	}
+
+	if len(response.Answers) != 3 {
+		t.Fatalf("got %d answers, want 3", len(response.Answers))
+	}
+	if response.Answers[0].Content != "answer a" || response.Answers[1].Content != "answer b" {
+		t.Errorf("answers = %+v", response.Answers)
+	}
+	if response.Answers[2].Error == "" {
+		t.Error("missing model should report an error")
+	}
+	if response.Answers[1].Usage.TotalTokens != 2 {
+		t.Errorf("per-model usage = %+v, want total 2", response.Answers[1].Usage)
+	}
+	if response.Selected == nil || *response.Selected != 1 || response.Final.Content != "answer b" {
+		t.Errorf("final = %+v, selected = %v, want answer b", response.Final, response.Selected)
+	}
+	if response.Usage.TotalTokens != 7 {
+		t.Errorf("total usage = %d, want 7", response.Usage.TotalTokens)
+	}
+}
+
+func TestEnsembleAllFailed(t *testing.T) {
+	s := newReplayService(t, &config.Config{}, nil)
+	request := &models.EnsembleRequest{Messages: []models.Message{{Role: "user", Content: "Hello"}}}
+	if _, err := s.Ensemble(context.Background(), request, []string{"model-a"}, nil); err == nil {
+		t.Error("Ensemble() expected error when every model fails")
+	}
+}
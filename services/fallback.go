@@ -0,0 +1,195 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Completion 一次聊天完成的结果：实际应答的模型和输出流
+type Completion struct {
+	Model        string
+	Fallback     bool     // 是否由回退模型应答
+	ChoiceModels []string // n > 1 且各候选由不同模型应答时，按下标给出每个候选的模型
+	Stream       <-chan interface{}
+}
+
+// Complete 生成聊天完成：虚拟模型先按权重路由到真实模型，再按模型回退链尝试；n > 1 时并行生成多个候选
+// 在第一个 token 之前失败（上游拒绝或流的第一项即为错误）时，依次改用回退链中的下一个模型；
+// 一旦开始输出就不再切换。返回的 Completion.Model 为实际应答的模型。请求中的图片先校验并转为 data URL，
+// 开启 map-reduce 时超长的单条消息先分块提取要点。每次调用只写一条审计记录，不含回退、续写和分块等内部请求
+func (s *CursorService) Complete(ctx context.Context, request *models.ChatCompletionRequest) (*Completion, error) {
+	completion, err := s.complete(ctx, request)
+	if err != nil || s.audit == nil {
+		return completion, err
+	}
+	completion.Stream = s.audit.Wrap(ctx, request, s.buildCursorRequest(request), completion.Stream)
+	return completion, nil
+}
+
+// complete 生成聊天完成，不写审计记录
+func (s *CursorService) complete(ctx context.Context, request *models.ChatCompletionRequest) (*Completion, error) {
+	request, err := s.resolveImages(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if oversized := s.oversizedMessages(request); len(oversized) > 0 {
+		return s.completeMapReduce(ctx, request, oversized)
+	}
+	return s.completeRequest(ctx, request)
+}
+
+// completeRequest 按 n 生成一个或多个候选
+func (s *CursorService) completeRequest(ctx context.Context, request *models.ChatCompletionRequest) (*Completion, error) {
+	if request.N > 1 {
+		return s.completeChoices(ctx, request, request.N)
+	}
+
+	completion, err := s.completeSingle(ctx, request, s.routeModel(ctx, request))
+	if err != nil {
+		return nil, err
+	}
+	return s.startShadow(ctx, request, completion), nil
+}
+
+// completeWithFallback 从 model 开始沿回退链尝试；请求含图片时跳过不支持图片输入的回退模型
+func (s *CursorService) completeWithFallback(ctx context.Context, request *models.ChatCompletionRequest, model string) (*Completion, error) {
+	chain := s.fallbackChain(model)
+	if models.HasImages(request.Messages) {
+		if !models.SupportsVision(model) {
+			return nil, middleware.NewInvalidRequestError(
+				fmt.Sprintf("model %s does not support image inputs", model), "model_not_vision_capable")
+		}
+		chain = slices.DeleteFunc(chain, func(m string) bool { return !models.SupportsVision(m) })
+	}
+
+	var lastErr error
+	for i, model := range chain {
+		attempt := *request
+		attempt.Model = model
+
+		stream, err := s.ChatCompletion(ctx, &attempt)
+		if err == nil {
+			var first interface{}
+			first, stream, err = peekStream(ctx, stream)
+			if err == nil {
+				if i > 0 {
+					logrus.WithFields(logrus.Fields{
+						"requested": chain[0],
+						"model":     model,
+					}).Info("Answered by fallback model")
+				}
+				return &Completion{Model: model, Fallback: i > 0, Stream: prependStream(ctx, first, stream)}, nil
+			}
+		}
+
+		lastErr = err
+		if !shouldFallback(err) || i == len(chain)-1 {
+			break
+		}
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"model":    model,
+			"fallback": chain[i+1],
+		}).Warn("Model failed before first token, falling back")
+	}
+	return nil, lastErr
+}
+
+// fallbackChain 返回模型本身加上回退模型（配置优先于模型注册表），去重；
+// 注册表中的回退模型未在 MODELS 中列出时跳过，与 MODEL_FALLBACKS 的校验规则一致
+func (s *CursorService) fallbackChain(model string) []string {
+	cfg := s.cfg()
+	fallbacks := cfg.GetModelFallbacks(model)
+	if fallbacks == nil {
+		fallbacks = slices.DeleteFunc(slices.Clone(models.GetFallbackModels(model)), func(m string) bool { return !cfg.IsValidModel(m) })
+	}
+
+	chain := []string{model}
+	seen := map[string]bool{model: true}
+	for _, fallback := range fallbacks {
+		if !seen[fallback] {
+			seen[fallback] = true
+			chain = append(chain, fallback)
+		}
+	}
+	return chain
+}
+
+// shouldFallback 判断错误是否与模型相关；客户端取消、排队超时等换模型也无济于事
+func shouldFallback(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var unavailable *middleware.ServiceUnavailableError
+	return !errors.As(err, &unavailable)
+}
+
+// peekStream 读取流的第一项；第一项为错误时返回该错误。空流视为成功（first 为 nil）
+func peekStream(ctx context.Context, in <-chan interface{}) (interface{}, <-chan interface{}, error) {
+	select {
+	case first, ok := <-in:
+		if !ok {
+			return nil, in, nil
+		}
+		if err, isErr := first.(error); isErr {
+			go drain(in)
+			return nil, nil, err
+		}
+		return first, in, nil
+	case <-ctx.Done():
+		go drain(in)
+		return nil, nil, ctx.Err()
+	}
+}
+
+// prependStream 把已读出的第一项放回流的开头
+func prependStream(ctx context.Context, first interface{}, in <-chan interface{}) <-chan interface{} {
+	if first == nil {
+		return in
+	}
+	out := make(chan interface{}, cap(in)+1)
+	out <- first
+	go func() {
+		defer close(out)
+		for item := range in {
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				drain(in)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// drain 丢弃流中剩余的数据，避免生产者阻塞
+func drain(in <-chan interface{}) {
+	for range in {
+	}
+}
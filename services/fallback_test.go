@@ -0,0 +1,98 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newReplayService 创建只从录制文件回放的服务，responses 为模型到原始 SSE 的映射
+func newReplayService(t *testing.T, cfg *config.Config, responses map[string]string) *CursorService {
+	t.Helper()
+	store, err := NewCassetteStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewCassetteStore() error = %v", err)
+	}
+	cfg.CassetteMode = config.CassetteModeReplay
+	cfg.MaxInputLength = 100000
+	s := &CursorService{configs: config.NewManager(cfg, ""), cassettes: store}
+
+	for model, raw := range responses {
+		recordCassette(s, fallbackTestRequest(model), raw)
+	}
+	return s
+}
+
+// recordCassette 为请求录制一段上游原始 SSE
+func recordCassette(s *CursorService, request *models.ChatCompletionRequest, raw string) {
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(raw))}
+	s.cassettes.Record(request.Model, s.buildCursorRequest(request), resp)
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+}
+
+func fallbackTestRequest(model string) *models.ChatCompletionRequest {
+	return &models.ChatCompletionRequest{
+		Model:    model,
+		Messages: []models.Message{{Role: "user", Content: "Hello"}},
+	}
+}
+
+func TestCompleteFallsBackBeforeFirstToken(t *testing.T) {
+	s := newReplayService(t, &config.Config{ModelFallbacks: "model-a->model-b->model-c"}, map[string]string{
+		// model-a 没有录制，回放失败；model-b 第一项即为错误；model-c 正常应答
+		"model-b": "data: {\"type\":\"error\",\"errorText\":\"overloaded\"}\n\n",
+		"model-c": "data: {\"type\":\"text-delta\",\"delta\":\"Hi\"}\n\n",
+	})
+
+	completion, err := s.Complete(context.Background(), fallbackTestRequest("model-a"))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if completion.Model != "model-c" {
+		t.Errorf("Model = %s, want model-c", completion.Model)
+	}
+	if got := collectText(completion.Stream); got != "Hi" {
+		t.Errorf("content = %q, want %q", got, "Hi")
+	}
+}
+
+func TestCompleteWithoutFallbackReturnsError(t *testing.T) {
+	s := newReplayService(t, &config.Config{}, nil)
+	if _, err := s.Complete(context.Background(), fallbackTestRequest("model-a")); err == nil {
+		t.Error("Complete() expected error without fallback models")
+	}
+}
+
+func TestFallbackChain(t *testing.T) {
+	s := &CursorService{configs: config.NewManager(&config.Config{ModelFallbacks: "model-a->model-b->model-a"}, "")}
+	got := s.fallbackChain("model-a")
+	want := []string{"model-a", "model-b"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("fallbackChain() = %v, want %v", got, want)
+	}
+}
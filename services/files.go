@@ -0,0 +1,208 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrFileNotFound 文件不存在或不属于调用方
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrFileTooLarge 上传的文件超过 BATCH_MAX_FILE_SIZE_MB
+var ErrFileTooLarge = errors.New("file is too large")
+
+// storedFile 磁盘上保存的文件元数据，owner 为 API 密钥的摘要
+type storedFile struct {
+	Owner string      `json:"owner"`
+	File  models.File `json:"file"`
+}
+
+// FileStore 批处理的输入和结果文件：每个文件一个内容文件加一个 JSON 元数据文件，按 API 密钥隔离
+type FileStore struct {
+	configs *config.Manager
+	meta    jsonDir // 元数据和内容文件共用的目录
+
+	mu    sync.Mutex
+	items map[string]*storedFile
+}
+
+// NewFileStore 创建文件存储并加载目录中已有的文件，未启用批处理时返回 nil
+func NewFileStore(configs *config.Manager) (*FileStore, error) {
+	if !configs.Get().BatchEnabled {
+		return nil, nil
+	}
+	meta, err := openJSONDir(filepath.Join(configs.Get().BatchDir, "files"), "file")
+	if err != nil {
+		return nil, err
+	}
+	items, err := loadJSONDir(meta, "file metadata", func(f *storedFile) string { return f.File.ID })
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{configs: configs, meta: meta, items: items}, nil
+}
+
+// Create 保存上传的文件，超过大小限制时返回 ErrFileTooLarge
+func (fs *FileStore) Create(apiKey, filename, purpose string, content io.Reader) (*models.File, error) {
+	id := "file-" + utils.GenerateRandomString(24)
+	limit := int64(fs.configs.Get().BatchMaxFileSizeMB) << 20
+
+	out, err := os.OpenFile(fs.contentPath(id), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file: %w", err)
+	}
+	written, err := io.Copy(out, io.LimitReader(content, limit+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > limit {
+		err = ErrFileTooLarge
+	}
+	if err != nil {
+		os.Remove(fs.contentPath(id))
+		return nil, err
+	}
+
+	file, err := fs.register(ownerHash(apiKey), id, filename, purpose)
+	if err != nil {
+		os.Remove(fs.contentPath(id))
+		return nil, err
+	}
+	return file, nil
+}
+
+// register 为已写入内容的文件登记元数据
+func (fs *FileStore) register(owner, id, filename, purpose string) (*models.File, error) {
+	info, err := os.Stat(fs.contentPath(id))
+	if err != nil {
+		return nil, err
+	}
+	stored := &storedFile{Owner: owner, File: models.File{
+		ID:        id,
+		Object:    "file",
+		Bytes:     info.Size(),
+		CreatedAt: time.Now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+		Status:    "processed",
+	}}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if err := fs.save(stored); err != nil {
+		return nil, err
+	}
+	fs.items[id] = stored
+	file := stored.File
+	return &file, nil
+}
+
+// Get 获取文件元数据
+func (fs *FileStore) Get(apiKey, id string) (*models.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	stored, err := fs.lookup(apiKey, id)
+	if err != nil {
+		return nil, err
+	}
+	file := stored.File
+	return &file, nil
+}
+
+// Open 打开文件内容
+func (fs *FileStore) Open(apiKey, id string) (*os.File, error) {
+	if _, err := fs.Get(apiKey, id); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(fs.contentPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	return file, err
+}
+
+// List 按创建时间倒序列出调用方的文件，purpose 非空时只列出该用途的文件
+func (fs *FileStore) List(apiKey, purpose string) []*models.File {
+	owner := ownerHash(apiKey)
+	fs.mu.Lock()
+	var result []*models.File
+	for _, stored := range fs.items {
+		if stored.Owner == owner && (purpose == "" || stored.File.Purpose == purpose) {
+			file := stored.File
+			result = append(result, &file)
+		}
+	}
+	fs.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt != result[j].CreatedAt {
+			return result[i].CreatedAt > result[j].CreatedAt
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Delete 删除文件
+func (fs *FileStore) Delete(apiKey, id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, err := fs.lookup(apiKey, id); err != nil {
+		return err
+	}
+	if err := os.Remove(fs.contentPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := fs.meta.remove(id); err != nil {
+		return err
+	}
+	delete(fs.items, id)
+	return nil
+}
+
+// lookup 查找属于调用方的文件，调用方需持有锁
+func (fs *FileStore) lookup(apiKey, id string) (*storedFile, error) {
+	stored, ok := fs.items[id]
+	if !ok || stored.Owner != ownerHash(apiKey) {
+		return nil, ErrFileNotFound
+	}
+	return stored, nil
+}
+
+// save 原子写入文件元数据，调用方需持有锁
+func (fs *FileStore) save(stored *storedFile) error {
+	return fs.meta.save(stored.File.ID, stored)
+}
+
+func (fs *FileStore) contentPath(id string) string {
+	return filepath.Join(string(fs.meta), filepath.Base(id)+".jsonl")
+}
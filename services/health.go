@@ -0,0 +1,305 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// minNodeMajorVersion RunJS 依赖 require('crypto').webcrypto，需要 Node.js 16+
+	minNodeMajorVersion = 16
+	// upstreamFailureThreshold 连续失败达到该次数后断路器打开
+	upstreamFailureThreshold = 5
+	// upstreamBreakerCooldown 断路器打开后经过该时间进入半开状态，由下一次就绪检查探测上游
+	upstreamBreakerCooldown = 30 * time.Second
+	// scriptCacheTTL x-is-human 脚本缓存有效期
+	scriptCacheTTL = 1 * time.Minute
+)
+
+// 健康检查状态
+const (
+	HealthStatusOK      = "ok"
+	HealthStatusWarn    = "warn"
+	HealthStatusFail    = "fail"
+	HealthStatusSkipped = "skipped"
+)
+
+// HealthCheck 单项依赖检查结果
+type HealthCheck struct {
+	Status    string                 `json:"status"`
+	Message   string                 `json:"message,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	LatencyMs int64                  `json:"latency_ms"`
+}
+
+// 上游断路器状态
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// upstreamState 上游调用结果统计及断路器状态
+type upstreamState struct {
+	consecutiveFailures int
+	lastError           string
+	lastErrorTime       time.Time
+	lastSuccessTime     time.Time
+	openedAt            time.Time // 断路器打开的时间，零值表示关闭
+	probing             bool      // 半开状态下是否已有探测在进行
+}
+
+// breakerState 返回断路器状态，调用方需持有锁
+func (u *upstreamState) breakerState(now time.Time) string {
+	switch {
+	case u.openedAt.IsZero():
+		return breakerClosed
+	case now.Sub(u.openedAt) < upstreamBreakerCooldown:
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
+
+// recordUpstreamResult 记录一次上游调用结果：成功时关闭断路器，连续失败达到阈值或半开状态下失败时打开断路器
+func (s *CursorService) recordUpstreamResult(err error) {
+	s.upstreamMutex.Lock()
+	defer s.upstreamMutex.Unlock()
+
+	now := time.Now()
+	if err == nil {
+		s.upstream.consecutiveFailures = 0
+		s.upstream.lastSuccessTime = now
+		s.upstream.openedAt = time.Time{}
+		return
+	}
+	s.upstream.consecutiveFailures++
+	s.upstream.lastError = err.Error()
+	s.upstream.lastErrorTime = now
+	state := s.upstream.breakerState(now)
+	if (state == breakerClosed && s.upstream.consecutiveFailures >= upstreamFailureThreshold) || state == breakerHalfOpen {
+		s.upstream.openedAt = now
+	}
+}
+
+// ReadinessChecks 执行所有就绪检查，probe 为 true 时额外请求一次上游脚本地址
+func (s *CursorService) ReadinessChecks(ctx context.Context, probe bool) map[string]HealthCheck {
+	checks := map[string]HealthCheck{
+		"node":         timedCheck(s.checkNode),
+		"js_assets":    timedCheck(s.checkJSAssets),
+		"script_cache": timedCheck(s.checkScriptCache),
+		"upstream":     timedCheck(func() HealthCheck { return s.checkUpstreamState(ctx) }),
+	}
+	if probe {
+		checks["upstream_probe"] = timedCheck(func() HealthCheck { return s.probeUpstream(ctx) })
+	}
+	return checks
+}
+
+func timedCheck(check func() HealthCheck) HealthCheck {
+	start := time.Now()
+	result := check()
+	result.LatencyMs = time.Since(start).Milliseconds()
+	return result
+}
+
+// nodeVersion node 可执行文件路径和版本，进程内只检测一次
+type nodeVersion struct {
+	path    string
+	version string
+	err     string
+}
+
+// detectNode 查找 node 并读取版本；结果缓存，就绪检查不再每次启动子进程
+func (s *CursorService) detectNode() nodeVersion {
+	s.nodeOnce.Do(func() {
+		path, err := exec.LookPath("node")
+		if err != nil {
+			s.node = nodeVersion{err: "node binary not found in PATH"}
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		output, err := exec.CommandContext(ctx, path, "--version").Output()
+		if err != nil {
+			s.node = nodeVersion{path: path, err: fmt.Sprintf("failed to run node --version: %v", err)}
+			return
+		}
+		s.node = nodeVersion{path: path, version: strings.TrimSpace(string(output))}
+	})
+	return s.node
+}
+
+// checkNode 检查 node 可执行文件及版本
+func (s *CursorService) checkNode() HealthCheck {
+	if s.cfg().CassetteMode == config.CassetteModeReplay {
+		return HealthCheck{Status: HealthStatusSkipped, Message: "not required in replay mode"}
+	}
+
+	node := s.detectNode()
+	if node.err != "" {
+		return HealthCheck{Status: HealthStatusFail, Message: node.err}
+	}
+
+	details := map[string]interface{}{"path": node.path, "version": node.version, "js_in_flight": s.jsRunner.InFlight()}
+	major, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(node.version, "v"), ".", 2)[0])
+	if err != nil {
+		return HealthCheck{Status: HealthStatusFail, Message: "unrecognized node version", Details: details}
+	}
+	if major < minNodeMajorVersion {
+		return HealthCheck{
+			Status:  HealthStatusFail,
+			Message: fmt.Sprintf("node %s is too old, need v%d+", node.version, minNodeMajorVersion),
+			Details: details,
+		}
+	}
+	return HealthCheck{Status: HealthStatusOK, Details: details}
+}
+
+// checkJSAssets 检查 jscode 脚本是否已加载且包含必要的占位符
+func (s *CursorService) checkJSAssets() HealthCheck {
+	details := map[string]interface{}{
+		"main_js_bytes": len(s.mainJS),
+		"env_js_bytes":  len(s.envJS),
+	}
+	if s.mainJS == "" || s.envJS == "" {
+		return HealthCheck{Status: HealthStatusFail, Message: "jscode assets are empty", Details: details}
+	}
+	for _, placeholder := range []string{"$$env_jscode$$", "$$cursor_jscode$$"} {
+		if !strings.Contains(s.mainJS, placeholder) {
+			return HealthCheck{
+				Status:  HealthStatusFail,
+				Message: fmt.Sprintf("jscode/main.js is missing placeholder %s", placeholder),
+				Details: details,
+			}
+		}
+	}
+	return HealthCheck{Status: HealthStatusOK, Details: details}
+}
+
+// checkScriptCache 报告 x-is-human 脚本缓存的新鲜度；缓存过期只会在下次请求时重新获取，因此不视为失败
+func (s *CursorService) checkScriptCache() HealthCheck {
+	s.scriptMutex.RLock()
+	cached := s.scriptCache != ""
+	fetchedAt := s.scriptCacheTime
+	s.scriptMutex.RUnlock()
+
+	if !cached {
+		return HealthCheck{Status: HealthStatusOK, Message: "not fetched yet"}
+	}
+
+	age := time.Since(fetchedAt)
+	details := map[string]interface{}{
+		"fetched_at":  fetchedAt.Unix(),
+		"age_seconds": int64(age.Seconds()),
+		"ttl_seconds": int64(scriptCacheTTL.Seconds()),
+	}
+	if age > scriptCacheTTL {
+		return HealthCheck{Status: HealthStatusWarn, Message: "cache is stale and will be refreshed on next request", Details: details}
+	}
+	return HealthCheck{Status: HealthStatusOK, Details: details}
+}
+
+// checkUpstreamState 报告上游断路器状态。只有断路器打开（冷却中）时才视为失败；
+// 冷却结束后进入半开状态，由本次检查探测一次上游决定关闭还是重新打开，
+// 因此不接流量的实例也能自行恢复
+func (s *CursorService) checkUpstreamState(ctx context.Context) HealthCheck {
+	s.upstreamMutex.Lock()
+	breaker := s.upstream.breakerState(time.Now())
+	probe := breaker == breakerHalfOpen && !s.upstream.probing
+	if probe {
+		s.upstream.probing = true
+	}
+	s.upstreamMutex.Unlock()
+
+	if probe {
+		result := s.probeUpstream(ctx)
+		var err error
+		if result.Status == HealthStatusFail {
+			err = fmt.Errorf("half-open probe failed: %s", result.Message)
+		}
+		s.upstreamMutex.Lock()
+		s.upstream.probing = false
+		s.upstreamMutex.Unlock()
+		s.recordUpstreamResult(err)
+	}
+
+	s.upstreamMutex.Lock()
+	state := s.upstream
+	breaker = state.breakerState(time.Now())
+	s.upstreamMutex.Unlock()
+
+	details := map[string]interface{}{
+		"breaker":              breaker,
+		"consecutive_failures": state.consecutiveFailures,
+		"failure_threshold":    upstreamFailureThreshold,
+		"cooldown_seconds":     int64(upstreamBreakerCooldown.Seconds()),
+	}
+	if !state.lastSuccessTime.IsZero() {
+		details["last_success"] = state.lastSuccessTime.Unix()
+	}
+	if state.lastError != "" {
+		details["last_error"] = state.lastError
+		details["last_error_time"] = state.lastErrorTime.Unix()
+	}
+
+	switch {
+	case breaker == breakerOpen:
+		return HealthCheck{Status: HealthStatusFail, Message: "upstream breaker is open", Details: details}
+	case breaker == breakerHalfOpen:
+		return HealthCheck{Status: HealthStatusWarn, Message: "upstream breaker is half-open, probing", Details: details}
+	case state.consecutiveFailures > 0:
+		return HealthCheck{Status: HealthStatusWarn, Message: "recent upstream failures", Details: details}
+	default:
+		return HealthCheck{Status: HealthStatusOK, Details: details}
+	}
+}
+
+// probeUpstream 请求一次上游脚本地址，确认网络和 Cloudflare 可达
+func (s *CursorService) probeUpstream(ctx context.Context) HealthCheck {
+	if s.cfg().CassetteMode == config.CassetteModeReplay {
+		return HealthCheck{Status: HealthStatusSkipped, Message: "not required in replay mode"}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetHeaders(s.scriptHeaders()).
+		Get(s.cfg().ScriptURL)
+	if err != nil {
+		return HealthCheck{Status: HealthStatusFail, Message: err.Error()}
+	}
+
+	details := map[string]interface{}{"status_code": resp.StatusCode}
+	if resp.StatusCode != http.StatusOK {
+		return HealthCheck{Status: HealthStatusFail, Message: "unexpected upstream status", Details: details}
+	}
+	return HealthCheck{Status: HealthStatusOK, Details: details}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpstreamBreakerRecoversThroughHalfOpenProbe(t *testing.T) {
+	// 回放模式下探测被跳过，视为成功
+	s := newReplayService(t, &config.Config{}, nil)
+	for i := 0; i < upstreamFailureThreshold; i++ {
+		s.recordUpstreamResult(errors.New("boom"))
+	}
+	if check := s.checkUpstreamState(context.Background()); check.Status != HealthStatusFail {
+		t.Fatalf("status after %d failures = %s, want fail", upstreamFailureThreshold, check.Status)
+	}
+
+	// 冷却结束后由就绪检查探测并关闭断路器，不依赖真实流量
+	s.upstream.openedAt = time.Now().Add(-upstreamBreakerCooldown)
+	check := s.checkUpstreamState(context.Background())
+	if check.Status != HealthStatusOK || check.Details["breaker"] != breakerClosed {
+		t.Errorf("status after cooldown = %s (%v), want ok and closed", check.Status, check.Details["breaker"])
+	}
+}
+
+func TestUpstreamBreakerReopensOnHalfOpenFailure(t *testing.T) {
+	s := newReplayService(t, &config.Config{}, nil)
+	for i := 0; i < upstreamFailureThreshold; i++ {
+		s.recordUpstreamResult(errors.New("boom"))
+	}
+	s.upstream.openedAt = time.Now().Add(-upstreamBreakerCooldown)
+
+	// 半开状态下一次失败立即重新打开
+	s.recordUpstreamResult(errors.New("still down"))
+	if check := s.checkUpstreamState(context.Background()); check.Status != HealthStatusFail {
+		t.Errorf("status after half-open failure = %s, want fail", check.Status)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/utils"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// idempotentEntry 一个 Idempotency-Key 对应的响应；生成过程中可被重试请求附着
+type idempotentEntry struct {
+	bodyHash     string
+	id           string
+	model        string
+	fallback     bool
+	choiceModels []string
+	created      int64
+	expires      time.Time
+	started      chan struct{} // 上游建立完成（成功或失败）后关闭
+	err          error
+	stream       *broadcaster[interface{}]
+}
+
+// IdempotentResponse 幂等请求的结果
+type IdempotentResponse struct {
+	ID           string
+	Created      int64
+	Model        string
+	Fallback     bool
+	ChoiceModels []string
+	Replayed     bool
+	Stream       <-chan interface{}
+}
+
+// IdempotencyStore 按 API 密钥 + Idempotency-Key 保存响应，重试时返回相同的响应体和响应 ID
+type IdempotencyStore struct {
+	configs *config.Manager
+
+	mu      sync.Mutex
+	entries map[string]*idempotentEntry
+}
+
+// NewIdempotencyStore 创建幂等响应存储
+func NewIdempotencyStore(configs *config.Manager) *IdempotencyStore {
+	return &IdempotencyStore{
+		configs: configs,
+		entries: make(map[string]*idempotentEntry),
+	}
+}
+
+// Enabled 是否启用 Idempotency-Key 支持
+func (s *IdempotencyStore) Enabled() bool {
+	return s.configs.Get().IdempotencyWindow > 0
+}
+
+// Do 执行或回放幂等请求
+// key 首次出现时调用 start 生成响应；生成中或已完成时直接附着/回放；
+// 相同 key 对应不同的请求体时返回 409 冲突。生成过程不随客户端断开而取消，
+// 以便超时重试的客户端能接上同一次生成；失败的请求不保留，允许重试重新生成
+func (s *IdempotencyStore) Do(ctx context.Context, apiKey, key, bodyHash string, start func(ctx context.Context) (*Completion, error)) (*IdempotentResponse, error) {
+	storeKey := apiKey + "\x00" + key
+	now := time.Now()
+
+	s.mu.Lock()
+	s.evictExpired(now)
+	e, replayed := s.entries[storeKey]
+	if replayed && e.bodyHash != bodyHash {
+		s.mu.Unlock()
+		return nil, middleware.NewConflictError(
+			"Idempotency-Key has already been used with a different request body",
+			"idempotency_key_reused",
+		)
+	}
+	if !replayed {
+		e = &idempotentEntry{
+			bodyHash: bodyHash,
+			id:       utils.GenerateChatCompletionID(),
+			created:  now.Unix(),
+			expires:  now.Add(time.Duration(s.configs.Get().IdempotencyWindow) * time.Second),
+			started:  make(chan struct{}),
+			stream:   newBroadcaster[interface{}](),
+		}
+		s.entries[storeKey] = e
+		go s.run(context.WithoutCancel(ctx), storeKey, e, start)
+	}
+	s.mu.Unlock()
+
+	if replayed {
+		logrus.WithField("idempotency_key", key).Debug("Replaying idempotent request")
+	}
+
+	select {
+	case <-e.started:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	out := make(chan interface{}, 32)
+	go e.stream.subscribe(ctx, out)
+	return &IdempotentResponse{
+		ID:           e.id,
+		Created:      e.created,
+		Model:        e.model,
+		Fallback:     e.fallback,
+		ChoiceModels: e.choiceModels,
+		Replayed:     replayed,
+		Stream:       out,
+	}, nil
+}
+
+// Len 返回保存的条目数
+func (s *IdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// run 生成响应并广播给订阅者
+func (s *IdempotencyStore) run(ctx context.Context, storeKey string, e *idempotentEntry, start func(ctx context.Context) (*Completion, error)) {
+	completion, err := start(ctx)
+	if err != nil {
+		e.err = err
+		s.remove(storeKey, e)
+		e.stream.finish()
+		close(e.started)
+		return
+	}
+	e.model = completion.Model
+	e.fallback = completion.Fallback
+	e.choiceModels = completion.ChoiceModels
+	close(e.started)
+
+	failed := false
+	for item := range completion.Stream {
+		if _, isErr := item.(error); isErr {
+			failed = true
+		}
+		e.stream.publish(item)
+	}
+
+	if failed {
+		s.remove(storeKey, e)
+	}
+	e.stream.finish()
+}
+
+// evictExpired 清理已完成且过期的条目，调用方需持有 s.mu
+func (s *IdempotencyStore) evictExpired(now time.Time) {
+	for key, e := range s.entries {
+		if e.stream.finished() && now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+func (s *IdempotencyStore) remove(storeKey string, e *idempotentEntry) {
+	s.mu.Lock()
+	if s.entries[storeKey] == e {
+		delete(s.entries, storeKey)
+	}
+	s.mu.Unlock()
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestIdempotencyStore() *IdempotencyStore {
+	return NewIdempotencyStore(config.NewManager(&config.Config{IdempotencyWindow: 60}, ""))
+}
+
+func TestIdempotencyStoreReplaysResponse(t *testing.T) {
+	store := newTestIdempotencyStore()
+	var starts int32
+	upstream := make(chan interface{})
+	start := func(ctx context.Context) (*Completion, error) {
+		atomic.AddInt32(&starts, 1)
+		return &Completion{Model: "model-a", Stream: upstream}, nil
+	}
+
+	first, err := store.Do(context.Background(), "key", "idem-1", "hash", start)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	// 生成过程中重试的请求附着到同一次生成
+	attached, err := store.Do(context.Background(), "key", "idem-1", "hash", start)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if !attached.Replayed || attached.ID != first.ID {
+		t.Errorf("attached = %+v, want replay of %s", attached, first.ID)
+	}
+
+	go func() {
+		upstream <- "Hello"
+		close(upstream)
+	}()
+	if got := collectText(first.Stream); got != "Hello" {
+		t.Errorf("first stream = %q, want %q", got, "Hello")
+	}
+	if got := collectText(attached.Stream); got != "Hello" {
+		t.Errorf("attached stream = %q, want %q", got, "Hello")
+	}
+
+	// 完成后的重试直接回放
+	replay, err := store.Do(context.Background(), "key", "idem-1", "hash", start)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if replay.ID != first.ID || replay.Created != first.Created || replay.Model != "model-a" {
+		t.Errorf("replay identity = %s/%d/%s, want %s/%d/model-a", replay.ID, replay.Created, replay.Model, first.ID, first.Created)
+	}
+	if got := collectText(replay.Stream); got != "Hello" {
+		t.Errorf("replay stream = %q, want %q", got, "Hello")
+	}
+	if n := atomic.LoadInt32(&starts); n != 1 {
+		t.Errorf("start called %d times, want 1", n)
+	}
+
+	// 不同 API 密钥使用相同的 key 互不影响
+	other, err := store.Do(context.Background(), "other", "idem-1", "hash", func(ctx context.Context) (*Completion, error) {
+		out := make(chan interface{})
+		close(out)
+		return &Completion{Stream: out}, nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if other.Replayed || other.ID == first.ID {
+		t.Errorf("other API key should not share the idempotent response")
+	}
+}
+
+func TestIdempotencyStoreConflict(t *testing.T) {
+	store := newTestIdempotencyStore()
+	start := func(ctx context.Context) (*Completion, error) {
+		out := make(chan interface{})
+		close(out)
+		return &Completion{Stream: out}, nil
+	}
+
+	if _, err := store.Do(context.Background(), "key", "idem-1", "hash-a", start); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	_, err := store.Do(context.Background(), "key", "idem-1", "hash-b", start)
+	var conflict *middleware.ConflictError
+	if !errors.As(err, &conflict) {
+		t.Errorf("Do() error = %v, want ConflictError", err)
+	}
+}
+
+func TestIdempotencyStoreDropsFailedResponses(t *testing.T) {
+	store := newTestIdempotencyStore()
+	start := func(ctx context.Context) (*Completion, error) {
+		out := make(chan interface{}, 1)
+		out <- errors.New("stream failed")
+		close(out)
+		return &Completion{Stream: out}, nil
+	}
+
+	resp, err := store.Do(context.Background(), "key", "idem-1", "hash", start)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	for range resp.Stream {
+	}
+
+	retry, err := store.Do(context.Background(), "key", "idem-1", "hash", start)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if retry.Replayed {
+		t.Error("failed response should not be replayed")
+	}
+	for range retry.Stream {
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// allowPrivateImageHosts 是否允许下载内网地址的图片（仅测试使用）
+var allowPrivateImageHosts = false
+
+// resolveImages 校验请求中的图片并统一转为 data URL：data URL 直接检查类型和大小，
+// http(s) 地址先下载再检查。超出数量、单张或总大小、类型限制时返回 InvalidRequestError
+func (s *CursorService) resolveImages(ctx context.Context, request *models.ChatCompletionRequest) (*models.ChatCompletionRequest, error) {
+	if !models.HasImages(request.Messages) {
+		return request, nil
+	}
+
+	cfg := s.cfg()
+	resolved := *request
+	resolved.Messages = append([]models.Message{}, request.Messages...)
+	count, total := 0, 0
+	maxTotal := cfg.ImageMaxTotalMB << 20
+	for i := range resolved.Messages {
+		msg := &resolved.Messages[i]
+		if len(msg.Images()) == 0 {
+			continue
+		}
+
+		parts := append([]models.ContentPart{}, msg.ContentParts()...)
+		for j, part := range parts {
+			if part.Type != "image_url" {
+				continue
+			}
+			url := part.URL
+			detail := ""
+			if part.ImageURL != nil {
+				url, detail = part.ImageURL.URL, part.ImageURL.Detail
+			}
+
+			count++
+			if cfg.ImageMaxCount > 0 && count > cfg.ImageMaxCount {
+				return nil, middleware.NewInvalidRequestError(
+					fmt.Sprintf("too many images: at most %d are allowed", cfg.ImageMaxCount), "too_many_images")
+			}
+			dataURL, size, err := s.loadImage(ctx, cfg, url)
+			if err != nil {
+				return nil, err
+			}
+			if total += size; maxTotal > 0 && total > maxTotal {
+				return nil, middleware.NewInvalidRequestError(
+					fmt.Sprintf("images in one request exceed %d MB in total", cfg.ImageMaxTotalMB), "images_too_large")
+			}
+			parts[j] = models.ContentPart{Type: "image_url", ImageURL: &models.ImageURL{URL: dataURL, Detail: detail}}
+		}
+		msg.Content = parts
+	}
+	return &resolved, nil
+}
+
+// loadImage 读取图片并返回 data URL 和解码后的字节数
+// data URL 在解码前先按编码长度检查大小，媒体类型以内容嗅探结果为准
+func (s *CursorService) loadImage(ctx context.Context, cfg *config.Config, url string) (string, int, error) {
+	var mediaType string
+	var data []byte
+	switch {
+	case strings.HasPrefix(url, "data:"):
+		header, payload, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return "", 0, middleware.NewInvalidRequestError("image data URLs must be base64 encoded", "invalid_image_url")
+		}
+		if err := checkImageSize(cfg, decodedBase64Len(payload)); err != nil {
+			return "", 0, err
+		}
+		decoded, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return "", 0, middleware.NewInvalidRequestError("image data URL is not valid base64", "invalid_image_url")
+		}
+		mediaType, _, _ = strings.Cut(http.DetectContentType(decoded), ";")
+		data = decoded
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"):
+		var err error
+		if mediaType, data, err = s.fetchImage(ctx, cfg, url); err != nil {
+			return "", 0, err
+		}
+	default:
+		return "", 0, middleware.NewInvalidRequestError("image_url must be an http(s) URL or a data URL", "invalid_image_url")
+	}
+
+	if err := checkImage(cfg, mediaType, len(data)); err != nil {
+		return "", 0, err
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), len(data), nil
+}
+
+// decodedBase64Len 计算 base64 内容解码后的字节数，不实际解码
+func decodedBase64Len(payload string) int {
+	n := len(payload) / 4 * 3
+	if strings.HasSuffix(payload, "==") {
+		n -= 2
+	} else if strings.HasSuffix(payload, "=") {
+		n--
+	}
+	return n
+}
+
+// checkImageSize 检查单张图片大小
+func checkImageSize(cfg *config.Config, size int) error {
+	if maxBytes := cfg.ImageMaxSizeMB << 20; maxBytes > 0 && size > maxBytes {
+		return middleware.NewInvalidRequestError(
+			fmt.Sprintf("image is larger than %d MB", cfg.ImageMaxSizeMB), "image_too_large")
+	}
+	return nil
+}
+
+// checkImage 检查图片类型和大小是否在允许范围内
+func checkImage(cfg *config.Config, mediaType string, size int) error {
+	if err := checkImageSize(cfg, size); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return middleware.NewInvalidRequestError(
+			fmt.Sprintf("content is not an image (%s)", mediaType), "unsupported_image_type")
+	}
+	if allowed := cfg.GetImageAllowedTypes(); len(allowed) > 0 && !containsFold(allowed, mediaType) {
+		return middleware.NewInvalidRequestError(
+			fmt.Sprintf("unsupported image type %q, allowed: %s", mediaType, strings.Join(allowed, ", ")), "unsupported_image_type")
+	}
+	return nil
+}
+
+// fetchImage 下载图片，返回媒体类型和内容；超过大小限制时提前中止
+func (s *CursorService) fetchImage(ctx context.Context, cfg *config.Config, url string) (string, []byte, error) {
+	timeout := time.Duration(cfg.ImageFetchTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	fetchErr := func(err error) error {
+		return middleware.NewInvalidRequestError(fmt.Sprintf("failed to download image %s: %v", url, err), "image_fetch_failed")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", nil, middleware.NewInvalidRequestError("invalid image URL: "+url, "invalid_image_url")
+	}
+	resp, err := imageHTTPClient.Do(req)
+	if err != nil {
+		return "", nil, fetchErr(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fetchErr(fmt.Errorf("status %d", resp.StatusCode))
+	}
+
+	body := io.Reader(resp.Body)
+	if maxBytes := cfg.ImageMaxSizeMB << 20; maxBytes > 0 {
+		body = io.LimitReader(resp.Body, int64(maxBytes)+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", nil, fetchErr(err)
+	}
+
+	// 媒体类型以内容嗅探结果为准；响应头声明了具体类型但与内容不符时拒绝
+	mediaType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	declared, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	if declared != "" && declared != "application/octet-stream" && declared != mediaType {
+		return "", nil, middleware.NewInvalidRequestError(
+			fmt.Sprintf("image %s is served as %s but its content is %s", url, declared, mediaType), "unsupported_image_type")
+	}
+	return mediaType, data, nil
+}
+
+// imageHTTPClient 下载图片使用的客户端，默认拒绝连接回环、内网等地址
+var imageHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip != nil && !allowPrivateImageHosts && !isPublicIP(ip) {
+					return errors.New("image host resolves to a non-public address")
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// isPublicIP 判断地址是否为公网地址
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast())
+}
+
+// containsFold 判断列表中是否有与 value 忽略大小写相等的项
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
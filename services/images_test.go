@@ -0,0 +1,152 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// pngHeader 足以被识别为 PNG 的文件头
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func imageRequest(url string) *models.ChatCompletionRequest {
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: []interface{}{
+		map[string]interface{}{"type": "text", "text": "What is this?"},
+		map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}},
+	}}}
+	return request
+}
+
+func TestResolveImages(t *testing.T) {
+	allowPrivateImageHosts = true
+	defer func() { allowPrivateImageHosts = false }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pngHeader)
+	}))
+	defer server.Close()
+
+	dataURL := "data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader)
+	s := newReplayService(t, &config.Config{ImageAllowedTypes: "image/png,image/jpeg"}, nil)
+
+	for _, url := range []string{dataURL, server.URL + "/cat"} {
+		resolved, err := s.resolveImages(context.Background(), imageRequest(url))
+		if err != nil {
+			t.Fatalf("resolveImages(%s) error = %v", url, err)
+		}
+		if images := resolved.Messages[0].Images(); len(images) != 1 || images[0] != dataURL {
+			t.Errorf("images = %v, want the PNG as a data URL", images)
+		}
+
+		parts := s.buildCursorRequest(resolved).Messages[0].Parts
+		if len(parts) != 2 || parts[0].Text != "What is this?" || parts[1].Type != "file" || parts[1].MediaType != "image/png" {
+			t.Errorf("cursor parts = %+v, want text and image file parts", parts)
+		}
+	}
+}
+
+func TestResolveImagesLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.Config
+		url  string
+		code string
+	}{
+		{"type not allowed", &config.Config{ImageAllowedTypes: "image/jpeg"},
+			"data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader), "unsupported_image_type"},
+		{"too large", &config.Config{ImageMaxSizeMB: 1},
+			"data:image/png;base64," + base64.StdEncoding.EncodeToString(make([]byte, 1<<20+1)), "image_too_large"},
+		{"not base64", &config.Config{}, "data:image/png,abc", "invalid_image_url"},
+		{"declared type does not match content", &config.Config{ImageAllowedTypes: "image/png"},
+			"data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("<html>not an image</html>")), "unsupported_image_type"},
+		{"unsupported scheme", &config.Config{}, "file:///etc/passwd", "invalid_image_url"},
+		{"private host", &config.Config{}, "http://127.0.0.1:1/cat.png", "image_fetch_failed"},
+		{"data URL is not an image", &config.Config{},
+			"data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("<html>not an image</html>")), "unsupported_image_type"},
+		{"served type does not match content", &config.Config{}, "/mislabeled", "unsupported_image_type"},
+		{"served content is not an image", &config.Config{}, "/page", "unsupported_image_type"},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/mislabeled" {
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(pngHeader)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>not an image</html>"))
+	}))
+	defer server.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 路径形式的地址由本地测试服务器提供，只对它们放开内网地址
+			if strings.HasPrefix(tt.url, "/") {
+				tt.url = server.URL + tt.url
+				allowPrivateImageHosts = true
+				defer func() { allowPrivateImageHosts = false }()
+			}
+			s := newReplayService(t, tt.cfg, nil)
+			_, err := s.resolveImages(context.Background(), imageRequest(tt.url))
+			var invalid *middleware.InvalidRequestError
+			if !errors.As(err, &invalid) || invalid.Code != tt.code {
+				t.Errorf("resolveImages() error = %v, want code %s", err, tt.code)
+			}
+		})
+	}
+
+	// 超过数量限制
+	s := newReplayService(t, &config.Config{ImageMaxCount: 1}, nil)
+	request := imageRequest("data:image/png;base64," + base64.StdEncoding.EncodeToString(pngHeader))
+	request.Messages = append(request.Messages, request.Messages[0])
+	if _, err := s.resolveImages(context.Background(), request); err == nil || !strings.Contains(err.Error(), "too many images") {
+		t.Errorf("resolveImages() error = %v, want too many images", err)
+	}
+
+	// 超过单次请求的总大小限制
+	s = newReplayService(t, &config.Config{ImageMaxSizeMB: 1, ImageMaxTotalMB: 1}, nil)
+	large := append(append([]byte{}, pngHeader...), make([]byte, 600<<10)...)
+	request = imageRequest("data:image/png;base64," + base64.StdEncoding.EncodeToString(large))
+	request.Messages = append(request.Messages, request.Messages[0])
+	var invalid *middleware.InvalidRequestError
+	if _, err := s.resolveImages(context.Background(), request); !errors.As(err, &invalid) || invalid.Code != "images_too_large" {
+		t.Errorf("resolveImages() error = %v, want images_too_large", err)
+	}
+}
+
+func TestDecodedBase64Len(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 4, 100} {
+		payload := base64.StdEncoding.EncodeToString(make([]byte, n))
+		if got := decodedBase64Len(payload); got != n {
+			t.Errorf("decodedBase64Len(%d bytes) = %d", n, got)
+		}
+	}
+}
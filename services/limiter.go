@@ -0,0 +1,346 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// limiterPriorities 按调度顺序排列的优先级
+var limiterPriorities = []string{config.PriorityHigh, config.PriorityNormal, config.PriorityLow}
+
+// limiterWaiter 一个排队中的请求
+type limiterWaiter struct {
+	ready    chan struct{}
+	granted  bool
+	enqueued time.Time
+}
+
+// keyQueue 单个 API 密钥在某个优先级下的等待队列
+type keyQueue struct {
+	key     string
+	weight  int
+	credit  int
+	waiters []*limiterWaiter
+}
+
+// priorityClass 同一优先级内各密钥的队列，按权重轮询调度
+type priorityClass struct {
+	queues []*keyQueue
+	index  map[string]*keyQueue
+	next   int
+}
+
+// ErrQueueTimeout 排队超过最大等待时间
+type ErrQueueTimeout struct {
+	Waited time.Duration
+}
+
+func (e *ErrQueueTimeout) Error() string {
+	return "timed out waiting for an upstream slot after " + e.Waited.Round(time.Millisecond).String()
+}
+
+// Limiter 上游并发限制器：超出并发上限的请求进入等待队列，
+// 高优先级先调度，同一优先级内按 API 密钥加权轮询，避免单个密钥占满上游
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	classes  map[string]*priorityClass
+
+	admitted  int64
+	timeouts  int64
+	waitTotal time.Duration
+	waitMax   time.Duration
+}
+
+// LimiterStats 限制器状态快照
+type LimiterStats struct {
+	Limit            int            `json:"limit"`
+	InFlight         int            `json:"in_flight"`
+	QueueDepth       int            `json:"queue_depth"`
+	QueueByPriority  map[string]int `json:"queue_by_priority"`
+	QueueByKey       map[string]int `json:"queue_by_key"`
+	Admitted         int64          `json:"admitted_total"`
+	Timeouts         int64          `json:"timeouts_total"`
+	WaitSecondsTotal float64        `json:"wait_seconds_total"`
+	WaitSecondsMax   float64        `json:"wait_seconds_max"`
+	Adaptive         *AdaptiveStats `json:"adaptive,omitempty"`
+}
+
+// NewLimiter 创建并发限制器，limit 为 0 表示不限制
+func NewLimiter(limit int) *Limiter {
+	l := &Limiter{
+		limit:   limit,
+		classes: make(map[string]*priorityClass),
+	}
+	for _, priority := range limiterPriorities {
+		l.classes[priority] = &priorityClass{index: make(map[string]*keyQueue)}
+	}
+	return l
+}
+
+// SetLimit 调整并发上限，放宽时立即调度排队中的请求
+func (l *Limiter) SetLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.dispatch()
+}
+
+// Limit 返回当前并发上限
+func (l *Limiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// Acquire 获取一个上游名额，返回的 release 在上游流结束后调用
+// 排队超过 maxWait（0 表示不限）返回 *ErrQueueTimeout；ctx 取消时返回 ctx.Err()
+func (l *Limiter) Acquire(ctx context.Context, key string, weight int, priority string, maxWait time.Duration) (func(), error) {
+	l.mu.Lock()
+	if l.limit <= 0 || (l.inFlight < l.limit && l.queueDepth() == 0) {
+		l.inFlight++
+		l.admitted++
+		l.mu.Unlock()
+		return l.releaseFunc(), nil
+	}
+
+	w := &limiterWaiter{ready: make(chan struct{}), enqueued: time.Now()}
+	class, ok := l.classes[priority]
+	if !ok {
+		class = l.classes[config.PriorityNormal]
+	}
+	class.push(key, weight, w)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-w.ready:
+		return l.releaseFunc(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = &ErrQueueTimeout{Waited: maxWait}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		// 超时与调度同时发生：已经拿到名额，未取消时照常使用
+		if ctx.Err() == nil {
+			return l.releaseFunc(), nil
+		}
+		l.inFlight--
+		l.dispatch()
+		return nil, err
+	}
+	class.removeWaiter(key, w)
+	if _, ok := err.(*ErrQueueTimeout); ok {
+		l.timeouts++
+	}
+	return nil, err
+}
+
+// Stats 返回限制器状态快照，密钥已脱敏
+func (l *Limiter) Stats() LimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := LimiterStats{
+		Limit:            l.limit,
+		InFlight:         l.inFlight,
+		QueueByPriority:  make(map[string]int),
+		QueueByKey:       make(map[string]int),
+		Admitted:         l.admitted,
+		Timeouts:         l.timeouts,
+		WaitSecondsTotal: l.waitTotal.Seconds(),
+		WaitSecondsMax:   l.waitMax.Seconds(),
+	}
+	for _, priority := range limiterPriorities {
+		depth := 0
+		for _, q := range l.classes[priority].queues {
+			depth += len(q.waiters)
+			stats.QueueByKey[maskKey(q.key)] += len(q.waiters)
+		}
+		stats.QueueByPriority[priority] = depth
+		stats.QueueDepth += depth
+	}
+	return stats
+}
+
+func (l *Limiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.inFlight--
+			l.dispatch()
+			l.mu.Unlock()
+		})
+	}
+}
+
+// dispatch 在有空闲名额时按优先级和权重唤醒等待者，调用方需持有 l.mu
+func (l *Limiter) dispatch() {
+	for l.limit <= 0 || l.inFlight < l.limit {
+		var w *limiterWaiter
+		for _, priority := range limiterPriorities {
+			if w = l.classes[priority].pop(); w != nil {
+				break
+			}
+		}
+		if w == nil {
+			return
+		}
+
+		waited := time.Since(w.enqueued)
+		l.waitTotal += waited
+		if waited > l.waitMax {
+			l.waitMax = waited
+		}
+		l.admitted++
+		l.inFlight++
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+func (l *Limiter) queueDepth() int {
+	depth := 0
+	for _, class := range l.classes {
+		for _, q := range class.queues {
+			depth += len(q.waiters)
+		}
+	}
+	return depth
+}
+
+func (c *priorityClass) push(key string, weight int, w *limiterWaiter) {
+	if weight <= 0 {
+		weight = 1
+	}
+	q, ok := c.index[key]
+	if !ok {
+		q = &keyQueue{key: key}
+		c.index[key] = q
+		c.queues = append(c.queues, q)
+	}
+	q.weight = weight
+	q.waiters = append(q.waiters, w)
+}
+
+// pop 加权轮询：当前密钥连续调度 weight 次后轮到下一个密钥
+func (c *priorityClass) pop() *limiterWaiter {
+	for len(c.queues) > 0 {
+		if c.next >= len(c.queues) {
+			c.next = 0
+		}
+		q := c.queues[c.next]
+		if len(q.waiters) == 0 {
+			c.removeQueue(c.next)
+			continue
+		}
+
+		if q.credit <= 0 {
+			q.credit = q.weight
+		}
+		w := q.waiters[0]
+		q.waiters = q.waiters[1:]
+		q.credit--
+
+		if len(q.waiters) == 0 {
+			q.credit = 0
+			c.removeQueue(c.next)
+		} else if q.credit == 0 {
+			c.next++
+		}
+		return w
+	}
+	return nil
+}
+
+func (c *priorityClass) removeWaiter(key string, w *limiterWaiter) {
+	q, ok := c.index[key]
+	if !ok {
+		return
+	}
+	for i, waiter := range q.waiters {
+		if waiter == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			break
+		}
+	}
+	if len(q.waiters) == 0 {
+		for i := range c.queues {
+			if c.queues[i] == q {
+				c.removeQueue(i)
+				break
+			}
+		}
+	}
+}
+
+// removeQueue 移除第 i 个队列，保持轮询位置指向下一个密钥
+func (c *priorityClass) removeQueue(i int) {
+	delete(c.index, c.queues[i].key)
+	c.queues = append(c.queues[:i], c.queues[i+1:]...)
+	if i < c.next {
+		c.next--
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority 将请求头中声明的优先级（X-Priority）附加到上下文
+func WithPriority(ctx context.Context, priority string) context.Context {
+	return context.WithValue(ctx, priorityKey{}, strings.ToLower(strings.TrimSpace(priority)))
+}
+
+// requestPriority 解析请求优先级：API 密钥配置的优先级是上限，X-Priority 只能在此范围内降低
+func requestPriority(ctx context.Context, cfg *config.Config, apiKey string) string {
+	keyPriority := cfg.GetLimiterKeyPriority(apiKey)
+	requested, _ := ctx.Value(priorityKey{}).(string)
+	if !config.IsValidPriority(requested) || priorityRank(requested) > priorityRank(keyPriority) {
+		return keyPriority
+	}
+	return requested
+}
+
+func priorityRank(priority string) int {
+	for i, p := range limiterPriorities {
+		if p == priority {
+			return len(limiterPriorities) - i
+		}
+	}
+	return 0
+}
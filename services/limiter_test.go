@@ -0,0 +1,165 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"errors"
+	"testing"
+	"time"
+)
+
+// acquireAsync 在后台排队，返回获得名额的通知通道
+func acquireAsync(t *testing.T, l *Limiter, key string, weight int, priority string, order chan<- string) {
+	t.Helper()
+	go func() {
+		release, err := l.Acquire(context.Background(), key, weight, priority, 0)
+		if err != nil {
+			t.Errorf("Acquire(%s) error = %v", key, err)
+			return
+		}
+		order <- key
+		release()
+	}()
+}
+
+// waitQueued 等待排队数量达到 n
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for l.Stats().QueueDepth < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth = %d, want %d", l.Stats().QueueDepth, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimiterWeightedRoundRobin(t *testing.T) {
+	l := NewLimiter(1)
+	hold, err := l.Acquire(context.Background(), "holder", 1, config.PriorityNormal, 0)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	order := make(chan string, 6)
+	// 密钥 a 权重 2、先排 4 个请求；密钥 b 权重 1、排 2 个
+	for i := 0; i < 4; i++ {
+		acquireAsync(t, l, "a", 2, config.PriorityNormal, order)
+		waitQueued(t, l, i+1)
+	}
+	for i := 0; i < 2; i++ {
+		acquireAsync(t, l, "b", 1, config.PriorityNormal, order)
+		waitQueued(t, l, 5+i)
+	}
+	hold()
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		select {
+		case key := <-order:
+			got = append(got, key)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out, order so far %v", got)
+		}
+	}
+	want := []string{"a", "a", "b", "a", "a", "b"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestLimiterPriority(t *testing.T) {
+	l := NewLimiter(1)
+	hold, _ := l.Acquire(context.Background(), "holder", 1, config.PriorityNormal, 0)
+
+	order := make(chan string, 3)
+	acquireAsync(t, l, "low", 1, config.PriorityLow, order)
+	waitQueued(t, l, 1)
+	acquireAsync(t, l, "normal", 1, config.PriorityNormal, order)
+	waitQueued(t, l, 2)
+	acquireAsync(t, l, "high", 1, config.PriorityHigh, order)
+	waitQueued(t, l, 3)
+	hold()
+
+	for _, want := range []string{"high", "normal", "low"} {
+		if got := <-order; got != want {
+			t.Fatalf("admitted %s, want %s", got, want)
+		}
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := NewLimiter(1)
+	hold, _ := l.Acquire(context.Background(), "holder", 1, config.PriorityNormal, 0)
+	defer hold()
+
+	_, err := l.Acquire(context.Background(), "a", 1, config.PriorityNormal, 20*time.Millisecond)
+	var timeout *ErrQueueTimeout
+	if !errors.As(err, &timeout) {
+		t.Fatalf("Acquire() error = %v, want ErrQueueTimeout", err)
+	}
+
+	stats := l.Stats()
+	if stats.Timeouts != 1 || stats.QueueDepth != 0 || stats.InFlight != 1 {
+		t.Errorf("stats = %+v, want 1 timeout, empty queue, 1 in flight", stats)
+	}
+}
+
+func TestLimiterSetLimitDispatches(t *testing.T) {
+	l := NewLimiter(1)
+	hold, _ := l.Acquire(context.Background(), "holder", 1, config.PriorityNormal, 0)
+	defer hold()
+
+	order := make(chan string, 1)
+	acquireAsync(t, l, "a", 1, config.PriorityNormal, order)
+	waitQueued(t, l, 1)
+	l.SetLimit(2)
+
+	select {
+	case <-order:
+	case <-time.After(2 * time.Second):
+		t.Fatal("raising the limit did not admit the queued request")
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	cfg := &config.Config{LimiterKeyPriorities: "vip:high"}
+	tests := []struct {
+		key, header, want string
+	}{
+		{"vip", "", config.PriorityHigh},
+		{"vip", "low", config.PriorityLow},
+		{"other", "", config.PriorityNormal},
+		{"other", "high", config.PriorityNormal},
+		{"other", "LOW", config.PriorityLow},
+		{"other", "bogus", config.PriorityNormal},
+	}
+	for _, tt := range tests {
+		ctx := WithPriority(context.Background(), tt.header)
+		if got := requestPriority(ctx, cfg, tt.key); got != tt.want {
+			t.Errorf("requestPriority(%s, %q) = %s, want %s", tt.key, tt.header, got, tt.want)
+		}
+	}
+}
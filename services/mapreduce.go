@@ -0,0 +1,339 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// mapReduceExcerptBytes 超长消息保留开头和结尾各多少字节，作为提取时的任务说明和回答时的原文摘录
+	mapReduceExcerptBytes = 1000
+	// mapReduceCondenseRounds 要点放不下时最多再提取几轮
+	mapReduceCondenseRounds = 2
+
+	notesTruncatedMarker = "\n... [notes truncated]"
+
+	mapPrompt = "You are reading part %d of %d of a long input that is too large to read at once.\n" +
+		"Task:\n%s\n\n" +
+		"Extract everything in this part that is relevant to the task: facts, figures, names, code and quotes, as concise notes. " +
+		"Reply with NONE if nothing in this part is relevant.\n\n" +
+		"Part %d of %d:\n%s"
+)
+
+// oversizedMessages 开启 map-reduce 时返回超过 MAX_INPUT_LENGTH 的消息下标（系统消息除外）
+func (s *CursorService) oversizedMessages(request *models.ChatCompletionRequest) []int {
+	cfg := s.cfg()
+	if !cfg.MapReduceEnabled || cfg.MaxInputLength <= 0 {
+		return nil
+	}
+	var oversized []int
+	for i := range request.Messages {
+		role := strings.ToLower(request.Messages[i].Role)
+		if role != "system" && role != "developer" && len(request.Messages[i].GetStringContent()) > cfg.MaxInputLength {
+			oversized = append(oversized, i)
+		}
+	}
+	return oversized
+}
+
+// completeMapReduce 处理超长的单条消息：按 token 上限分块，并行请求上游逐块提取要点（map），
+// 再用各块要点替换原消息，按正常流程回答原问题（reduce）。要点合并后超过 MAX_INPUT_LENGTH 时
+// 再分块提取一轮，仍然放不下时截断。提取在返回后进行，进度以 models.Progress 实时输出在流的开头，
+// 提取或回答失败时以错误项结束流；Completion.Model 为路由到的模型，用量为所有请求之和。
+// 需要的块数超过 MAP_REDUCE_MAX_CHUNKS 时直接返回错误
+func (s *CursorService) completeMapReduce(ctx context.Context, request *models.ChatCompletionRequest, oversized []int) (*Completion, error) {
+	cfg := s.cfg()
+	chunkBytes := cfg.MapReduceChunkTokens * 4
+	chunks := make(map[int][]string, len(oversized))
+	total := 0
+	for _, i := range oversized {
+		chunks[i] = splitChunks(request.Messages[i].GetStringContent(), chunkBytes)
+		total += len(chunks[i])
+	}
+	if total > cfg.MapReduceMaxChunks {
+		return nil, middleware.NewInvalidRequestError(fmt.Sprintf(
+			"input is too large: it would need %d chunks, at most %d are allowed", total, cfg.MapReduceMaxChunks), "input_too_large")
+	}
+	limit := reduceLimit(cfg, request, oversized)
+	if limit < mapReduceExcerptBytes {
+		return nil, middleware.NewInvalidRequestError(
+			"input is too large: the other messages leave no room for the notes extracted from the oversized message", "input_too_large")
+	}
+
+	model := s.routeModel(ctx, request)
+	out := make(chan interface{}, 32)
+	go func() {
+		defer close(out)
+		send := func(item interface{}) bool {
+			select {
+			case out <- item:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// 进度在提取过程中实时输出，并行提取的各块都会调用
+		report := func(message string) {
+			send(models.Progress{Message: message})
+		}
+
+		report(fmt.Sprintf("map-reduce: split oversized input into %d chunks", total))
+		usage, notes, err := s.mapChunks(ctx, request, model, chunks, total, report)
+		if err != nil {
+			send(err)
+			return
+		}
+
+		// 合并后的要点放不下时，把要点本身再分块提取（递归 reduce）
+		for round := 1; round <= mapReduceCondenseRounds; round++ {
+			condense := make(map[int][]string)
+			count := 0
+			for _, i := range oversized {
+				if len(reduceContent(request.Messages[i].GetStringContent(), notes[i])) > limit {
+					condense[i] = splitChunks(strings.Join(notes[i], "\n\n"), chunkBytes)
+					count += len(condense[i])
+				}
+			}
+			if len(condense) == 0 {
+				break
+			}
+			report(fmt.Sprintf("map-reduce: condensing notes into %d chunks (round %d)", count, round))
+			roundUsage, condensed, err := s.mapChunks(ctx, request, model, condense, count, report)
+			if err != nil {
+				send(err)
+				return
+			}
+			usage.Add(roundUsage)
+			for i, parts := range condensed {
+				notes[i] = parts
+			}
+		}
+
+		report("map-reduce: answering from the extracted notes")
+		completion, err := s.completeRequest(ctx, reduceRequest(request, notes, limit))
+		if err != nil {
+			send(err)
+			return
+		}
+		for item := range completion.Stream {
+			if v, ok := item.(models.Usage); ok {
+				v.Add(usage)
+				item = v
+			}
+			if !send(item) {
+				go drain(completion.Stream)
+				return
+			}
+		}
+	}()
+
+	return &Completion{Model: model, Stream: out}, nil
+}
+
+// reduceLimit 每条超长消息在回答请求中最多占用的字节数：MAX_INPUT_LENGTH 减去其余消息后平分，
+// 超出时 truncateMessages 会整条丢弃
+func reduceLimit(cfg *config.Config, request *models.ChatCompletionRequest, oversized []int) int {
+	rest := cfg.MaxInputLength
+	for i := range request.Messages {
+		if !slices.Contains(oversized, i) {
+			rest -= len(request.Messages[i].GetStringContent())
+		}
+	}
+	return rest / len(oversized)
+}
+
+// mapChunks 并行提取各块要点，每完成一块报告一次进度；返回用量之和和每条消息按块顺序排列的要点
+func (s *CursorService) mapChunks(ctx context.Context, request *models.ChatCompletionRequest, model string,
+	chunks map[int][]string, total int, report func(string)) (models.Usage, map[int][]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		usage    models.Usage
+		firstErr error
+		done     int
+	)
+	notes := make(map[int][]string, len(chunks))
+	sem := make(chan struct{}, max(s.cfg().MapReduceConcurrency, 1))
+	for i, parts := range chunks {
+		notes[i] = make([]string, len(parts))
+		task := mapTask(request, i)
+		for j, chunk := range parts {
+			wg.Add(1)
+			go func(i, j int, chunk string) {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+					defer func() { <-sem }()
+				case <-ctx.Done():
+					return
+				}
+
+				text, chunkUsage, err := s.mapChunk(ctx, mapRequest(request, model, task, chunk, j, len(chunks[i])))
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					return
+				}
+				usage.Add(chunkUsage)
+				notes[i][j] = text
+				done++
+				processed := done
+				mu.Unlock()
+
+				report(fmt.Sprintf("map-reduce: %d/%d chunks processed", processed, total))
+			}(i, j, chunk)
+		}
+	}
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		logrus.WithError(firstErr).Warn("Map-reduce extraction failed")
+	}
+	return usage, notes, firstErr
+}
+
+// mapChunk 请求上游提取一块的要点
+func (s *CursorService) mapChunk(ctx context.Context, request *models.ChatCompletionRequest) (string, models.Usage, error) {
+	completion, err := s.completeWithFallback(ctx, request, request.Model)
+	if err != nil {
+		return "", models.Usage{}, err
+	}
+	text, usage, err := collectCompletion(completion.Stream)
+	return strings.TrimSpace(text), usage, err
+}
+
+// mapRequest 构造提取一块要点的请求
+func mapRequest(request *models.ChatCompletionRequest, model, task, chunk string, index, total int) *models.ChatCompletionRequest {
+	return &models.ChatCompletionRequest{
+		Model:    model,
+		User:     request.User,
+		Messages: []models.Message{{Role: "user", Content: fmt.Sprintf(mapPrompt, index+1, total, task, index+1, total, chunk)}},
+	}
+}
+
+// mapTask 提取时的任务说明：超长消息之后有 user 消息时取最后一条，否则取超长消息本身的开头和结尾
+func mapTask(request *models.ChatCompletionRequest, index int) string {
+	for i := len(request.Messages) - 1; i > index; i-- {
+		if strings.EqualFold(request.Messages[i].Role, "user") {
+			return excerpt(request.Messages[i].GetStringContent())
+		}
+	}
+	return excerpt(request.Messages[index].GetStringContent())
+}
+
+// reduceRequest 用各块要点替换超长消息，原消息的开头和结尾作为摘录保留；
+// 替换后的内容超过 limit 字节时截断要点
+func reduceRequest(request *models.ChatCompletionRequest, notes map[int][]string, limit int) *models.ChatCompletionRequest {
+	reduced := *request
+	reduced.Messages = append([]models.Message{}, request.Messages...)
+	for i, parts := range notes {
+		content := reduceContent(request.Messages[i].GetStringContent(), parts)
+		if len(content) > limit {
+			content = truncateBytes(content, max(limit-len(notesTruncatedMarker), 0)) + notesTruncatedMarker
+		}
+
+		msg := &reduced.Messages[i]
+		if images := msg.Images(); len(images) > 0 {
+			contentParts := []models.ContentPart{{Type: "text", Text: content}}
+			for _, image := range images {
+				contentParts = append(contentParts, models.ContentPart{Type: "image_url", ImageURL: &models.ImageURL{URL: image}})
+			}
+			msg.Content = contentParts
+		} else {
+			msg.Content = content
+		}
+	}
+	return &reduced
+}
+
+// reduceContent 替换超长消息的内容：原消息的开头和结尾加上各块要点
+func reduceContent(original string, notes []string) string {
+	var content strings.Builder
+	fmt.Fprintf(&content, "[This message was too long (%d characters) and was processed in %d parts. Its beginning and end:]\n%s\n\n[Notes extracted from each part:]",
+		len(original), len(notes), excerpt(original))
+	for j, note := range notes {
+		fmt.Fprintf(&content, "\n\n[Part %d/%d]\n%s", j+1, len(notes), note)
+	}
+	return content.String()
+}
+
+// splitChunks 按行把文本切成不超过 maxBytes 的块，过长的行再按字节切开（不切断多字节字符）
+func splitChunks(text string, maxBytes int) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+	}
+	for _, line := range strings.SplitAfter(text, "\n") {
+		for len(line) > maxBytes {
+			flush()
+			head := truncateBytes(line, maxBytes)
+			if head == "" {
+				head = line[:maxBytes]
+			}
+			chunks = append(chunks, head)
+			line = line[len(head):]
+		}
+		if current.Len()+len(line) > maxBytes {
+			flush()
+		}
+		current.WriteString(line)
+	}
+	flush()
+	return chunks
+}
+
+// excerpt 保留文本的开头和结尾
+func excerpt(text string) string {
+	if len(text) <= 2*mapReduceExcerptBytes {
+		return text
+	}
+	head := truncateBytes(text, mapReduceExcerptBytes)
+	start := len(text) - mapReduceExcerptBytes
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	return head + "\n...\n" + text[start:]
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newMapReduceService(t *testing.T) *CursorService {
+	t.Helper()
+	s := newReplayService(t, &config.Config{}, nil)
+	s.configs = config.NewManager(&config.Config{
+		CassetteMode:         config.CassetteModeReplay,
+		MaxInputLength:       4000,
+		MapReduceEnabled:     true,
+		MapReduceChunkTokens: 300,
+		MapReduceMaxChunks:   8,
+		MapReduceConcurrency: 2,
+	}, "")
+	return s
+}
+
+// mapReduceInput 4 行、每行 1200 字节，按 1200 字节分块正好 4 块
+func mapReduceInput() (string, []string) {
+	var lines []string
+	for _, word := range []string{"alpha", "beta", "gamma", "delta"} {
+		lines = append(lines, word+" "+strings.Repeat(word[:1], 1199-len(word)-1)+"\n")
+	}
+	return strings.Join(lines, ""), lines
+}
+
+func TestCompleteMapReduce(t *testing.T) {
+	s := newMapReduceService(t)
+	big, lines := mapReduceInput()
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: big}}
+
+	chunks := splitChunks(big, 1200)
+	if len(chunks) != 4 || chunks[0] != lines[0] || strings.Join(chunks, "") != big {
+		t.Fatalf("splitChunks() = %d chunks", len(chunks))
+	}
+	task := mapTask(request, 0)
+	for i, chunk := range chunks {
+		recordCassette(s, mapRequest(request, "model-a", task, chunk, i, len(chunks)), delta("note "+strings.Fields(chunk)[0]))
+	}
+	reduced := reduceRequest(request, map[int][]string{0: {"note alpha", "note beta", "note gamma", "note delta"}}, 4000)
+	recordCassette(s, reduced, delta("answer"))
+
+	completion, err := s.Complete(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if completion.Model != "model-a" {
+		t.Errorf("Model = %s, want the routed model", completion.Model)
+	}
+	var text strings.Builder
+	var progress []string
+	for item := range completion.Stream {
+		switch v := item.(type) {
+		case string:
+			text.WriteString(v)
+		case models.Progress:
+			if text.Len() > 0 {
+				t.Errorf("progress %q arrived after the answer", v.Message)
+			}
+			progress = append(progress, v.Message)
+		case error:
+			t.Fatalf("stream error = %v", v)
+		}
+	}
+	if text.String() != "answer" {
+		t.Errorf("output = %q, want %q", text.String(), "answer")
+	}
+	// 分块、每块完成各一次、开始回答
+	if len(progress) != 6 || !slices.Contains(progress, "map-reduce: 4/4 chunks processed") {
+		t.Errorf("progress = %q", progress)
+	}
+	if content := reduced.Messages[0].GetStringContent(); !strings.Contains(content, "[Part 2/4]\nnote beta") {
+		t.Errorf("reduced message = %q", content)
+	}
+}
+
+func TestCompleteMapReduceCondensesNotes(t *testing.T) {
+	s := newMapReduceService(t)
+	big, _ := mapReduceInput()
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: big}}
+
+	// 每块的要点都很长，合并后超过 MAX_INPUT_LENGTH，需要再提取一轮
+	task := mapTask(request, 0)
+	chunks := splitChunks(big, 1200)
+	var notes []string
+	for i, chunk := range chunks {
+		note := strings.Repeat("n", 900)
+		notes = append(notes, note)
+		recordCassette(s, mapRequest(request, "model-a", task, chunk, i, len(chunks)), delta(note))
+	}
+	condense := splitChunks(strings.Join(notes, "\n\n"), 1200)
+	var condensed []string
+	for i, chunk := range condense {
+		condensed = append(condensed, fmt.Sprintf("short %d", i))
+		recordCassette(s, mapRequest(request, "model-a", task, chunk, i, len(condense)), delta(condensed[i]))
+	}
+	recordCassette(s, reduceRequest(request, map[int][]string{0: condensed}, 4000), delta("answer"))
+
+	completion, err := s.Complete(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got := collectText(completion.Stream); got != "answer" {
+		t.Errorf("output = %q, want %q", got, "answer")
+	}
+}
+
+func TestReduceRequestFitsLimit(t *testing.T) {
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: strings.Repeat("x", 5000)}}
+	reduced := reduceRequest(request, map[int][]string{0: {strings.Repeat("n", 3000)}}, 2500)
+	content := reduced.Messages[0].GetStringContent()
+	if len(content) > 2500 || !strings.HasSuffix(content, notesTruncatedMarker) {
+		t.Errorf("reduced message is %d bytes, want at most 2500 ending with the truncation marker", len(content))
+	}
+}
+
+func TestMapPromptOverhead(t *testing.T) {
+	task := excerpt(strings.Repeat("界", 2000))
+	prompt := fmt.Sprintf(mapPrompt, 999, 999, task, 999, 999, "")
+	if len(prompt) > config.MapReducePromptOverhead {
+		t.Errorf("map prompt overhead = %d bytes, config.MapReducePromptOverhead = %d", len(prompt), config.MapReducePromptOverhead)
+	}
+}
+
+func TestCompleteMapReduceTooManyChunks(t *testing.T) {
+	s := newReplayService(t, &config.Config{}, nil)
+	s.configs = config.NewManager(&config.Config{
+		CassetteMode:         config.CassetteModeReplay,
+		MaxInputLength:       10,
+		MapReduceEnabled:     true,
+		MapReduceChunkTokens: 1,
+		MapReduceMaxChunks:   2,
+		MapReduceConcurrency: 1,
+	}, "")
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: strings.Repeat("x", 40)}}
+
+	if _, err := s.Complete(context.Background(), request); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Complete() error = %v, want input too large", err)
+	}
+}
+
+func TestCompleteMapReduceChunkFailureEndsStream(t *testing.T) {
+	s := newMapReduceService(t)
+	big, _ := mapReduceInput()
+	request := fallbackTestRequest("model-a")
+	request.Messages = []models.Message{{Role: "user", Content: big}}
+
+	// 没有录制任何提取请求，提取失败在流中以错误项返回
+	completion, err := s.Complete(context.Background(), request)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	var streamErr error
+	for item := range completion.Stream {
+		if v, ok := item.(error); ok {
+			streamErr = v
+		}
+	}
+	if streamErr == nil {
+		t.Error("stream should end with the extraction error")
+	}
+}
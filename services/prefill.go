@@ -0,0 +1,87 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/models"
+	"strings"
+)
+
+// completePrefilled 生成输出并处理预填充：最后一条为 assistant 消息时，上游只续写其后的部分。
+// 模型仍重复了前缀时去掉重复；includePrefix 为 true 时在输出开头补上前缀
+func (s *CursorService) completePrefilled(ctx context.Context, request *models.ChatCompletionRequest, model string, includePrefix bool) (*Completion, error) {
+	prefix, ok := models.Prefill(request.Messages)
+	completion, err := s.completeContinued(ctx, request, model)
+	if err != nil || !ok {
+		return completion, err
+	}
+
+	out := make(chan interface{}, 32)
+	go func() {
+		defer close(out)
+		send := func(item interface{}) bool {
+			select {
+			case out <- item:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if includePrefix && !send(prefix) {
+			go drain(completion.Stream)
+			return
+		}
+
+		// 开头的文本先缓冲，直到能判断是否重复了前缀
+		var head strings.Builder
+		matching := true
+		flush := func() bool {
+			matching = false
+			text := strings.TrimPrefix(head.String(), prefix)
+			return text == "" || send(text)
+		}
+		for item := range completion.Stream {
+			ok := true
+			if chunk, isText := item.(string); isText && matching {
+				head.WriteString(chunk)
+				if buffered := head.String(); len(buffered) < len(prefix) && strings.HasPrefix(prefix, buffered) {
+					continue
+				}
+				ok = flush()
+			} else {
+				if matching && head.Len() > 0 {
+					ok = flush()
+				}
+				ok = ok && send(item)
+			}
+			if !ok {
+				go drain(completion.Stream)
+				return
+			}
+		}
+		if matching && head.Len() > 0 {
+			flush()
+		}
+	}()
+
+	return &Completion{Model: completion.Model, Fallback: completion.Fallback, Stream: out}, nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"testing"
+)
+
+func prefillTestRequest(include bool) *models.ChatCompletionRequest {
+	request := fallbackTestRequest("model-a")
+	request.Messages = append(request.Messages, models.Message{Role: "assistant", Content: "Answer:"})
+	request.IncludePrefill = include
+	return request
+}
+
+func TestCompletePrefilled(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		include bool
+		want    string
+	}{
+		{"continuation only", delta(" 42"), false, " 42"},
+		{"with prefix", delta(" 42"), true, "Answer: 42"},
+		{"echoed prefix is dropped", delta("Ans") + delta("wer: 42"), false, " 42"},
+		{"echoed prefix with include", delta("Answer: 42"), true, "Answer: 42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newReplayService(t, &config.Config{}, nil)
+			recordCassette(s, prefillTestRequest(tt.include), tt.raw)
+
+			completion, err := s.Complete(context.Background(), prefillTestRequest(tt.include))
+			if err != nil {
+				t.Fatalf("Complete() error = %v", err)
+			}
+			if got := collectText(completion.Stream); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
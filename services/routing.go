@@ -0,0 +1,144 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// shadowLogMaxChars 影子对比日志中每份输出保留的最大字符数
+const shadowLogMaxChars = 2000
+
+// routeModel 把虚拟模型按权重映射到真实模型，非虚拟模型原样返回
+// 同一用户（请求的 user 字段，未提供时为 API 密钥）总是分到同一个模型
+func (s *CursorService) routeModel(ctx context.Context, request *models.ChatCompletionRequest) string {
+	split := s.cfg().GetModelSplit(request.Model)
+	if len(split) == 0 {
+		return request.Model
+	}
+
+	stickyKey := request.User
+	if stickyKey == "" {
+		stickyKey = middleware.APIKeyFromContext(ctx)
+	}
+	model := pickWeighted(split, request.Model+"\x00"+stickyKey)
+	logrus.WithFields(logrus.Fields{
+		"virtual_model": request.Model,
+		"model":         model,
+	}).Debug("Routed virtual model")
+	return model
+}
+
+// pickWeighted 按 stickyKey 的哈希在权重区间中选取模型
+func pickWeighted(split []config.ModelWeight, stickyKey string) string {
+	total := 0
+	for _, item := range split {
+		total += item.Weight
+	}
+	h := fnv.New32a()
+	h.Write([]byte(stickyKey))
+	point := int(h.Sum32() % uint32(total))
+	for _, item := range split {
+		if point < item.Weight {
+			return item.Model
+		}
+		point -= item.Weight
+	}
+	return split[len(split)-1].Model
+}
+
+// startShadow 若模型配置了影子模型，在后台把请求副本发往影子模型，
+// 并在两边都结束后记录输出用于对比。影子请求以低优先级排队，不影响客户端响应
+func (s *CursorService) startShadow(ctx context.Context, request *models.ChatCompletionRequest, primary *Completion) *Completion {
+	cfg := s.cfg()
+	shadowModel := cfg.GetShadowModel(primary.Model)
+	if shadowModel == "" || shadowModel == primary.Model || rand.Float64() >= cfg.ShadowSampleRate {
+		return primary
+	}
+
+	var primaryOutput strings.Builder
+	primaryDone := make(chan struct{})
+	stream := teeStream(ctx, primary.Stream, func(item interface{}) {
+		if text, ok := item.(string); ok {
+			primaryOutput.WriteString(text)
+		}
+	}, func() { close(primaryDone) })
+
+	shadowRequest := *request
+	shadowRequest.Model = shadowModel
+	shadowRequest.Stream = false
+	// 影子请求独立生成：不读写响应缓存、不与其他请求合并，保证对比的是一次真实的上游输出，
+	// 也不会把影子模型的输出留在缓存里；直接调用 ChatCompletion，不经过 Complete，因此不写审计记录
+	shadowCtx := withIndependentGeneration(WithPriority(context.WithoutCancel(ctx), config.PriorityLow))
+	go func() {
+		start := time.Now()
+		var shadowOutput strings.Builder
+		var shadowErr error
+		output, err := s.ChatCompletion(shadowCtx, &shadowRequest)
+		if err != nil {
+			shadowErr = err
+		} else {
+			for item := range output {
+				switch v := item.(type) {
+				case string:
+					shadowOutput.WriteString(v)
+				case error:
+					shadowErr = v
+				}
+			}
+		}
+		latency := time.Since(start)
+
+		<-primaryDone
+		fields := logrus.Fields{
+			"primary_model":     primary.Model,
+			"shadow_model":      shadowModel,
+			"primary_output":    truncateRunes(primaryOutput.String(), shadowLogMaxChars),
+			"shadow_output":     truncateRunes(shadowOutput.String(), shadowLogMaxChars),
+			"primary_chars":     len([]rune(primaryOutput.String())),
+			"shadow_chars":      len([]rune(shadowOutput.String())),
+			"shadow_latency_ms": latency.Milliseconds(),
+		}
+		if shadowErr != nil {
+			fields["shadow_error"] = shadowErr.Error()
+		}
+		logrus.WithFields(fields).Info("Shadow comparison")
+	}()
+
+	return &Completion{Model: primary.Model, Fallback: primary.Fallback, Stream: stream}
+}
+
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "..."
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestPickWeightedSticky(t *testing.T) {
+	split := []config.ModelWeight{{Model: "model-a", Weight: 90}, {Model: "model-b", Weight: 10}}
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		model := pickWeighted(split, key)
+		if again := pickWeighted(split, key); again != model {
+			t.Fatalf("pickWeighted(%s) not sticky: %s then %s", key, model, again)
+		}
+		counts[model]++
+	}
+	if counts["model-b"] < 50 || counts["model-b"] > 150 {
+		t.Errorf("model-b got %d of 1000 requests, want about 100", counts["model-b"])
+	}
+}
+
+func TestCompleteRoutesVirtualModel(t *testing.T) {
+	s := newReplayService(t, &config.Config{Models: "model-a", ModelSplits: "canary=model-b:1"}, map[string]string{
+		"model-b": "data: {\"type\":\"text-delta\",\"delta\":\"from b\"}\n\n",
+	})
+	if !s.cfg().IsValidModel("canary") {
+		t.Error("virtual model should be a valid model")
+	}
+
+	completion, err := s.Complete(context.Background(), fallbackTestRequest("canary"))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if completion.Model != "model-b" || completion.Fallback {
+		t.Errorf("completion = %+v, want model-b without fallback", completion)
+	}
+	if got := collectText(completion.Stream); got != "from b" {
+		t.Errorf("content = %q, want %q", got, "from b")
+	}
+}
+
+func TestCompleteShadowsRequest(t *testing.T) {
+	s := newReplayService(t, &config.Config{ModelShadows: "model-a=model-b", ShadowSampleRate: 1}, map[string]string{
+		"model-a": "data: {\"type\":\"text-delta\",\"delta\":\"primary\"}\n\n",
+		"model-b": "data: {\"type\":\"text-delta\",\"delta\":\"shadow\"}\n\n",
+	})
+	s.cache = newTestCache(t, &config.Config{CacheTTL: 60, CacheMaxEntries: 10})
+	hook := logrustest.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	completion, err := s.Complete(context.Background(), fallbackTestRequest("model-a"))
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got := collectText(completion.Stream); got != "primary" {
+		t.Errorf("client content = %q, want %q", got, "primary")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "Shadow comparison" {
+				if entry.Data["shadow_output"] != "shadow" || entry.Data["primary_output"] != "primary" {
+					t.Errorf("shadow log = %v", entry.Data)
+				}
+				// 只缓存客户端请求，影子请求独立生成
+				if got := s.cache.Len(); got != 1 {
+					t.Errorf("cache entries = %d, want 1", got)
+				}
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("shadow comparison was not logged")
+}
@@ -0,0 +1,416 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// activeRun 正在执行的运行：保留全部事件，晚到的订阅方先回放已发生的事件
+type activeRun struct {
+	cancel    context.CancelFunc
+	cancelled bool // 是否由调用方取消
+	events    *broadcaster[models.RunEvent]
+}
+
+func newActiveRun(cancel context.CancelFunc) *activeRun {
+	return &activeRun{cancel: cancel, events: newBroadcaster[models.RunEvent]()}
+}
+
+// publish 记录事件并唤醒订阅方
+func (ar *activeRun) publish(event string, data interface{}) {
+	ar.events.publish(models.RunEvent{Event: event, Data: data})
+}
+
+// finish 运行结束，订阅方收完剩余事件后通道关闭
+func (ar *activeRun) finish() {
+	ar.events.finish()
+}
+
+// subscribe 从第一个事件开始订阅，ctx 结束时停止（不影响运行本身）
+func (ar *activeRun) subscribe(ctx context.Context) <-chan models.RunEvent {
+	out := make(chan models.RunEvent, 16)
+	go ar.events.subscribe(ctx, out)
+	return out
+}
+
+// CreateRun 在线程上创建运行并异步执行。stream 为 true 时返回运行事件的通道，
+// 通道在运行结束或 ctx 结束时关闭；运行本身不随请求结束而取消
+func (as *AssistantStore) CreateRun(ctx context.Context, apiKey, threadID string, request *models.RunRequest) (*models.Run, <-chan models.RunEvent, error) {
+	if request.AssistantID == "" {
+		return nil, nil, middleware.NewInvalidRequestError("assistant_id is required", "missing_assistant_id")
+	}
+	for _, message := range request.AdditionalMessages {
+		if err := validateThreadMessage(&message); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var run models.Run
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		if _, err := lookupThread(tx, apiKey, threadID); err != nil {
+			return err
+		}
+		if activeRunID(tx, threadID) != "" {
+			return ErrRunActive
+		}
+		stored, err := lookupAssistant(tx, apiKey, request.AssistantID)
+		if err != nil {
+			return err
+		}
+		for _, message := range request.AdditionalMessages {
+			if _, err := addThreadMessage(tx, threadID, newThreadMessage(threadID, &message)); err != nil {
+				return err
+			}
+		}
+
+		run = models.Run{
+			ID:           "run_" + utils.GenerateRandomString(24),
+			Object:       "thread.run",
+			CreatedAt:    time.Now().Unix(),
+			ThreadID:     threadID,
+			AssistantID:  stored.Assistant.ID,
+			Status:       models.RunStatusQueued,
+			Model:        stored.Assistant.Model,
+			Instructions: stored.Assistant.Instructions,
+			Metadata:     request.Metadata,
+		}
+		if request.Model != "" {
+			run.Model = request.Model
+		}
+		// 运行覆盖的模型，或 MODELS 变更后助手已不可用的模型
+		if err := as.checkModel(run.Model); err != nil {
+			return err
+		}
+		if request.Instructions != nil {
+			run.Instructions = *request.Instructions
+		}
+		if request.AdditionalInstructions != "" {
+			run.Instructions = strings.TrimSpace(run.Instructions + "\n\n" + request.AdditionalInstructions)
+		}
+
+		bucket, err := tx.Bucket(runsBucket).CreateBucketIfNotExists([]byte(threadID))
+		if err != nil {
+			return err
+		}
+		key, err := nextKey(bucket)
+		if err != nil {
+			return err
+		}
+		return putJSON(bucket, key, run)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 运行保留请求中的调用方信息（API 密钥、优先级），但不随请求取消
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	ar := newActiveRun(cancel)
+	ar.publish("thread.run.created", run)
+	ar.publish("thread.run.queued", run)
+	as.mu.Lock()
+	as.active[run.ID] = ar
+	as.mu.Unlock()
+
+	as.wg.Add(1)
+	go as.execute(runCtx, ar, run)
+
+	var events <-chan models.RunEvent
+	if request.Stream {
+		events = ar.subscribe(ctx)
+	}
+	return &run, events, nil
+}
+
+// GetRun 获取运行
+func (as *AssistantStore) GetRun(apiKey, threadID, id string) (*models.Run, error) {
+	runs, err := as.threadRuns(apiKey, threadID)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if run.ID == id {
+			return run, nil
+		}
+	}
+	return nil, ErrRunNotFound
+}
+
+// ListRuns 分页列出线程上的运行，默认按创建顺序倒序
+func (as *AssistantStore) ListRuns(apiKey, threadID string, opts ListOptions) ([]*models.Run, bool, error) {
+	runs, err := as.threadRuns(apiKey, threadID)
+	if err != nil {
+		return nil, false, err
+	}
+	page, more := paginate(runs, opts, func(r *models.Run) string { return r.ID })
+	return page, more, nil
+}
+
+// CancelRun 取消未结束的运行，运行随后进入 cancelled 状态
+func (as *AssistantStore) CancelRun(apiKey, threadID, id string) (*models.Run, error) {
+	run, err := as.GetRun(apiKey, threadID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	as.mu.Lock()
+	ar, ok := as.active[id]
+	if ok {
+		ar.cancelled = true
+	}
+	as.mu.Unlock()
+	if !ok || runFinished(run.Status) {
+		return nil, ErrRunNotCancellable
+	}
+
+	run, err = as.updateRun(threadID, id, func(run *models.Run) {
+		if !runFinished(run.Status) {
+			run.Status = models.RunStatusCancelling
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	ar.cancel()
+	return run, nil
+}
+
+// execute 执行运行：以助手指令和线程消息调用 Cursor 服务，回复保存为线程中的 assistant 消息
+func (as *AssistantStore) execute(ctx context.Context, ar *activeRun, run models.Run) {
+	defer as.wg.Done()
+	defer func() {
+		as.mu.Lock()
+		delete(as.active, run.ID)
+		as.mu.Unlock()
+		ar.cancel()
+		ar.finish()
+	}()
+
+	now := time.Now().Unix()
+	if updated, err := as.updateRun(run.ThreadID, run.ID, func(r *models.Run) {
+		r.Status = models.RunStatusInProgress
+		r.StartedAt = &now
+	}); err == nil {
+		ar.publish("thread.run.in_progress", *updated)
+	}
+
+	var (
+		reply   strings.Builder
+		message *models.ThreadMessage
+		usage   *models.Usage
+		runErr  error
+	)
+	completion, err := as.completeRun(ctx, &run)
+	if err != nil {
+		runErr = err
+	} else {
+		for item := range completion.Stream {
+			switch v := item.(type) {
+			case string:
+				if message == nil {
+					message = &models.ThreadMessage{
+						ID:          "msg_" + utils.GenerateRandomString(24),
+						Object:      "thread.message",
+						CreatedAt:   time.Now().Unix(),
+						ThreadID:    run.ThreadID,
+						Status:      "in_progress",
+						Role:        "assistant",
+						Content:     []models.ThreadMessageContent{},
+						AssistantID: run.AssistantID,
+						RunID:       run.ID,
+					}
+					ar.publish("thread.message.created", *message)
+				}
+				reply.WriteString(v)
+				ar.publish("thread.message.delta", messageDelta(message.ID, v))
+			case models.Usage:
+				usage = &v
+			case error:
+				runErr = v
+			}
+		}
+	}
+
+	// 取消或失败时已生成的部分回复以 incomplete 状态保存
+	if message != nil {
+		message.Content = models.TextContent(reply.String())
+		message.Status = "completed"
+		if runErr != nil || ctx.Err() != nil {
+			message.Status = "incomplete"
+		}
+		if err := as.db.Update(func(tx *bolt.Tx) error {
+			_, err := addThreadMessage(tx, run.ThreadID, message)
+			return err
+		}); err != nil {
+			logrus.WithError(err).WithField("run", run.ID).Error("Failed to save run message")
+			if runErr == nil {
+				runErr = err
+			}
+		}
+		ar.publish("thread.message.completed", *message)
+	}
+
+	as.mu.Lock()
+	cancelled := ar.cancelled
+	as.mu.Unlock()
+
+	finished, err := as.updateRun(run.ThreadID, run.ID, func(r *models.Run) {
+		now := time.Now().Unix()
+		r.Usage = usage
+		switch {
+		case cancelled:
+			r.Status = models.RunStatusCancelled
+			r.CancelledAt = &now
+		case runErr != nil || ctx.Err() != nil:
+			if runErr == nil {
+				runErr = errors.New("run was interrupted by server shutdown")
+			}
+			r.Status = models.RunStatusFailed
+			r.FailedAt = &now
+			r.LastError = &models.RunError{Code: runErrorCode(runErr), Message: runErr.Error()}
+		default:
+			r.Status = models.RunStatusCompleted
+			r.CompletedAt = &now
+		}
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("run", run.ID).Error("Failed to update run status")
+		return
+	}
+	ar.publish("thread.run."+finished.Status, *finished)
+}
+
+// completeRun 把运行转换为聊天完成请求：指令作为系统消息，线程消息按顺序作为历史
+func (as *AssistantStore) completeRun(ctx context.Context, run *models.Run) (*Completion, error) {
+	request := &models.ChatCompletionRequest{Model: run.Model, Stream: true}
+	if run.Instructions != "" {
+		request.Messages = append(request.Messages, models.Message{Role: "system", Content: run.Instructions})
+	}
+	err := as.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(messagesBucket).Bucket([]byte(run.ThreadID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, data []byte) error {
+			var message models.ThreadMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				return err
+			}
+			request.Messages = append(request.Messages, models.Message{Role: message.Role, Content: message.ContentText()})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(request.Messages) == 0 || request.Messages[len(request.Messages)-1].Role == "system" {
+		return nil, middleware.NewInvalidRequestError("thread has no messages to run", "empty_thread")
+	}
+	request.MaxTokens = models.ValidateMaxTokens(request.Model, request.MaxTokens)
+	return as.service.Complete(ctx, request)
+}
+
+// threadRuns 按创建顺序返回线程上的全部运行
+func (as *AssistantStore) threadRuns(apiKey, threadID string) ([]*models.Run, error) {
+	var runs []*models.Run
+	err := as.db.View(func(tx *bolt.Tx) error {
+		if _, err := lookupThread(tx, apiKey, threadID); err != nil {
+			return err
+		}
+		bucket := tx.Bucket(runsBucket).Bucket([]byte(threadID))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, data []byte) error {
+			var run models.Run
+			if err := json.Unmarshal(data, &run); err != nil {
+				return err
+			}
+			runs = append(runs, &run)
+			return nil
+		})
+	})
+	return runs, err
+}
+
+// updateRun 修改运行并保存，返回修改后的运行
+func (as *AssistantStore) updateRun(threadID, id string, mutate func(*models.Run)) (*models.Run, error) {
+	var updated *models.Run
+	err := as.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket).Bucket([]byte(threadID))
+		if bucket == nil {
+			return ErrRunNotFound
+		}
+		// 最近的运行在末尾
+		c := bucket.Cursor()
+		for key, data := c.Last(); key != nil; key, data = c.Prev() {
+			var run models.Run
+			if err := json.Unmarshal(data, &run); err != nil || run.ID != id {
+				continue
+			}
+			mutate(&run)
+			updated = &run
+			return putJSON(bucket, key, run)
+		}
+		return ErrRunNotFound
+	})
+	return updated, err
+}
+
+// activeRunID 返回线程上未结束的运行；同一线程同时只有一个运行，只需检查最近一个
+func activeRunID(tx *bolt.Tx, threadID string) string {
+	bucket := tx.Bucket(runsBucket).Bucket([]byte(threadID))
+	if bucket == nil {
+		return ""
+	}
+	_, data := bucket.Cursor().Last()
+	var run models.Run
+	if data == nil || json.Unmarshal(data, &run) != nil || runFinished(run.Status) {
+		return ""
+	}
+	return run.ID
+}
+
+// messageDelta 构造 thread.message.delta 事件的数据
+func messageDelta(id, text string) models.MessageDelta {
+	delta := models.MessageDelta{ID: id, Object: "thread.message.delta"}
+	delta.Delta.Content = []models.MessageDeltaContent{{Type: "text", Text: models.MessageText{Value: text, Annotations: []interface{}{}}}}
+	return delta
+}
+
+// runErrorCode 把错误映射为 last_error.code
+func runErrorCode(err error) string {
+	var invalid *middleware.InvalidRequestError
+	if errors.As(err, &invalid) {
+		return "invalid_prompt"
+	}
+	return "server_error"
+}
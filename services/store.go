@@ -0,0 +1,109 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"crypto/sha256"
+	"cursor2api-go/config"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ownerHash 计算调用方标识，不在磁盘上保存明文密钥
+func ownerHash(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// ownerKey 在配置的 API 密钥中查找哈希为 owner 的密钥；磁盘上只保存哈希，
+// 后台任务恢复时用它重建调用方上下文。密钥已从配置中移除时返回 false
+func ownerKey(cfg *config.Config, owner string) (string, bool) {
+	for _, key := range cfg.GetAPIKeys() {
+		if ownerHash(key) == owner {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// jsonDir 每个对象一个 JSON 文件的目录，写入时先写临时文件再重命名
+type jsonDir string
+
+// openJSONDir 创建目录，kind 用于错误信息
+func openJSONDir(dir, kind string) (jsonDir, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s dir: %w", kind, err)
+	}
+	return jsonDir(dir), nil
+}
+
+// loadJSONDir 读取目录中全部对象，无法读取或 id 为空的文件记录警告后跳过
+func loadJSONDir[T any](d jsonDir, kind string, id func(*T) string) (map[string]*T, error) {
+	files, err := filepath.Glob(filepath.Join(string(d), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]*T, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).Warnf("Failed to read %s", kind)
+			continue
+		}
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil || id(&item) == "" {
+			logrus.WithField("file", file).Warnf("Skipping invalid %s file", kind)
+			continue
+		}
+		items[id(&item)] = &item
+	}
+	return items, nil
+}
+
+// save 原子写入对象
+func (d jsonDir) save(id string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	tmp := d.path(id) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(d.path(id)), err)
+	}
+	return os.Rename(tmp, d.path(id))
+}
+
+// remove 删除对象，文件不存在时不报错
+func (d jsonDir) remove(id string) error {
+	if err := os.Remove(d.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (d jsonDir) path(id string) string {
+	return filepath.Join(string(d), filepath.Base(id)+".json")
+}
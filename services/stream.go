@@ -0,0 +1,56 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+)
+
+// teeStream 将 in 中的数据原样转发到返回的通道，同时把每条数据交给 observe，
+// 流结束（或客户端断开后上游排空）时调用 done。
+// 客户端断开后继续排空 in，避免上游 SSE 协程阻塞在发送上。
+func teeStream(ctx context.Context, in <-chan interface{}, observe func(item interface{}), done func()) <-chan interface{} {
+	out := make(chan interface{}, cap(in))
+
+	go func() {
+		defer close(out)
+		if done != nil {
+			defer done()
+		}
+
+		detached := false
+		for item := range in {
+			if observe != nil {
+				observe(item)
+			}
+			if detached {
+				continue
+			}
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				detached = true
+			}
+		}
+	}()
+
+	return out
+}
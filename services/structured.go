@@ -0,0 +1,135 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/middleware"
+	"cursor2api-go/models"
+	"cursor2api-go/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// completeSingle 生成单个候选：要求 JSON 输出时走结构化输出流程，否则直接按回退链生成（处理预填充，必要时自动续写）
+func (s *CursorService) completeSingle(ctx context.Context, request *models.ChatCompletionRequest, model string) (*Completion, error) {
+	if request.ResponseFormat.RequiresJSON() {
+		return s.completeStructured(ctx, request, model)
+	}
+	return s.completePrefilled(ctx, request, model, request.IncludePrefill)
+}
+
+// completeStructured 生成 JSON 输出：收集完整输出后解析并校验，不通过时先尝试本地修复，
+// 仍不通过则把输出和校验错误发回上游重新生成，最多 STRUCTURED_OUTPUT_MAX_ATTEMPTS 次。
+// 校验需要完整输出，因此流式请求会在校验通过后才开始输出
+func (s *CursorService) completeStructured(ctx context.Context, request *models.ChatCompletionRequest, model string) (*Completion, error) {
+	attempts := max(s.cfg().StructuredOutputMaxAttempts, 1)
+	attemptRequest := *request
+
+	var usage models.Usage
+	var problems []string
+	for attempt := 1; attempt <= attempts; attempt++ {
+		// 预填充的前缀是 JSON 的一部分，校验时需要完整输出
+		completion, err := s.completePrefilled(ctx, &attemptRequest, model, true)
+		if err != nil {
+			return nil, err
+		}
+		text, attemptUsage, err := collectCompletion(completion.Stream)
+		if err != nil {
+			return nil, err
+		}
+		usage.Add(attemptUsage)
+
+		var output string
+		output, problems = checkStructuredOutput(text, request.ResponseFormat)
+		if len(problems) == 0 {
+			if prefix, ok := models.Prefill(request.Messages); ok && !request.IncludePrefill {
+				output = strings.TrimPrefix(output, prefix)
+			}
+			stream := make(chan interface{}, 2)
+			stream <- output
+			stream <- usage
+			close(stream)
+			return &Completion{Model: completion.Model, Fallback: completion.Fallback, Stream: stream}, nil
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"attempt":  attempt,
+			"problems": problems,
+		}).Warn("Structured output failed validation")
+
+		// 带上校验错误重新请求；输出已包含预填充的前缀，去掉原来的预填充消息
+		history := attemptRequest.Messages
+		if _, ok := models.Prefill(history); ok {
+			history = history[:len(history)-1]
+		}
+		attemptRequest.Messages = append(append([]models.Message{}, history...),
+			models.Message{Role: "assistant", Content: text},
+			models.Message{Role: "user", Content: "Your previous reply did not satisfy the required JSON format:\n- " +
+				strings.Join(problems, "\n- ") + "\nReply again with the corrected JSON only."},
+		)
+	}
+
+	return nil, middleware.NewCursorWebError(http.StatusBadGateway, fmt.Sprintf(
+		"model output did not match response_format after %d attempts: %s", attempts, strings.Join(problems, "; ")))
+}
+
+// checkStructuredOutput 解析并校验输出，必要时先修复；返回（修复后的）输出和问题列表
+func checkStructuredOutput(text string, format *models.ResponseFormat) (string, []string) {
+	output := strings.TrimSpace(text)
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		output = utils.RepairJSON(text)
+		if err := json.Unmarshal([]byte(output), &value); err != nil {
+			return output, []string{"invalid JSON: " + err.Error()}
+		}
+	}
+
+	if format.Type == models.ResponseFormatJSONObject {
+		if _, ok := value.(map[string]interface{}); !ok {
+			return output, []string{"the top-level value must be a JSON object"}
+		}
+		return output, nil
+	}
+	return output, utils.ValidateJSONSchema(value, format.JSONSchema.Schema)
+}
+
+// collectCompletion 收集完整的输出文本和用量
+func collectCompletion(stream <-chan interface{}) (string, models.Usage, error) {
+	var text strings.Builder
+	var usage models.Usage
+	for item := range stream {
+		switch v := item.(type) {
+		case string:
+			text.WriteString(v)
+		case models.Usage:
+			usage = v
+		case error:
+			go drain(stream)
+			return "", usage, v
+		}
+	}
+	return text.String(), usage, nil
+}
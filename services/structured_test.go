@@ -0,0 +1,90 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package services
+
+import (
+	"context"
+	"cursor2api-go/config"
+	"cursor2api-go/models"
+	"encoding/json"
+	"testing"
+)
+
+func structuredTestRequest() *models.ChatCompletionRequest {
+	request := fallbackTestRequest("model-a")
+	request.ResponseFormat = &models.ResponseFormat{
+		Type: models.ResponseFormatJSONSchema,
+		JSONSchema: &models.JSONSchemaFormat{
+			Name: "person",
+			Schema: map[string]interface{}{
+				"type":     "object",
+				"required": []interface{}{"name"},
+			},
+		},
+	}
+	return request
+}
+
+func delta(text string) string {
+	data, _ := json.Marshal(map[string]string{"type": "text-delta", "delta": text})
+	return "data: " + string(data) + "\n\n"
+}
+
+func TestCompleteStructuredRepairsOutput(t *testing.T) {
+	s := newReplayService(t, &config.Config{StructuredOutputMaxAttempts: 1}, nil)
+	recordCassette(s, structuredTestRequest(), delta("```json\n{\"name\": \"Ann\",}\n```"))
+
+	completion, err := s.Complete(context.Background(), structuredTestRequest())
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got := collectText(completion.Stream); got != `{"name": "Ann"}` {
+		t.Errorf("output = %q, want repaired JSON", got)
+	}
+}
+
+func TestCompleteStructuredReasksWithErrors(t *testing.T) {
+	s := newReplayService(t, &config.Config{StructuredOutputMaxAttempts: 2}, nil)
+	first := structuredTestRequest()
+	recordCassette(s, first, delta(`{"age": 3}`))
+
+	// 第二次请求带上第一次的输出和校验错误
+	second := structuredTestRequest()
+	second.Messages = append(second.Messages,
+		models.Message{Role: "assistant", Content: `{"age": 3}`},
+		models.Message{Role: "user", Content: "Your previous reply did not satisfy the required JSON format:\n- $: missing required property \"name\"\nReply again with the corrected JSON only."},
+	)
+	recordCassette(s, second, delta(`{"name": "Ann"}`))
+
+	completion, err := s.Complete(context.Background(), structuredTestRequest())
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got := collectText(completion.Stream); got != `{"name": "Ann"}` {
+		t.Errorf("output = %q, want second attempt", got)
+	}
+
+	// 次数用尽时返回错误
+	s.configs = config.NewManager(&config.Config{CassetteMode: config.CassetteModeReplay, MaxInputLength: 100000, StructuredOutputMaxAttempts: 1}, "")
+	if _, err := s.Complete(context.Background(), structuredTestRequest()); err == nil {
+		t.Error("Complete() expected error when attempts are exhausted")
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// JS 执行错误类型，可通过 errors.Is 区分
+var (
+	// ErrJSTimeout 脚本执行超过墙钟时间限制
+	ErrJSTimeout = errors.New("node.js execution timed out")
+	// ErrJSCrash node 进程启动失败或非零退出（包括内存超限被终止）
+	ErrJSCrash = errors.New("node.js execution crashed")
+	// ErrJSBadOutput 脚本输出为空或超过大小限制
+	ErrJSBadOutput = errors.New("node.js produced bad output")
+)
+
+const (
+	defaultJSTimeout        = 10 * time.Second
+	defaultJSMaxOldSpaceMB  = 256
+	defaultJSMaxOutputBytes = 64 * 1024
+	maxJSStderrBytes        = 8 * 1024
+)
+
+// JSError JS 执行错误详情
+type JSError struct {
+	Kind     error
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+// Error 实现error接口
+func (e *JSError) Error() string {
+	msg := e.Kind.Error()
+	if e.ExitCode != 0 {
+		msg += fmt.Sprintf(" (exit code: %d)", e.ExitCode)
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Stderr != "" {
+		msg += "\nSTDERR:\n" + e.Stderr
+	}
+	return msg
+}
+
+// Unwrap 返回错误类型和底层错误，支持 errors.Is(err, ErrJSTimeout) 以及对 *exec.ExitError、
+// context.DeadlineExceeded 的 errors.As / errors.Is 判断
+func (e *JSError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// JSOptions JS 执行限制，零值表示使用默认值
+type JSOptions struct {
+	Timeout        time.Duration
+	MaxOldSpaceMB  int
+	MaxOutputBytes int
+}
+
+func (o JSOptions) withDefaults() JSOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = defaultJSTimeout
+	}
+	if o.MaxOldSpaceMB <= 0 {
+		o.MaxOldSpaceMB = defaultJSMaxOldSpaceMB
+	}
+	if o.MaxOutputBytes <= 0 {
+		o.MaxOutputBytes = defaultJSMaxOutputBytes
+	}
+	return o
+}
+
+// JSRunner 限制并发的 JS 执行器
+type JSRunner struct {
+	sem chan struct{}
+}
+
+// NewJSRunner 创建最多同时运行 maxConcurrency 个 node 进程的执行器
+func NewJSRunner(maxConcurrency int) *JSRunner {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 1
+	}
+	return &JSRunner{sem: make(chan struct{}, maxConcurrency)}
+}
+
+// Run 等待空闲槽位后执行脚本；等待期间 ctx 结束则直接返回 ctx 的错误
+func (r *JSRunner) Run(ctx context.Context, jsCode string, opts JSOptions) (string, error) {
+	select {
+	case r.sem <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-r.sem }()
+
+	return RunJS(ctx, jsCode, opts)
+}
+
+// InFlight 返回正在运行的 node 进程数
+func (r *JSRunner) InFlight() int {
+	return len(r.sem)
+}
+
+// RunJS 执行JavaScript代码并返回标准输出内容
+func RunJS(ctx context.Context, jsCode string, opts JSOptions) (string, error) {
+	opts = opts.withDefaults()
+
+	// 添加crypto模块导入并设置为全局变量
+	// 注意：使用stdin时，我们需要确保代码是自包含的
+	finalJS := `const crypto = require('crypto').webcrypto;
+global.crypto = crypto;
+globalThis.crypto = crypto;
+// 在Node.js环境中创建window对象
+if (typeof window === 'undefined') { global.window = global; }
+window.crypto = crypto;
+this.crypto = crypto;
+` + jsCode
+
+	runCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	// 执行Node.js命令，使用stdin输入代码
+	cmd := exec.CommandContext(runCtx, "node", fmt.Sprintf("--max-old-space-size=%d", opts.MaxOldSpaceMB))
+	cmd.Stdin = strings.NewReader(finalJS)
+	cmd.WaitDelay = time.Second
+
+	stdout := &limitedBuffer{limit: opts.MaxOutputBytes}
+	stderr := &limitedBuffer{limit: maxJSStderrBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+
+	// 调用方取消（如客户端断开）不算执行失败
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return "", &JSError{Kind: ErrJSTimeout, Err: fmt.Errorf("exceeded %s: %w", opts.Timeout, runCtx.Err()), Stderr: stderr.String()}
+	}
+	if err != nil {
+		jsErr := &JSError{Kind: ErrJSCrash, Err: err, Stderr: stderr.String()}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			jsErr.ExitCode = exitErr.ExitCode()
+		}
+		return "", jsErr
+	}
+
+	if stdout.overflow {
+		return "", &JSError{Kind: ErrJSBadOutput, Err: fmt.Errorf("output exceeds %d bytes", opts.MaxOutputBytes)}
+	}
+	output := strings.TrimSpace(stdout.String())
+	if output == "" {
+		return "", &JSError{Kind: ErrJSBadOutput, Err: errors.New("empty output"), Stderr: stderr.String()}
+	}
+
+	return output, nil
+}
+
+// limitedBuffer 只保留前 limit 字节的输出，超出部分丢弃并标记 overflow
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buf.Len()
+	if remaining <= 0 {
+		if len(p) > 0 {
+			b.overflow = true
+		}
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.overflow = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
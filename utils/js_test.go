@@ -0,0 +1,109 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunJS(t *testing.T) {
+	if _, err := exec.LookPath("node"); err != nil {
+		t.Skip("node not installed")
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		opts    JSOptions
+		want    string
+		wantErr error
+	}{
+		{
+			name: "success",
+			code: `console.log(typeof window.crypto.subtle === "object" ? "ok" : "missing")`,
+			want: "ok",
+		},
+		{
+			name:    "timeout",
+			code:    `while (true) {}`,
+			opts:    JSOptions{Timeout: 200 * time.Millisecond},
+			wantErr: ErrJSTimeout,
+		},
+		{
+			name:    "crash",
+			code:    `process.exit(3)`,
+			wantErr: ErrJSCrash,
+		},
+		{
+			name:    "empty output",
+			code:    `void 0`,
+			wantErr: ErrJSBadOutput,
+		},
+		{
+			name:    "output too large",
+			code:    `console.log("x".repeat(2048))`,
+			opts:    JSOptions{MaxOutputBytes: 1024},
+			wantErr: ErrJSBadOutput,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RunJS(context.Background(), tt.code, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RunJS() error = %v, want %v", err, tt.wantErr)
+				}
+				// 底层错误同样可以取出
+				var exitErr *exec.ExitError
+				if tt.wantErr == ErrJSCrash && !errors.As(err, &exitErr) {
+					t.Errorf("RunJS() error = %v, want it to wrap *exec.ExitError", err)
+				}
+				if tt.wantErr == ErrJSTimeout && !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("RunJS() error = %v, want it to wrap context.DeadlineExceeded", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunJS() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RunJS() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSRunnerWaitsForSlot(t *testing.T) {
+	runner := NewJSRunner(1)
+	runner.sem <- struct{}{} // 占满唯一的槽位
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := runner.Run(ctx, `console.log(1)`, JSOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v, want context deadline exceeded", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// codeFencePattern 匹配包裹输出的 Markdown 代码块
+	codeFencePattern = regexp.MustCompile("(?s)^\\s*```[a-zA-Z0-9_-]*\\s*\\n(.*?)\\n?\\s*```\\s*$")
+)
+
+// RepairJSON 尝试修复模型输出中常见的 JSON 格式问题：去掉代码块包裹、
+// 截取首尾之间的 JSON 主体、删除结尾多余的逗号。无法修复时原样返回（去除首尾空白）
+func RepairJSON(text string) string {
+	text = strings.TrimSpace(text)
+	if match := codeFencePattern.FindStringSubmatch(text); match != nil {
+		text = strings.TrimSpace(match[1])
+	}
+
+	if start := strings.IndexAny(text, "{["); start >= 0 {
+		closing := "}"
+		if text[start] == '[' {
+			closing = "]"
+		}
+		if end := strings.LastIndex(text, closing); end > start {
+			text = text[start : end+1]
+		}
+	}
+
+	return removeTrailingCommas(text)
+}
+
+// removeTrailingCommas 删除对象或数组结尾多余的逗号，字符串字面量中的内容保持不变
+func removeTrailingCommas(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			b.WriteByte(c)
+			continue
+		}
+		if c == ',' {
+			next := strings.TrimLeft(text[i+1:], " \t\r\n")
+			if next != "" && (next[0] == '}' || next[0] == ']') {
+				continue
+			}
+		}
+		if c == '"' {
+			inString = true
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// ValidateJSONSchema 按 JSON Schema 的常用子集校验 value（由 json.Unmarshal 解析得到），返回所有错误
+// 支持 type、enum、const、properties、required、additionalProperties、items、
+// minItems/maxItems、minLength/maxLength、minimum/maximum 和 anyOf/oneOf/allOf；
+// 其他关键字由 models.ResponseFormat.Validate 在请求阶段拒绝
+func ValidateJSONSchema(value interface{}, schema map[string]interface{}) []string {
+	var errs []string
+	validateSchema("$", value, schema, &errs)
+	return errs
+}
+
+func validateSchema(path string, value interface{}, schema map[string]interface{}, errs *[]string) {
+	addErr := func(format string, args ...interface{}) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if types, ok := schema["type"]; ok && !matchesType(value, types) {
+		addErr("expected type %v, got %s", types, jsonTypeName(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addErr("value is not one of %v", enum)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		addErr("value must be %v", constant)
+	}
+
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		subschemas, ok := schema[key].([]interface{})
+		if !ok {
+			continue
+		}
+		matched := 0
+		var subErrs []string
+		for _, sub := range subschemas {
+			subSchema, _ := sub.(map[string]interface{})
+			var errsForSub []string
+			validateSchema(path, value, subSchema, &errsForSub)
+			if len(errsForSub) == 0 {
+				matched++
+			}
+			subErrs = append(subErrs, errsForSub...)
+		}
+		switch {
+		case key == "allOf" && matched != len(subschemas):
+			*errs = append(*errs, subErrs...)
+		case key == "anyOf" && matched == 0:
+			addErr("value does not match any schema in anyOf")
+		case key == "oneOf" && matched != 1:
+			addErr("value matches %d schemas in oneOf, want exactly 1", matched)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, exists := v[key]; !exists {
+						addErr("missing required property %q", key)
+					}
+				}
+			}
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propSchema, ok := properties[key].(map[string]interface{}); ok {
+				validateSchema(path+"."+key, v[key], propSchema, errs)
+				continue
+			}
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					addErr("unexpected property %q", key)
+				}
+			case map[string]interface{}:
+				validateSchema(path+"."+key, v[key], additional, errs)
+			}
+		}
+
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			addErr("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			addErr("expected at most %v items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateSchema(fmt.Sprintf("%s[%d]", path, i), item, items, errs)
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			addErr("expected at least %v characters", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			addErr("expected at most %v characters", n)
+		}
+
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && v < n {
+			addErr("value %v is less than minimum %v", v, n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && v > n {
+			addErr("value %v is greater than maximum %v", v, n)
+		}
+	}
+}
+
+// matchesType 检查值是否符合 type（字符串或字符串数组）
+func matchesType(value interface{}, types interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		return matchesSingleType(value, t)
+	case []interface{}:
+		for _, item := range t {
+			if name, ok := item.(string); ok && matchesSingleType(value, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchesSingleType(value interface{}, typeName string) bool {
+	switch typeName {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonTypeName(value) == typeName
+	}
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2025-2026 libaxuan
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", `{"a": 1}`, `{"a": 1}`},
+		{"code fence", "```json\n{\"a\": 1}\n```", `{"a": 1}`},
+		{"surrounding text", "Here you go: {\"a\": [1, 2]} hope it helps", `{"a": [1, 2]}`},
+		{"trailing commas", "{\"a\": [1, 2,], \"b\": 3,\n}", "{\"a\": [1, 2], \"b\": 3\n}"},
+		{"array", "```\n[1, 2,]\n```", `[1, 2]`},
+		{"commas inside strings", `{"a": "x,}", "b": "\",]", "c": [1,],}`, `{"a": "x,}", "b": "\",]", "c": [1]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RepairJSON(tt.input); got != tt.want {
+				t.Errorf("RepairJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	schema := map[string]interface{}{}
+	json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"status": {"enum": ["active", "inactive"]}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false
+	}`), &schema)
+
+	tests := []struct {
+		name     string
+		value    string
+		wantErrs int
+	}{
+		{"valid", `{"name": "Ann", "age": 30, "tags": ["a"], "status": "active"}`, 0},
+		{"missing required", `{"name": "Ann"}`, 1},
+		{"wrong type", `{"name": "Ann", "age": 1.5}`, 1},
+		{"below minimum", `{"name": "Ann", "age": -1}`, 1},
+		{"bad item and too many items", `{"name": "Ann", "age": 1, "tags": ["a", "b", 3]}`, 2},
+		{"not in enum", `{"name": "Ann", "age": 1, "status": "gone"}`, 1},
+		{"additional property", `{"name": "Ann", "age": 1, "extra": true}`, 1},
+		{"not an object", `[1]`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("invalid test value: %v", err)
+			}
+			if errs := ValidateJSONSchema(value, schema); len(errs) != tt.wantErrs {
+				t.Errorf("ValidateJSONSchema() = %v, want %d errors", errs, tt.wantErrs)
+			}
+		})
+	}
+}
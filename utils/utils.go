@@ -31,7 +31,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -68,6 +67,30 @@ func GenerateChatCompletionID() string {
 	return "chatcmpl-" + GenerateRandomString(29)
 }
 
+const (
+	responseIDKey      = "response_id"
+	responseCreatedKey = "response_created"
+)
+
+// SetResponseIdentity 指定响应使用的 ID 和创建时间（幂等回放时与首次响应保持一致）
+func SetResponseIdentity(c *gin.Context, id string, created int64) {
+	c.Set(responseIDKey, id)
+	c.Set(responseCreatedKey, created)
+}
+
+// responseIdentity 返回响应 ID 和创建时间，未指定时新生成
+func responseIdentity(c *gin.Context) (string, int64) {
+	id := c.GetString(responseIDKey)
+	if id == "" {
+		id = GenerateChatCompletionID()
+	}
+	created := c.GetInt64(responseCreatedKey)
+	if created == 0 {
+		created = time.Now().Unix()
+	}
+	return id, created
+}
+
 // ParseSSELine 解析SSE数据行
 func ParseSSELine(line string) string {
 	line = strings.TrimSpace(line)
@@ -96,6 +119,17 @@ func WriteSSEEvent(w http.ResponseWriter, event, data string) error {
 	return nil
 }
 
+// WriteSSEComment 写入SSE注释行（客户端会忽略，用于进度提示）
+func WriteSSEComment(w http.ResponseWriter, text string) error {
+	if _, err := fmt.Fprintf(w, ": %s\n\n", strings.ReplaceAll(text, "\n", " ")); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
 // StreamChatCompletion 处理流式聊天完成
 // StreamChatCompletion 处理流式聊天完成
 func StreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, modelName string) {
@@ -106,10 +140,11 @@ func StreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, mode
 	c.Header("Access-Control-Allow-Origin", "*")
 
 	// 生成响应ID
-	responseID := GenerateChatCompletionID()
+	responseID, created := responseIdentity(c)
 
 	// 处理流式数据
 	ctx := c.Request.Context()
+	multiChoice := false
 	for {
 		select {
 		case <-ctx.Done():
@@ -118,10 +153,13 @@ func StreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, mode
 
 		case data, ok := <-chatGenerator:
 			if !ok {
-				// 通道关闭，发送完成事件
-				finishEvent := models.NewChatCompletionStreamResponse(responseID, modelName, "", stringPtr("stop"))
-				if jsonData, err := json.Marshal(finishEvent); err == nil {
-					WriteSSEEvent(c.Writer, "", string(jsonData))
+				// 通道关闭，发送完成事件（多候选时各候选的完成事件已单独发送）
+				if !multiChoice {
+					finishEvent := models.NewChatCompletionStreamResponse(responseID, modelName, "", stringPtr("stop"))
+					finishEvent.Created = created
+					if jsonData, err := json.Marshal(finishEvent); err == nil {
+						WriteSSEEvent(c.Writer, "", string(jsonData))
+					}
 				}
 				WriteSSEEvent(c.Writer, "", "[DONE]")
 				return
@@ -132,15 +170,43 @@ func StreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, mode
 				// 文本内容
 				if v != "" {
 					streamResp := models.NewChatCompletionStreamResponse(responseID, modelName, v, nil)
+					streamResp.Created = created
+					if jsonData, err := json.Marshal(streamResp); err == nil {
+						WriteSSEEvent(c.Writer, "", string(jsonData))
+					}
+				}
+
+			case models.ChoiceChunk:
+				// 多候选（n > 1）的增量文本
+				multiChoice = true
+				if v.Content != "" {
+					streamResp := models.NewChatCompletionStreamResponse(responseID, modelName, v.Content, nil)
+					streamResp.Created = created
+					streamResp.Choices[0].Index = v.Index
 					if jsonData, err := json.Marshal(streamResp); err == nil {
 						WriteSSEEvent(c.Writer, "", string(jsonData))
 					}
 				}
 
+			case models.ChoiceFinish:
+				multiChoice = true
+				finishEvent := models.NewChatCompletionStreamResponse(responseID, modelName, "", stringPtr("stop"))
+				finishEvent.Created = created
+				finishEvent.Choices[0].Index = v.Index
+				if jsonData, err := json.Marshal(finishEvent); err == nil {
+					WriteSSEEvent(c.Writer, "", string(jsonData))
+				}
+
 			case models.Usage:
 				// 使用统计 - 通常在最后发送
 				continue
 
+			case models.StreamFinish:
+				continue
+
+			case models.Progress:
+				WriteSSEComment(c.Writer, v.Message)
+
 			case error:
 				logrus.WithError(v).Error("Stream generator error")
 				WriteSSEEvent(c.Writer, "", "[DONE]")
@@ -156,6 +222,7 @@ func StreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, mode
 // NonStreamChatCompletion 处理非流式聊天完成
 func NonStreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, modelName string) {
 	var fullContent strings.Builder
+	var choices []*strings.Builder
 	var usage models.Usage
 
 	// 收集所有数据
@@ -173,13 +240,21 @@ func NonStreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, m
 		case data, ok := <-chatGenerator:
 			if !ok {
 				// 数据收集完成，返回响应
-				responseID := GenerateChatCompletionID()
+				responseID, created := responseIdentity(c)
 				response := models.NewChatCompletionResponse(
 					responseID,
 					modelName,
 					fullContent.String(),
 					usage,
 				)
+				if len(choices) > 0 {
+					contents := make([]string, len(choices))
+					for i := range choices {
+						contents[i] = choices[i].String()
+					}
+					response = models.NewChatCompletionChoicesResponse(responseID, modelName, contents, usage)
+				}
+				response.Created = created
 				c.JSON(http.StatusOK, response)
 				return
 			}
@@ -187,6 +262,11 @@ func NonStreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, m
 			switch v := data.(type) {
 			case string:
 				fullContent.WriteString(v)
+			case models.ChoiceChunk:
+				choices = growChoices(choices, v.Index)
+				choices[v.Index].WriteString(v.Content)
+			case models.ChoiceFinish:
+				choices = growChoices(choices, v.Index)
 			case models.Usage:
 				usage = v
 			case error:
@@ -197,6 +277,14 @@ func NonStreamChatCompletion(c *gin.Context, chatGenerator <-chan interface{}, m
 	}
 }
 
+// growChoices 确保 choices 能容纳下标 index
+func growChoices(choices []*strings.Builder, index int) []*strings.Builder {
+	for len(choices) <= index {
+		choices = append(choices, &strings.Builder{})
+	}
+	return choices
+}
+
 // ErrorWrapper 错误包装器
 func ErrorWrapper(handler func(*gin.Context) error) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -316,6 +404,9 @@ func ReadSSEStream(ctx context.Context, resp *http.Response, output chan<- inter
 			}
 
 		case "finish":
+			if eventData.FinishReason != "" {
+				output <- models.StreamFinish{Reason: eventData.FinishReason}
+			}
 			if eventData.MessageMetadata != nil && eventData.MessageMetadata.Usage != nil {
 				usage := models.Usage{
 					PromptTokens:     eventData.MessageMetadata.Usage.InputTokens,
@@ -393,34 +484,3 @@ func ReadRequestBody(r *http.Request) ([]byte, error) {
 
 	return body, nil
 }
-
-// RunJS 执行JavaScript代码并返回标准输出内容
-func RunJS(jsCode string) (string, error) {
-	// 添加crypto模块导入并设置为全局变量
-	// 注意：使用stdin时，我们需要确保代码是自包含的
-	finalJS := `const crypto = require('crypto').webcrypto;
-global.crypto = crypto;
-globalThis.crypto = crypto;
-// 在Node.js环境中创建window对象
-if (typeof window === 'undefined') { global.window = global; }
-window.crypto = crypto;
-this.crypto = crypto;
-` + jsCode
-
-	// 执行Node.js命令，使用stdin输入代码
-	cmd := exec.Command("node")
-
-	// 设置输入
-	cmd.Stdin = strings.NewReader(finalJS)
-
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", fmt.Errorf("node.js execution failed (exit code: %d)\nSTDOUT:\n%s\nSTDERR:\n%s",
-				exitErr.ExitCode(), string(output), string(exitErr.Stderr))
-		}
-		return "", fmt.Errorf("failed to execute node.js: %w", err)
-	}
-
-	return strings.TrimSpace(string(output)), nil
-}